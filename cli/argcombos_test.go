@@ -387,3 +387,83 @@ func Test_ArgCombo_NoRetryByDefault(t *testing.T) {
 
 	assert.Equal(t, 1, hits, "without --retry a transient error is not retried")
 }
+
+// --- -b cookie files: cookies only go to the hosts/paths they belong to, on every redirect hop ---
+
+func Test_ArgCombo_CookieFileMatchesHostOnEachHop(t *testing.T) {
+	cookieSeen := map[string]string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cookieSeen[r.Host+r.URL.Path] = r.Header.Get("Cookie")
+		if r.URL.Path == "/start" {
+			// hop to the same server under a different host name
+			w.Header().Set("Location", strings.Replace(srvURL(r), "127.0.0.1", "localhost", 1)+"/dest")
+			w.WriteHeader(http.StatusFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	cookieFile := filepath.Join(t.TempDir(), "cookies.txt")
+	cookies := "# Netscape HTTP Cookie File\n" +
+		"127.0.0.1\tFALSE\t/\tFALSE\t4102444800\tipcookie\t1\n" +
+		"localhost\tFALSE\t/\tFALSE\t4102444800\thostcookie\t2\n" +
+		"localhost\tFALSE\t/other\tFALSE\t4102444800\tpathcookie\t3\n" +
+		"localhost\tFALSE\t/\tFALSE\t1\texpiredcookie\t5\n" +
+		"example.com\tFALSE\t/\tFALSE\t4102444800\tforeigncookie\t6\n"
+	if err := os.WriteFile(cookieFile, []byte(cookies), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := setupCtx(t, "-L", "-b", cookieFile, "-b", "raw=7", srv.URL+"/start")
+	_ = runToCompletion(t, ctx)
+
+	host := strings.TrimPrefix(srv.URL, "http://")
+	assert.Equal(t, "raw=7; ipcookie=1", cookieSeen[host+"/start"])
+	assert.Equal(t, "raw=7; hostcookie=2", cookieSeen[strings.Replace(host, "127.0.0.1", "localhost", 1)+"/dest"])
+}
+
+func srvURL(r *http.Request) string {
+	return "http://" + r.Host
+}
+
+func Test_ArgCombo_RetryResendsBody(t *testing.T) {
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+		if len(bodies) < 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	ctx := setupCtx(t, "--retry", "1", "--retry-delay", "0", "-d", "a=b", srv.URL+"/x")
+	_ = runToCompletion(t, ctx)
+
+	assert.Equal(t, []string{"a=b", "a=b"}, bodies, "the retry sends the body again")
+}
+
+// --- per-URL requests: what one URL's upload implies must not carry over to the next URL ---
+
+func Test_ArgCombo_UploadDoesNotLeakToNextUrl(t *testing.T) {
+	tmp := filepath.Join(t.TempDir(), "payload.json")
+	if err := os.WriteFile(tmp, []byte(`{"a":1}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	ctx := setupCtx(t, "-T", tmp, "http://localhost/one", "http://localhost/two")
+
+	first, cerr := ctx.BuildHttpRequest("", 0, true, true)
+	assert.Nil(t, cerr)
+	assert.Equal(t, "PUT", first.Method)
+	assert.Equal(t, "application/json", first.Header.Get("Content-Type"))
+
+	second, cerr := ctx.BuildHttpRequest("", 1, true, true)
+	assert.Nil(t, cerr)
+	assert.Equal(t, "GET", second.Method)
+	assert.Empty(t, second.Header.Get("Content-Type"))
+	assert.Empty(t, ctx.HttpVerb, "planning must not change the context")
+	assert.Empty(t, ctx.Headers)
+}
@@ -2,7 +2,10 @@ package cli
 
 import (
 	"bufio"
+	"fmt"
 	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 
 	curl "github.com/cdwiegand/go-curling/context"
@@ -18,8 +21,22 @@ func SetupConfigParseOnlyArgs(parseCtx *ParseOnlyArgs, flags *flag.FlagSet) {
 	flags.StringVarP(&parseCtx.ConfigFile, "config", "K", "", "Config file to parse for go-curling / curl")
 }
 
+// flagAliases maps other spellings we have accepted onto the flag they stand for
+var flagAliases = map[string]string{
+	"ca-cert": "cacert",
+	"ca-path": "capath",
+}
+
+func normalizeFlagAliases(f *flag.FlagSet, name string) flag.NormalizedName {
+	if alias, ok := flagAliases[name]; ok {
+		name = alias
+	}
+	return flag.NormalizedName(name)
+}
+
 func SetupFlagArgs(ctx *curl.CurlContext, flags *flag.FlagSet) {
 	empty := []string{}
+	flags.SetNormalizeFunc(normalizeFlagAliases)
 	flags.BoolVarP(&ctx.Version, "version", "V", false, "Return version and exit")
 	flags.BoolVarP(&ctx.Verbose, "verbose", "v", false, "Logs all headers, and body to output")
 	flags.StringVar(&ctx.ErrorOutput, "stderr", curl.DEFAULT_STDERR, "Log errors to this replacement for stderr")
@@ -30,9 +47,11 @@ func SetupFlagArgs(ctx *curl.CurlContext, flags *flag.FlagSet) {
 	flags.StringVarP(&ctx.UserAuth, "user", "u", "", "User:password for HTTP authentication")
 	flags.StringVarP(&ctx.Referer, "referer", "e", "", "Referer URL to use with HTTP request")
 	flags.StringArrayVar(&ctx.Urls, "url", []string{}, "Requesting URL")
-	flags.BoolVarP(&ctx.SilentFail, "fail", "f", false, "If fail do not emit contents just return fail exit code (-6)")
+	flags.BoolVarP(&ctx.SilentFail, "fail", "f", false, "If fail do not emit contents just return fail exit code (22)")
 	flags.BoolVar(&ctx.FailEarly, "fail-early", false, "If any URL fails, stop immediately and do not continue.")
-	flags.BoolVar(&ctx.FailWithBody, "fail-with-body", false, "If fail emit contents and return fail exit code (-6)")
+	flags.BoolVar(&ctx.FailWithBody, "fail-with-body", false, "If fail emit contents and return fail exit code (22)")
+	flags.StringVar(&ctx.ErrorFormat, "error-format", curl.ERROR_FORMAT_TEXT, "How errors are written: text, or json (one object per line, with category, exit code, URL index and redirect hop)") // NOT UPSTREAM curl!
+	flags.BoolVar(&ctx.LegacyExitCodes, "legacy-exit-codes", false, "Exit with go-curling's original negative error codes instead of curl's")                                                      // NOT UPSTREAM curl!
 	flags.BoolVarP(&ctx.IgnoreBadCerts, "insecure", "k", false, "Ignore invalid SSL certificates")
 	flags.BoolVarP(&ctx.IsSilent, "silent", "s", false, "Silence all program console output")
 	flags.BoolVarP(&ctx.ShowErrorEvenIfSilent, "show-error", "S", false, "Show error info even if silent mode on")
@@ -48,16 +67,30 @@ func SetupFlagArgs(ctx *curl.CurlContext, flags *flag.FlagSet) {
 	flags.StringArrayVarP(&ctx.Form_Multipart, "form", "F", empty, "HTML form data (multipart MIME), sets mime type to 'multipart/form-data' unless specified as a header")
 	flags.StringArrayVar(&ctx.Form_MultipartRaw, "form-string", empty, "HTML form data (multipart MIME), exact value used, no @file or >file support")
 	flags.StringVarP(&ctx.CookieJar, "cookie-jar", "c", "", "File for storing (read and write) cookies")
-	flags.BoolVar(&ctx.JunkSessionCookies, "junk-session-cookies", false, "Does not store session cookies in cookie jar")
+	flags.BoolVarP(&ctx.JunkSessionCookies, "junk-session-cookies", "j", false, "Discards session cookies when loading cookies and does not store them in the cookie jar")
+	flags.StringVar(&ctx.SessionName, "session", "", "Named session (or path to a session file) that keeps cookies, -H headers, auth and base URL between runs")                                // NOT UPSTREAM curl!
+	flags.StringVar(&ctx.SessionReadOnly, "session-read-only", "", "Like --session, but the session file is only read, never updated")                                                          // NOT UPSTREAM curl!
+	flags.StringVar(&ctx.CookieJarFormat, "cookie-jar-format", curl.COOKIE_FORMAT_AUTO, "Cookie jar file format: auto (detect, new files are netscape), netscape (curl's cookies.txt) or json") // NOT UPSTREAM curl!
 	flags.StringArrayVarP(&ctx.Upload_File, "upload-file", "T", []string{}, "Raw file(s) to PUT (default) to the url(s) given, not encoded, sets mime type to detected mime type for extension unless specified as a header")
 	flags.StringArrayVarP(&ctx.Headers, "header", "H", []string{}, "Header(s) to append to request")
 	flags.BoolVar(&ctx.DoNotUseHostCertificateAuthorities, "no-ca-native", false, "Do not use the host's Certificate Authorities (turns off --ca-native)")
-	flags.StringArrayVar(&ctx.CaCertFile, "ca-cert", nil, "Specifies PEM file(s) containing certs for trusted Certificate Authorities")
-	flags.StringVar(&ctx.CaCertPath, "ca-path", "", "Specifies a directory container PEM files containing certs for trusted Certificate Authorities")
-	flags.StringVarP(&ctx.ClientCertFile, "cert", "E", "", "Client certificate (cert or cert + key) to use for authentication to server, with :password after if key is encrypted")
+	flags.StringArrayVar(&ctx.CaCertFile, "cacert", nil, "Specifies PEM file(s) containing certs for trusted Certificate Authorities, also --ca-cert (default: $CURL_CA_BUNDLE, else $SSL_CERT_FILE)")
+	flags.StringVar(&ctx.CaCertPath, "capath", "", "Specifies a directory of PEM files (such as c_rehash <hash>.N links) containing certs for trusted Certificate Authorities, also --ca-path (default: $SSL_CERT_DIR)")
+	flags.StringArrayVarP(&ctx.ClientCertFile, "cert", "E", nil, "Client certificate (cert or cert + key, or a directory of them) to use for authentication to server, with :password after if key is encrypted; repeat to let the server's CA list choose")
 	flags.StringVar(&ctx.ClientCertKeyFile, "key", "", "Client certificate key to use for authentication to server, with :password after if encrypted")
 	flags.StringVar(&ctx.ClientCertKeyPassword, "key-password", "", "Password to decrypt client certificate key") // NOT UPSTREAM curl!
+	flags.StringVar(&ctx.ClientCertType, "cert-type", "", "Client certificate type: PEM, DER or P12 (default PEM, or P12 for .p12/.pfx files)")
+	flags.StringVar(&ctx.ClientCertKeyType, "key-type", "", "Client certificate key type: PEM or DER (default PEM)")
+	flags.BoolVar(&ctx.RequireCertStatus, "cert-status", false, "Require the server to staple a valid OCSP response showing its certificate is good")
+	flags.StringVar(&ctx.CrlFile, "crlfile", "", "PEM or DER certificate revocation list(s) to reject revoked server certificates with")
+	flags.BoolVar(&ctx.CertInfo, "cert-info", false, "Print every certificate in the server's chain: subject, issuer, SANs, serial, validity, key and fingerprints") // NOT UPSTREAM curl!
+	flags.IntVar(&ctx.WarnCertExpiryDays, "warn-cert-expiry", 0, "Exit with an error if any certificate in the server's chain expires within this many days")        // NOT UPSTREAM curl!
+	flags.StringVar(&ctx.PinnedPubKey, "pinnedpubkey", "", "Public key(s) the server must present: sha256//BASE64[;sha256//BASE64...] or a PEM/DER public key file, checked even with -k")
+	flags.StringVar(&ctx.ProxyPinnedPubKey, "proxy-pinnedpubkey", "", "Like --pinnedpubkey, for the TLS connection to an HTTPS proxy")
 	flags.BoolVar(&ctx.EnableCompression, "compressed", false, "Requests compression")
+	flags.StringVar(&ctx.RecordFile, "record", "", "Write every request sent (redirects and retries included) and its response to this cassette file")                   // NOT UPSTREAM curl!
+	flags.StringVar(&ctx.ReplayFile, "replay", "", "Answer requests from this --record cassette file instead of the network")                                            // NOT UPSTREAM curl!
+	flags.StringVar(&ctx.ReplayMatch, "replay-match", curl.DEFAULT_CASSETTE_MATCH, "What a request must share with a recorded one for --replay: any of method,url,body") // NOT UPSTREAM curl!
 	//flags.BoolVar(&ctx.EnableCompression, "tr-encoding", false, "Requests compression (obsolete)")
 	//flags.MarkHidden("tr-encoding")
 	flags.BoolVar(&ctx.DisableKeepalives, "no-keepalive", false, "Disable use of keepalive messages")
@@ -77,26 +110,56 @@ func SetupFlagArgs(ctx *curl.CurlContext, flags *flag.FlagSet) {
 	flags.BoolVar(&ctx.Tls_MinVersion_1_0, "tlsv1.0", false, "Force TLS connections to version 1.0 or higher")
 	flags.BoolVarP(&ctx.Tls_MinVersion_1_0, "tlsv1", "1", false, "Force TLS connections to version 1.0 or higher")
 	flags.StringVar(&ctx.Tls_MaxVersionString, "tls-max", "", "Force TLS connections to maximum version specified")
+	flags.StringVar(&ctx.TlsServerName, "tls-servername", "", "Send this name (SNI) in the TLS handshake instead of the URL's host, and verify the certificate against it")
+	flags.StringVar(&ctx.KeyLogFile, "keylog", "", "Append TLS session secrets to this file (NSS key log format, as SSLKEYLOGFILE) for Wireshark") // NOT UPSTREAM curl!
+	flags.StringVar(&ctx.EchMode, "ech", "", "Encrypted Client Hello: false, grease, true (use with --ech-config), hard (fail without ECH) or ecl:BASE64")
+	flags.StringVar(&ctx.EchConfig, "ech-config", "", "Base64 ECHConfigList to encrypt the Client Hello with, as published in the server's HTTPS DNS record") // NOT UPSTREAM curl!
+	flags.StringVar(&ctx.TlsCiphers, "ciphers", "", "TLS 1.2 and below cipher suites to offer, OpenSSL or IANA names separated by ':'")
+	flags.StringVar(&ctx.Tls13Ciphers, "tls13-ciphers", "", "TLS 1.3 cipher suites to allow, separated by ':' (the connection fails if the server chooses another)")
+	flags.StringVar(&ctx.TlsCurves, "curves", "", "Key exchange groups to offer, in preference order and separated by ':', e.g. X25519MLKEM768:X25519:P-256")
+	flags.BoolVar(&ctx.ListTlsSupport, "list-tls", false, "List the ciphers and curves supported by --ciphers, --tls13-ciphers and --curves, and exit") // NOT UPSTREAM curl!
 	flags.BoolVar(&ctx.ForceTryHttp2, "http2", false, "Force trying an HTTP2 connection initially")
 	flags.IntVar(&ctx.MaxRetries, "retry", 0, "Number of times to retry a request if it returns a transient error (or, with --retry-all-errors, any error)")
 	flags.IntVar(&ctx.RetryDelaySeconds, "retry-delay", 0, "Seconds to wait between retries (see --retry)")
 	flags.BoolVar(&ctx.RetryAllErrors, "retry-all-errors", false, "Retry on any error status (>= 400), not just transient ones (see --retry)")
 	flags.Float32Var(&ctx.Expect100Timeout, "expect100-timeout", 0, "Seconds to wait for a 100-continue response before sending the request body")
 	flags.BoolVarP(&ctx.ConvertPostFormIntoGet, "get", "G", false, "Convert -d/--data and related parameters into GET query string parameters")
+	flags.BoolVar(&ctx.DoNotRedactSecrets, "no-redact", false, "Show secret header values (Authorization, Cookie, API keys) and query parameters in verbose output and header dumps") // NOT UPSTREAM curl!
+	flags.StringArrayVar(&ctx.RedactHeaders, "redact-header", empty, "Additional header name to mask in verbose output and header dumps")                                             // NOT UPSTREAM curl!
+	flags.StringArrayVar(&ctx.RedactQueryParams, "redact-query", empty, "Additional query parameter name to mask in URLs shown in output and errors")                                 // NOT UPSTREAM curl!
+}
+
+// globalFlags apply to every -:/--next group wherever they're given: they configure the one client (and so its
+// TLS), cookie jar and session that all groups share, or the run as a whole. All other options are per group.
+var globalFlags = map[string]bool{
+	"version": true, "verbose": true, "stderr": true, "silent": true, "show-error": true, "config": true,
+	"fail-early": true, "error-format": true, "legacy-exit-codes": true, "list-tls": true,
+	"cookie-jar": true, "junk-session-cookies": true, "cookie-jar-format": true, "session": true, "session-read-only": true,
+	"insecure": true, "no-ca-native": true, "cacert": true, "capath": true, "crlfile": true, "cert-status": true,
+	"cert": true, "key": true, "key-password": true, "cert-type": true, "key-type": true,
+	"pinnedpubkey": true, "proxy-pinnedpubkey": true, "cert-info": true, "warn-cert-expiry": true,
+	"tlsv1.3": true, "tlsv1.2": true, "tlsv1.1": true, "tlsv1.0": true, "tlsv1": true, "tls-max": true,
+	"tls-servername": true, "keylog": true, "ech": true, "ech-config": true,
+	"ciphers": true, "tls13-ciphers": true, "curves": true,
+	"compressed": true, "no-keepalive": true, "no-buffer": true, "http2": true, "expect100-timeout": true,
+	"no-redact": true, "redact-header": true, "redact-query": true,
+	"record": true, "replay": true, "replay-match": true,
+}
+
+func isNextArg(arg string) bool {
+	return arg == "-:" || arg == "--next"
 }
 
 func ParseFlags(args []string, ctx *curl.CurlContext) ([]string, *curlerrors.CurlError) {
 	// args: os.Args[1:] normally, if testing you provide :)
 	// I want to be able to test using my own args[], so can't use default flag.Parse()..
 
-	for i := 0; i < len(args); i++ {
-		if args[i] == "-K" || args[i] == "--config" {
-			moreArgs, err2 := ParseConfigFile(args[i+1])
-			if err2 != nil {
-				return nil, curlerrors.NewCurlErrorFromStringAndError(curlerrors.ERROR_INVALID_ARGS, "Invalid args/failed to parse flags", err2)
-			}
-			args = append(args, moreArgs...)
-		}
+	args, err2 := expandConfigFiles(args)
+	if err2 != nil {
+		return nil, curlerrors.NewCurlErrorFromStringAndError(curlerrors.ERROR_INVALID_ARGS, "Invalid args/failed to parse flags", err2)
+	}
+	if slices.ContainsFunc(args, isNextArg) {
+		return nil, curlerrors.NewCurlErrorFromString(curlerrors.ERROR_INVALID_ARGS, "-:/--next needs ParseFlagGroups")
 	}
 
 	flags := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
@@ -109,6 +172,131 @@ func ParseFlags(args []string, ctx *curl.CurlContext) ([]string, *curlerrors.Cur
 	return extraArgs, nil
 }
 
+// ParseFlagGroups is ParseFlags for arguments split by -:/--next (on the command line or in -K config files) into
+// groups, each with its own URLs and CurlContext. Per-URL options only apply to their own group, while
+// globalFlags apply to all of them (if given in more than one group, the last one wins).
+func ParseFlagGroups(args []string) (ctxs []*curl.CurlContext, extraArgs [][]string, cerr *curlerrors.CurlError) {
+	args, err := expandConfigFiles(args)
+	if err != nil {
+		return nil, nil, curlerrors.NewCurlErrorFromStringAndError(curlerrors.ERROR_INVALID_ARGS, "Invalid args/failed to parse flags", err)
+	}
+
+	var flagSets []*flag.FlagSet
+	group := []string{}
+	for i := 0; i <= len(args); i++ {
+		if i < len(args) && !isNextArg(args[i]) {
+			group = append(group, args[i])
+			continue
+		}
+		ctx := new(curl.CurlContext)
+		flags := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+		SetupFlagArgs(ctx, flags)
+		if err := flags.Parse(group); err != nil {
+			return nil, nil, curlerrors.NewCurlErrorFromStringAndError(curlerrors.ERROR_INVALID_ARGS, "Invalid args/failed to parse flags", err)
+		}
+		ctxs = append(ctxs, ctx)
+		flagSets = append(flagSets, flags)
+		extraArgs = append(extraArgs, flags.Args())
+		group = []string{}
+	}
+
+	// the global flags each group gave, in order, so applying them all leaves the last group's value
+	var globals []globalFlagValue
+	for _, flags := range flagSets {
+		flags.Visit(func(f *flag.Flag) {
+			if globalFlags[f.Name] {
+				globals = append(globals, snapshotFlagValue(f))
+			}
+		})
+	}
+	for _, flags := range flagSets {
+		for _, global := range globals {
+			global.applyTo(flags.Lookup(global.name).Value)
+		}
+	}
+	return ctxs, extraArgs, nil
+}
+
+// globalFlagValue is a copy of a flag's value, taken before any are applied, as aliases (such as --cacert and
+// --ca-cert) share one variable.
+type globalFlagValue struct {
+	name  string
+	value string
+	slice []string // for flag.SliceValue flags, instead of value
+}
+
+func snapshotFlagValue(f *flag.Flag) globalFlagValue {
+	if slice, ok := f.Value.(flag.SliceValue); ok {
+		return globalFlagValue{name: f.Name, slice: slices.Clone(slice.GetSlice())}
+	}
+	return globalFlagValue{name: f.Name, value: f.Value.String()}
+}
+
+func (g globalFlagValue) applyTo(to flag.Value) {
+	if slice, ok := to.(flag.SliceValue); ok {
+		_ = slice.Replace(slices.Clone(g.slice))
+		return
+	}
+	_ = to.Set(g.value)
+}
+
+// expandConfigFiles puts each -K/--config file's arguments right after it, as curl does, so later arguments
+// (and -:/--next groups) follow on from the file's.
+func expandConfigFiles(args []string) ([]string, error) {
+	return expandConfigFilesWithin(args, nil)
+}
+
+// expandConfigFilesWithin is expandConfigFiles for args read from the including config files (outermost first),
+// so that a file including itself, directly or through another, is an error rather than endless.
+func expandConfigFilesWithin(args []string, including []string) ([]string, error) {
+	var ret []string
+	for i := 0; i < len(args); i++ {
+		ret = append(ret, args[i])
+		path, found := configFileArg(args[i])
+		if !found {
+			continue
+		}
+		if path == "" { // -K file, --config file
+			if i+1 >= len(args) {
+				break // pflag reports the missing argument
+			}
+			i++
+			path = args[i]
+			ret = append(ret, path)
+		}
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		if slices.Contains(including, absPath) {
+			return nil, fmt.Errorf("config file %s includes itself", path)
+		}
+		moreArgs, err := ParseConfigFile(path)
+		if err != nil {
+			return nil, err
+		}
+		moreArgs, err = expandConfigFilesWithin(moreArgs, append(slices.Clone(including), absPath))
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, moreArgs...)
+	}
+	return ret, nil
+}
+
+// configFileArg is whether arg is -K/--config, and its file if given in the same argument (--config=file, -Kfile).
+func configFileArg(arg string) (string, bool) {
+	switch {
+	case arg == "-K" || arg == "--config":
+		return "", true
+	case strings.HasPrefix(arg, "--config="):
+		return strings.TrimPrefix(arg, "--config="), true
+	case strings.HasPrefix(arg, "-K"):
+		return strings.TrimPrefix(arg, "-K"), true
+	}
+	return "", false
+}
+
 func ParseConfigFile(path string) ([]string, error) {
 	// each line is separate "arguments", with some tweaks, examples below
 
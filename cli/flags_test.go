@@ -56,3 +56,128 @@ func Test_ParseArgsWithConfigFile(t *testing.T) {
 	assert.Equal(t, 1, len(ctx.Urls))                        // url = "https://httpbin.org/post"
 	assert.Equal(t, "https://httpbin.org/post", ctx.Urls[0]) // url = "https://httpbin.org/post"
 }
+
+func Test_ParseFlags_CaAliases(t *testing.T) {
+	ctx := &curl.CurlContext{}
+	_, cerr := ParseFlags([]string{"--cacert", "a.pem", "--ca-cert", "b.pem", "--ca-path", "certs", "https://example.com"}, ctx)
+	assert.Nil(t, cerr)
+	assert.Equal(t, []string{"a.pem", "b.pem"}, ctx.CaCertFile)
+	assert.Equal(t, "certs", ctx.CaCertPath)
+}
+
+func Test_ParseFlagGroups(t *testing.T) {
+	args := []string{"-H", "X-First: 1", "-d", "a=b", "http://localhost/login", "-:", "-k", "-o", "report.txt", "http://localhost/report", "--next", "http://localhost/other"}
+	ctxs, extras, cerr := ParseFlagGroups(args)
+	if !assert.Nil(t, cerr) {
+		return
+	}
+	assert.Len(t, ctxs, 3)
+	assert.Equal(t, [][]string{{"http://localhost/login"}, {"http://localhost/report"}, {"http://localhost/other"}}, extras)
+
+	// per-URL options stay in their group
+	assert.Equal(t, []string{"X-First: 1"}, ctxs[0].Headers)
+	assert.Equal(t, []string{"a=b"}, ctxs[0].Data_Standard)
+	assert.Empty(t, ctxs[1].Headers)
+	assert.Empty(t, ctxs[1].Data_Standard)
+	assert.Equal(t, []string{"report.txt"}, ctxs[1].BodyOutput)
+	assert.Equal(t, []string{curl.DEFAULT_OUTPUT}, ctxs[2].BodyOutput)
+
+	// global ones apply to every group, whichever they were given in
+	for _, ctx := range ctxs {
+		assert.True(t, ctx.IgnoreBadCerts)
+	}
+}
+
+func Test_ParseFlagGroups_LastGlobalWins(t *testing.T) {
+	cases := []struct {
+		name  string
+		args  []string
+		check func(ctx *curl.CurlContext)
+	}{
+		{"tls-max", []string{"--tls-max", "1.2", "http://localhost/1", "--next", "--tls-max", "1.3", "http://localhost/2"},
+			func(ctx *curl.CurlContext) { assert.Equal(t, "1.3", ctx.Tls_MaxVersionString) }},
+		{"cacert", []string{"--cacert", "a.pem", "http://localhost/1", "--next", "--cacert", "b.pem", "http://localhost/2"},
+			func(ctx *curl.CurlContext) { assert.Equal(t, []string{"b.pem"}, ctx.CaCertFile) }},
+		{"three groups", []string{"--tls-max", "1.1", "http://localhost/1", "--next", "--tls-max", "1.3", "http://localhost/2", "--next", "http://localhost/3"},
+			func(ctx *curl.CurlContext) { assert.Equal(t, "1.3", ctx.Tls_MaxVersionString) }},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ctxs, _, cerr := ParseFlagGroups(c.args)
+			if !assert.Nil(t, cerr) {
+				return
+			}
+			for _, ctx := range ctxs {
+				c.check(ctx)
+			}
+		})
+	}
+}
+
+func Test_ParseFlagGroups_ConfigFile(t *testing.T) {
+	testFile := filepath.Join(t.TempDir(), "config.test")
+	config := "cacert = ca.pem\nrequest POST\nurl = \"http://localhost/one\"\nnext\nurl = \"http://localhost/two\"\n"
+	if err := os.WriteFile(testFile, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctxs, _, cerr := ParseFlagGroups([]string{"-K", testFile, "-H", "X-Last: 1"})
+	if !assert.Nil(t, cerr) {
+		return
+	}
+	assert.Len(t, ctxs, 2)
+	assert.Equal(t, "POST", ctxs[0].HttpVerb)
+	assert.Equal(t, []string{"http://localhost/one"}, ctxs[0].Urls)
+	assert.Empty(t, ctxs[1].HttpVerb)
+	assert.Equal(t, []string{"http://localhost/two"}, ctxs[1].Urls)
+	assert.Equal(t, []string{"X-Last: 1"}, ctxs[1].Headers, "arguments after -K follow on from the file's last group")
+	assert.Equal(t, []string{"ca.pem"}, ctxs[1].CaCertFile)
+}
+
+func Test_ParseFlags_ConfigFileJoinedForms(t *testing.T) {
+	testFile := filepath.Join(t.TempDir(), "config.test")
+	if err := os.WriteFile(testFile, []byte("request POST\nurl = \"http://localhost/one\"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, arg := range []string{"--config=" + testFile, "-K" + testFile} {
+		ctx := new(curl.CurlContext)
+		_, cerr := ParseFlags([]string{arg}, ctx)
+		if !assert.Nil(t, cerr, arg) {
+			continue
+		}
+		assert.Equal(t, "POST", ctx.HttpVerb, arg)
+		assert.Equal(t, []string{"http://localhost/one"}, ctx.Urls, arg)
+	}
+}
+
+func Test_ParseFlags_ConfigFileIncludingItself(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.conf")
+	second := filepath.Join(dir, "second.conf")
+	if err := os.WriteFile(first, []byte("-v\nconfig = \""+second+"\"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(second, []byte("-s\nconfig = \""+first+"\"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, cerr := ParseFlags([]string{"-K", first}, new(curl.CurlContext))
+	if assert.NotNil(t, cerr) {
+		assert.Contains(t, cerr.Error(), "includes itself")
+	}
+
+	// the same file twice is fine, as long as it doesn't include itself
+	common := filepath.Join(dir, "common.conf")
+	if err := os.WriteFile(common, []byte("-k\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	ctxs, _, cerr := ParseFlagGroups([]string{"-K", common, "http://localhost/1", "-:", "-K", common, "http://localhost/2"})
+	assert.Nil(t, cerr)
+	assert.Len(t, ctxs, 2)
+}
+
+func Test_ParseFlags_RejectsNext(t *testing.T) {
+	_, cerr := ParseFlags([]string{"http://localhost/", "--next", "http://localhost/2"}, new(curl.CurlContext))
+	assert.NotNil(t, cerr)
+}
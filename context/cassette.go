@@ -0,0 +1,292 @@
+package context
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	curlerrors "github.com/cdwiegand/go-curling/errors"
+)
+
+// --replay-match values
+const CASSETTE_MATCH_METHOD = "method"
+const CASSETTE_MATCH_URL = "url"
+const CASSETTE_MATCH_BODY = "body"
+const DEFAULT_CASSETTE_MATCH = CASSETTE_MATCH_METHOD + "," + CASSETTE_MATCH_URL + "," + CASSETTE_MATCH_BODY
+
+// Cassette is what --record writes and --replay serves back: every request sent, redirects and retries included,
+// and the response it got, in order.
+type Cassette struct {
+	Interactions []CassetteInteraction `json:"interactions"`
+}
+
+type CassetteInteraction struct {
+	Request  CassetteRequest  `json:"request"`
+	Response CassetteResponse `json:"response"`
+}
+
+type CassetteRequest struct {
+	Method  string       `json:"method"`
+	Url     string       `json:"url"`               // secret query parameters are redacted, as in -v output
+	Headers http.Header  `json:"headers,omitempty"` // secret headers are redacted, as in -v output
+	Body    CassetteBody `json:"body,omitempty"`
+}
+
+type CassetteResponse struct {
+	Status  int          `json:"status"`
+	Proto   string       `json:"proto,omitempty"`
+	Headers http.Header  `json:"headers,omitempty"`
+	Body    CassetteBody `json:"body,omitempty"`
+}
+
+// CassetteBody is a body as a JSON string when it's text, or else as {"base64": "..."}.
+type CassetteBody []byte
+
+func (b CassetteBody) MarshalJSON() ([]byte, error) {
+	if utf8.Valid(b) {
+		return json.Marshal(string(b))
+	}
+	return json.Marshal(map[string]string{"base64": base64.StdEncoding.EncodeToString(b)})
+}
+
+func (b *CassetteBody) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*b = CassetteBody(text)
+		return nil
+	}
+	var encoded struct {
+		Base64 string `json:"base64"`
+	}
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded.Base64)
+	*b = decoded
+	return err
+}
+
+// ReadCassette reads a --record/--replay file.
+func ReadCassette(file string) (*Cassette, error) {
+	data, err := os.ReadFile(file) // #nosec G304
+	if err != nil {
+		return nil, err
+	}
+	cassette := &Cassette{}
+	err = json.Unmarshal(data, cassette)
+	return cassette, err
+}
+
+// WriteCassette writes a cassette file whole, so a run that stops part way still leaves a readable one.
+func WriteCassette(file string, cassette *Cassette) error {
+	data, err := json.MarshalIndent(cassette, "", "  ")
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(file, func(tmpPath string) error {
+		return os.WriteFile(tmpPath, append(data, '\n'), 0600)
+	})
+}
+
+// validateCassetteArgs checks --record, --replay and --replay-match.
+func (ctx *CurlContext) validateCassetteArgs() *curlerrors.CurlError {
+	if ctx.RecordFile != "" && ctx.ReplayFile != "" {
+		return curlerrors.NewCurlErrorFromString(curlerrors.ERROR_INVALID_ARGS, "Cannot include both --record and --replay")
+	}
+	if _, err := parseCassetteMatch(ctx.ReplayMatch); err != nil {
+		return curlerrors.NewCurlErrorFromError(curlerrors.ERROR_INVALID_ARGS, err)
+	}
+	return nil
+}
+
+// parseCassetteMatch is --replay-match's comma separated list of what a request must have in common with a recorded
+// one to be answered by it: any of method, url and body (all three if not given).
+func parseCassetteMatch(match string) ([]string, error) {
+	if match == "" {
+		match = DEFAULT_CASSETTE_MATCH
+	}
+	var ret []string
+	for _, part := range strings.Split(match, ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+		switch part {
+		case CASSETTE_MATCH_METHOD, CASSETTE_MATCH_URL, CASSETTE_MATCH_BODY:
+			ret = append(ret, part)
+		default:
+			return nil, fmt.Errorf("--replay-match must be a comma separated list of method, url and body, not %q", part)
+		}
+	}
+	return ret, nil
+}
+
+// wrapCassetteTransport applies --replay (which replaces next, so nothing is sent) or --record (which passes
+// requests on to next, writing down each exchange).
+func (ctx *CurlContext) wrapCassetteTransport(next http.RoundTripper) (http.RoundTripper, *curlerrors.CurlError) {
+	if ctx.ReplayFile != "" {
+		cassette, err := ReadCassette(ctx.ReplayFile)
+		if err != nil {
+			return nil, curlerrors.NewCurlErrorFromStringAndError(curlerrors.ERROR_CANNOT_READ_FILE, "Unable to read cassette "+ctx.ReplayFile, err)
+		}
+		match, _ := parseCassetteMatch(ctx.ReplayMatch) // validated in setup
+		return &replayTransport{cassette: cassette, match: match, redactor: ctx.BuildRedactor(), used: make([]bool, len(cassette.Interactions))}, nil
+	}
+	if ctx.RecordFile != "" {
+		return &recordTransport{next: next, file: ctx.RecordFile, redactor: ctx.BuildRedactor(), cassette: &Cassette{}}, nil
+	}
+	return next, nil
+}
+
+// recordTransport is --record: it sends each request on, and rewrites the cassette with the exchange added.
+type recordTransport struct {
+	mu       sync.Mutex
+	next     http.RoundTripper
+	file     string
+	redactor *Redactor
+	cassette *Cassette
+}
+
+func (t *recordTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err // nothing came back, so nothing to replay
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	headers := req.Header.Clone()
+	for name, values := range headers {
+		for i, value := range values {
+			values[i] = t.redactor.RedactHeaderValue(name, value)
+		}
+	}
+	interaction := CassetteInteraction{
+		Request: CassetteRequest{Method: req.Method, Url: t.redactor.RedactUrl(req.URL), Headers: headers, Body: reqBody},
+		// the response as read: already decompressed, if --compressed was
+		Response: CassetteResponse{Status: resp.StatusCode, Proto: resp.Proto, Headers: resp.Header.Clone(), Body: respBody},
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.cassette.Interactions = append(t.cassette.Interactions, interaction)
+	if err := WriteCassette(t.file, t.cassette); err != nil {
+		return nil, fmt.Errorf("unable to write cassette %s: %w", t.file, err)
+	}
+	return resp, nil
+}
+
+// replayTransport is --replay: each request is answered by the first recorded one it matches that hasn't already
+// answered one, so repeats (such as retries) get their recorded responses in turn. Nothing is sent.
+type replayTransport struct {
+	mu       sync.Mutex
+	cassette *Cassette
+	match    []string
+	redactor *Redactor
+	used     []bool
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := req.Context().Err(); err != nil {
+		return nil, err
+	}
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	url := t.redactor.RedactUrl(req.URL)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, interaction := range t.cassette.Interactions {
+		if t.used[i] || !t.matches(interaction.Request, req, url, body) {
+			continue
+		}
+		t.used[i] = true
+		recorded := interaction.Response
+		resp := &http.Response{
+			Status:        strconv.Itoa(recorded.Status) + " " + http.StatusText(recorded.Status),
+			StatusCode:    recorded.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        recorded.Headers.Clone(),
+			Body:          io.NopCloser(bytes.NewReader(recorded.Body)),
+			ContentLength: int64(len(recorded.Body)),
+			Request:       req,
+		}
+		if resp.Header == nil {
+			resp.Header = make(http.Header)
+		}
+		if major, minor, ok := http.ParseHTTPVersion(recorded.Proto); ok {
+			resp.Proto, resp.ProtoMajor, resp.ProtoMinor = recorded.Proto, major, minor
+		}
+		return resp, nil
+	}
+	return nil, fmt.Errorf("no recorded response for %s %s", req.Method, url)
+}
+
+func (t *replayTransport) matches(recorded CassetteRequest, req *http.Request, url string, body []byte) bool {
+	for _, match := range t.match {
+		switch match {
+		case CASSETTE_MATCH_METHOD:
+			if recorded.Method != req.Method {
+				return false
+			}
+		case CASSETTE_MATCH_URL:
+			if recorded.Url != url {
+				return false
+			}
+		case CASSETTE_MATCH_BODY:
+			if !bytes.Equal(withoutMultipartBoundary(recorded.Body, recorded.Headers), withoutMultipartBoundary(body, req.Header)) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// withoutMultipartBoundary blanks out a multipart body's boundary, which is random, so -F bodies can match.
+func withoutMultipartBoundary(body []byte, headers http.Header) []byte {
+	_, params, err := mime.ParseMediaType(headers.Get("Content-Type"))
+	if err != nil || params["boundary"] == "" {
+		return body
+	}
+	return bytes.ReplaceAll(body, []byte(params["boundary"]), nil)
+}
+
+// readRequestBody is a copy of the request's body, leaving the request able to send it.
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		defer body.Close()
+		return io.ReadAll(body)
+	}
+	data, err := io.ReadAll(req.Body)
+	_ = req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(data))
+	return data, nil
+}
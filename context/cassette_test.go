@@ -0,0 +1,109 @@
+package context
+
+import (
+	"io"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Cassette_RecordThenReplay(t *testing.T) {
+	hits := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/start", func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		_ = r.ParseMultipartForm(1 << 20)
+		http.Redirect(w, r, "/done?name="+r.FormValue("name"), http.StatusFound)
+	})
+	mux.HandleFunc("/done", func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		_, _ = io.WriteString(w, "got "+r.URL.Query().Get("name")+"\xff")
+	})
+	cassetteFile := filepath.Join(t.TempDir(), "cassette.json")
+
+	run := func(ctx *CurlContext) *CurlResponse {
+		ctx.FollowRedirects = true
+		ctx.Form_Multipart = []string{"name=value"}
+		assert.Nil(t, ctx.SetupContextForRun([]string{"http://service.test/start?token=secret"}))
+		resps, last := handlerResponses(t, ctx, "")
+		assert.Len(t, resps.Responses, 2)
+		return last
+	}
+
+	last := run(&CurlContext{Handler: mux, RecordFile: cassetteFile, Headers: []string{"Authorization: Bearer abc"}})
+	body, _ := io.ReadAll(last.HttpResponse.Body)
+	assert.Equal(t, "got value\xff", string(body))
+	assert.Equal(t, 2, hits)
+
+	cassette, err := ReadCassette(cassetteFile)
+	assert.Nil(t, err)
+	assert.Len(t, cassette.Interactions, 2)
+	recorded := cassette.Interactions[0].Request
+	assert.Equal(t, "http://service.test/start?token=REDACTED", recorded.Url)
+	assert.Equal(t, "Bearer REDACTED", recorded.Headers.Get("Authorization"))
+	assert.Equal(t, http.StatusFound, cassette.Interactions[0].Response.Status)
+	assert.Equal(t, "got value\xff", string(cassette.Interactions[1].Response.Body), "non-text bodies survive the JSON")
+
+	// a fresh multipart boundary, and no handler: only the cassette can answer
+	last = run(&CurlContext{ReplayFile: cassetteFile})
+	assert.Nil(t, last.Error)
+	body, _ = io.ReadAll(last.HttpResponse.Body)
+	assert.Equal(t, "got value\xff", string(body))
+	assert.Equal(t, 2, hits)
+}
+
+func Test_Cassette_ReplayMatching(t *testing.T) {
+	cassetteFile := filepath.Join(t.TempDir(), "cassette.json")
+	assert.Nil(t, WriteCassette(cassetteFile, &Cassette{Interactions: []CassetteInteraction{
+		{Request: CassetteRequest{Method: "POST", Url: "http://service.test/", Body: CassetteBody("a=1")}, Response: CassetteResponse{Status: 201}},
+		{Request: CassetteRequest{Method: "POST", Url: "http://service.test/", Body: CassetteBody("a=1")}, Response: CassetteResponse{Status: 202}},
+	}}))
+
+	replay := func(match string, data string) (int, error) {
+		ctx := &CurlContext{ReplayFile: cassetteFile, ReplayMatch: match, Data_Standard: []string{data}}
+		assert.Nil(t, ctx.SetupContextForRun([]string{"http://service.test/"}))
+		client, cerr := ctx.BuildClient()
+		assert.Nil(t, cerr)
+		request, _ := ctx.BuildHttpRequest("", 0, true, true)
+		resp, err := client.Do(request)
+		if err != nil {
+			return 0, err
+		}
+		return resp.StatusCode, nil
+	}
+
+	_, err := replay("", "a=2")
+	assert.ErrorContains(t, err, "no recorded response for POST http://service.test/")
+	status, err := replay("method,url", "a=2")
+	assert.Nil(t, err)
+	assert.Equal(t, 201, status)
+
+	// each recorded response answers once, in order
+	ctx := &CurlContext{ReplayFile: cassetteFile, Data_Standard: []string{"a=1"}}
+	assert.Nil(t, ctx.SetupContextForRun([]string{"http://service.test/"}))
+	client, _ := ctx.BuildClient()
+	for _, want := range []int{201, 202} {
+		request, _ := ctx.BuildHttpRequest("", 0, true, true)
+		resp, err := client.Do(request)
+		assert.Nil(t, err)
+		assert.Equal(t, want, resp.StatusCode)
+	}
+	request, _ := ctx.BuildHttpRequest("", 0, true, true)
+	_, err = client.Do(request)
+	assert.NotNil(t, err)
+}
+
+func Test_Cassette_InvalidArgs(t *testing.T) {
+	ctx := &CurlContext{RecordFile: "a.json", ReplayFile: "b.json"}
+	assert.NotNil(t, ctx.SetupContextForRun([]string{"http://service.test/"}))
+
+	ctx = &CurlContext{ReplayMatch: "method,headers"}
+	assert.NotNil(t, ctx.SetupContextForRun([]string{"http://service.test/"}))
+
+	ctx = &CurlContext{ReplayFile: filepath.Join(t.TempDir(), "missing.json")}
+	assert.Nil(t, ctx.SetupContextForRun([]string{"http://service.test/"}))
+	_, cerr := ctx.BuildClient()
+	assert.NotNil(t, cerr)
+}
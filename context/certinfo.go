@@ -0,0 +1,117 @@
+package context
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha1" // #nosec G505 -- SHA-1 fingerprints are still what most tools display
+	"crypto/sha256"
+	"crypto/x509"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	curlerrors "github.com/cdwiegand/go-curling/errors"
+)
+
+// DumpCertificateChain describes each certificate in chain, leaf first, for --cert-info.
+func DumpCertificateChain(chain []*x509.Certificate, now time.Time) (res []string) {
+	for i, cert := range chain {
+		res = append(res, fmt.Sprintf("Certificate %d:", i))
+		res = append(res, fmt.Sprintf("  Subject: %s", cert.Subject))
+		res = append(res, fmt.Sprintf("  Issuer: %s", cert.Issuer))
+		if sans := subjectAltNames(cert); len(sans) > 0 {
+			res = append(res, fmt.Sprintf("  Subject Alt Names: %s", strings.Join(sans, ", ")))
+		}
+		res = append(res, fmt.Sprintf("  Serial: %s", colonHex(cert.SerialNumber.Bytes())))
+		res = append(res, fmt.Sprintf("  Not Before: %s", cert.NotBefore.UTC().Format(time.RFC3339)))
+		res = append(res, fmt.Sprintf("  Not After: %s (%s)", cert.NotAfter.UTC().Format(time.RFC3339), describeExpiry(cert.NotAfter, now)))
+		res = append(res, fmt.Sprintf("  Public Key: %s", describePublicKey(cert)))
+		res = append(res, fmt.Sprintf("  Signature Algorithm: %s", cert.SignatureAlgorithm))
+		sha256Sum := sha256.Sum256(cert.Raw)
+		sha1Sum := sha1.Sum(cert.Raw) // #nosec G401
+		res = append(res, fmt.Sprintf("  SHA-256 Fingerprint: %s", colonHex(sha256Sum[:])))
+		res = append(res, fmt.Sprintf("  SHA-1 Fingerprint: %s", colonHex(sha1Sum[:])))
+		res = append(res, fmt.Sprintf("  Public Key Pin: %s", PublicKeyPin(cert)))
+	}
+	return
+}
+
+func subjectAltNames(cert *x509.Certificate) (ret []string) {
+	for _, n := range cert.DNSNames {
+		ret = append(ret, "DNS:"+n)
+	}
+	for _, ip := range cert.IPAddresses {
+		ret = append(ret, "IP:"+ip.String())
+	}
+	for _, e := range cert.EmailAddresses {
+		ret = append(ret, "email:"+e)
+	}
+	for _, u := range cert.URIs {
+		ret = append(ret, "URI:"+u.String())
+	}
+	return
+}
+
+func describePublicKey(cert *x509.Certificate) string {
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA %d bits", key.N.BitLen())
+	case *ecdsa.PublicKey:
+		return fmt.Sprintf("ECDSA %s", key.Curve.Params().Name)
+	case ed25519.PublicKey:
+		return "Ed25519"
+	default:
+		return cert.PublicKeyAlgorithm.String()
+	}
+}
+
+func describeExpiry(notAfter time.Time, now time.Time) string {
+	if now.After(notAfter) {
+		return "expired"
+	}
+	return fmt.Sprintf("expires in %d days", daysUntil(notAfter, now))
+}
+
+// daysUntil counts whole days left, so a certificate expiring in 6.5 days has 6.
+func daysUntil(t time.Time, now time.Time) int {
+	return int(math.Floor(t.Sub(now).Hours() / 24))
+}
+
+func colonHex(b []byte) string {
+	parts := make([]string, len(b))
+	for i, v := range b {
+		parts[i] = fmt.Sprintf("%02X", v)
+	}
+	return strings.Join(parts, ":")
+}
+
+// CheckCertificateExpiry returns an error for each certificate in chain expiring within days (--warn-cert-expiry).
+func CheckCertificateExpiry(chain []*x509.Certificate, days int, now time.Time) (cerrs curlerrors.CurlErrorCollection) {
+	if days <= 0 {
+		return
+	}
+	deadline := now.Add(time.Duration(days) * 24 * time.Hour)
+	for _, cert := range chain {
+		if cert.NotAfter.Before(deadline) {
+			cerrs.AppendCurlError(curlerrors.NewCurlErrorFromString(curlerrors.ERROR_CERT_EXPIRING,
+				fmt.Sprintf("Certificate %s %s, on %s (--warn-cert-expiry %d)", cert.Subject, describeExpiry(cert.NotAfter, now), cert.NotAfter.UTC().Format(time.RFC3339), days)))
+		}
+	}
+	return
+}
+
+// certificatesNotYetExpiryChecked filters out certificates already warned about, as redirects often reuse a connection.
+func (ctx *CurlContext) certificatesNotYetExpiryChecked(chain []*x509.Certificate) (ret []*x509.Certificate) {
+	if ctx.expiryCheckedCerts == nil {
+		ctx.expiryCheckedCerts = make(map[string]bool)
+	}
+	for _, cert := range chain {
+		if !ctx.expiryCheckedCerts[string(cert.Raw)] {
+			ctx.expiryCheckedCerts[string(cert.Raw)] = true
+			ret = append(ret, cert)
+		}
+	}
+	return
+}
@@ -0,0 +1,94 @@
+package context
+
+import (
+	"crypto/x509"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	curlerrors "github.com/cdwiegand/go-curling/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_DumpCertificateChain(t *testing.T) {
+	ca := newTestCA(t, "cert info CA")
+	cert := ca.issue(t, "example.test", false, 10*24*time.Hour+time.Hour)
+	lines := strings.Join(DumpCertificateChain([]*x509.Certificate{cert.Leaf, ca.Cert}, time.Now()), "\n")
+
+	assert.Contains(t, lines, "Certificate 0:\n  Subject: CN=example.test\n  Issuer: CN=cert info CA")
+	assert.Contains(t, lines, "Subject Alt Names: DNS:localhost, DNS:example.test, IP:127.0.0.1")
+	assert.Contains(t, lines, "(expires in 10 days)")
+	assert.Contains(t, lines, "Public Key: ECDSA P-256")
+	assert.Contains(t, lines, "Public Key Pin: "+PublicKeyPin(cert.Leaf))
+	assert.Regexp(t, `SHA-256 Fingerprint: ([0-9A-F]{2}:){31}[0-9A-F]{2}\n`, lines)
+	assert.Contains(t, lines, "Certificate 1:\n  Subject: CN=cert info CA")
+}
+
+func Test_CheckCertificateExpiry(t *testing.T) {
+	ca := newTestCA(t, "expiry CA") // valid for 24h
+	leaf := ca.issue(t, "localhost", false, 10*24*time.Hour).Leaf
+	chain := []*x509.Certificate{leaf, ca.Cert}
+
+	cerrs := CheckCertificateExpiry(chain, 30, time.Now())
+	if assert.Len(t, cerrs.Errors, 2) {
+		assert.Equal(t, curlerrors.ERROR_CERT_EXPIRING, cerrs.Errors[0].ExitCode)
+		assert.Contains(t, cerrs.Errors[0].ErrorString, "CN=localhost expires in 9 days")
+	}
+	cerrs = CheckCertificateExpiry(chain, 5, time.Now())
+	assert.Len(t, cerrs.Errors, 1) // just the CA
+	assert.Empty(t, CheckCertificateExpiry(chain, 0, time.Now()).Errors)
+}
+
+func Test_CertInfoAndExpiry_Run(t *testing.T) {
+	ca := newTestCA(t, "expiry CA")
+	srv := newTestTLSServer(t, ca.issue(t, "localhost", false, 48*time.Hour), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/start" {
+			http.Redirect(w, r, "/dest", http.StatusFound)
+			return
+		}
+		w.Write([]byte("body"))
+	}), nil)
+	dir := t.TempDir()
+	stderr := filepath.Join(dir, "stderr")
+	ctx := &CurlContext{IgnoreBadCerts: true, FollowRedirects: true, CertInfo: true, WarnCertExpiryDays: 7, ErrorOutput: stderr, BodyOutput: []string{filepath.Join(dir, "body")}}
+	client, cerr := ctx.BuildClient()
+	assert.Nil(t, cerr)
+	request, cerr := ctx.BuildHttpRequest(srv.URL+"/start", 0, true, true)
+	assert.Nil(t, cerr)
+	resp, cerr := ctx.GetCompleteResponse(0, client, request)
+	assert.Nil(t, cerr)
+	// leaf and CA both expire within a week, each reported once despite the redirect, and before any output
+	if assert.Len(t, resp.Warnings.Errors, 2) {
+		assert.Equal(t, curlerrors.ERROR_CERT_EXPIRING, resp.Warnings.Errors[0].ExitCode)
+	}
+
+	cerrs := ctx.ProcessResponseToOutputs(0, resp, request)
+	if assert.Len(t, cerrs.Errors, 2) {
+		assert.Equal(t, curlerrors.ERROR_CERT_EXPIRING, cerrs.Errors[0].ExitCode)
+	}
+	info, _ := os.ReadFile(stderr)
+	assert.Contains(t, string(info), "Subject: CN=localhost")
+	body, _ := os.ReadFile(filepath.Join(dir, "body"))
+	assert.Equal(t, "body", string(body))
+}
+
+func Test_CertInfo_Silent(t *testing.T) {
+	ca := newTestCA(t, "silent CA")
+	srv := newTestTLSServer(t, ca.issue(t, "localhost", false, 48*time.Hour), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), nil)
+	dir := t.TempDir()
+	stderr := filepath.Join(dir, "stderr")
+	ctx := &CurlContext{IgnoreBadCerts: true, CertInfo: true, IsSilent: true, ErrorOutput: stderr, BodyOutput: []string{filepath.Join(dir, "body")}}
+	client, cerr := ctx.BuildClient()
+	assert.Nil(t, cerr)
+	request, cerr := ctx.BuildHttpRequest(srv.URL, 0, true, true)
+	assert.Nil(t, cerr)
+	resp, cerr := ctx.GetCompleteResponse(0, client, request)
+	assert.Nil(t, cerr)
+
+	assert.Empty(t, ctx.ProcessResponseToOutputs(0, resp, request).Errors)
+	info, _ := os.ReadFile(stderr)
+	assert.Empty(t, string(info))
+}
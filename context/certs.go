@@ -2,11 +2,12 @@ package context
 
 import (
 	"crypto"
-	"crypto/ecdsa"
-	"crypto/rsa"
 	"crypto/tls"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -16,53 +17,267 @@ import (
 	pkcs8 "github.com/youmark/pkcs8"
 )
 
+const (
+	CERT_TYPE_PEM = "PEM"
+	CERT_TYPE_DER = "DER"
+	CERT_TYPE_P12 = "P12"
+)
+
+// BuildClientCertificates loads every --cert (each a file, or a directory of them) into a tls.Certificate
+// holding the private key, the leaf certificate first and then any intermediates found alongside it.
+// Any problem loading an explicitly named file is an error: carrying on without the certificate would
+// only fail later, less clearly, at the server.
 func (ctx *CurlContext) BuildClientCertificates() ([]tls.Certificate, *curlerrors.CurlError) {
-	var pemBlocks []pem.Block
+	if len(ctx.ClientCertFile) == 0 && ctx.ClientCertKeyFile == "" {
+		return nil, nil
+	}
+	if len(ctx.ClientCertFile) == 0 {
+		return nil, curlerrors.NewCurlErrorFromString(curlerrors.ERROR_SSL_CLIENT_CERTIFICATE, "--key requires a client certificate from --cert")
+	}
 
-	if ctx.ClientCertFile != "" {
-		if strings.Contains(ctx.ClientCertFile, ":") {
-			parts := strings.SplitN(ctx.ClientCertFile, ":", 2)
-			ctx.ClientCertFile = parts[0]
-			ctx.ClientCertKeyPassword = parts[1]
+	// --key is for certificates that don't carry their own key
+	var sharedKey crypto.PrivateKey
+	if ctx.ClientCertKeyFile != "" {
+		keyFile, keyPassword := splitCertPassword(ctx.ClientCertKeyFile)
+		if keyPassword == "" {
+			keyPassword = ctx.ClientCertKeyPassword
 		}
-		pemBytes, error := os.ReadFile(ctx.ClientCertFile)
-		if error != nil && ctx.FailEarly {
-			return nil, curlerrors.NewCurlErrorFromStringAndError(curlerrors.ERROR_CANNOT_READ_FILE, fmt.Sprintf("Failed to open file %s", ctx.ClientCertFile), error)
+		if keyPassword == "" && len(ctx.ClientCertFile) == 1 {
+			_, keyPassword = splitCertPassword(ctx.ClientCertFile[0])
+		}
+		var cerr *curlerrors.CurlError
+		sharedKey, cerr = ctx.loadClientKey(keyFile, keyPassword)
+		if cerr != nil {
+			return nil, cerr
 		}
-		pemBlocks = append(pemBlocks, extractPemBlocks(pemBytes, true)...)
 	}
 
-	if ctx.ClientCertKeyFile != "" {
-		if strings.Contains(ctx.ClientCertKeyFile, ":") {
-			parts := strings.SplitN(ctx.ClientCertKeyFile, ":", 2)
-			ctx.ClientCertKeyFile = parts[0]
-			ctx.ClientCertKeyPassword = parts[1]
+	ret := []tls.Certificate{}
+	for _, value := range ctx.ClientCertFile {
+		file, password := splitCertPassword(value)
+		if password == "" {
+			password = ctx.ClientCertKeyPassword
 		}
-		pemBytes, error := os.ReadFile(ctx.ClientCertKeyFile)
-		if error != nil && ctx.FailEarly {
-			return nil, curlerrors.NewCurlErrorFromStringAndError(curlerrors.ERROR_CANNOT_READ_FILE, fmt.Sprintf("Failed to open file %s", ctx.ClientCertKeyFile), error)
+		if info, err := os.Stat(file); err == nil && info.IsDir() {
+			certs, cerr := ctx.loadClientCertificateDirectory(file, password, sharedKey)
+			if cerr != nil {
+				return nil, cerr
+			}
+			ret = append(ret, certs...)
+			continue
 		}
-		pemBlocks = append(pemBlocks, extractPemBlocks(pemBytes, true)...)
+		certType, cerr := getCertType(ctx.ClientCertType, file, "--cert-type")
+		if cerr != nil {
+			return nil, cerr
+		}
+		cert, cerr := loadClientCertificate(file, certType, password, sharedKey)
+		if cerr != nil {
+			return nil, cerr
+		}
+		ret = append(ret, cert)
 	}
+	return ret, nil
+}
 
-	ret := []tls.Certificate{}
-	if pemBlocks != nil {
+func (ctx *CurlContext) loadClientKey(keyFile string, password string) (crypto.PrivateKey, *curlerrors.CurlError) {
+	keyType, cerr := getCertType(ctx.ClientCertKeyType, keyFile, "--key-type")
+	if cerr != nil {
+		return nil, cerr
+	}
+	data, err := os.ReadFile(keyFile) // #nosec G304
+	if err != nil {
+		return nil, curlerrors.NewCurlErrorFromStringAndError(curlerrors.ERROR_CANNOT_READ_FILE, fmt.Sprintf("Failed to open file %s", keyFile), err)
+	}
+	var key crypto.PrivateKey
+	var keyErr error
+	switch keyType {
+	case CERT_TYPE_DER:
+		key, keyErr = parsePrivateKeyDerWithPassword(data, password)
+	case CERT_TYPE_P12:
+		return nil, curlerrors.NewCurlErrorFromString(curlerrors.ERROR_INVALID_ARGS, "--key-type must be PEM or DER")
+	default:
+		_, key, keyErr = parsePemCertsAndKey(data, password)
+		if keyErr == nil && key == nil {
+			keyErr = fmt.Errorf("no PEM private key found")
+		}
+	}
+	if keyErr != nil {
+		return nil, curlerrors.NewCurlErrorFromStringAndError(curlerrors.ERROR_SSL_CLIENT_CERTIFICATE, fmt.Sprintf("Unable to load private key from %s", keyFile), keyErr)
+	}
+	return key, nil
+}
+
+// loadClientCertificate loads one certificate file, using sharedKey (from --key) if the file has no key of its own.
+func loadClientCertificate(certFile string, certType string, password string, sharedKey crypto.PrivateKey) (tls.Certificate, *curlerrors.CurlError) {
+	var key crypto.PrivateKey
+	var certs []*x509.Certificate
+
+	data, err := os.ReadFile(certFile) // #nosec G304
+	if err != nil {
+		return tls.Certificate{}, curlerrors.NewCurlErrorFromStringAndError(curlerrors.ERROR_CANNOT_READ_FILE, fmt.Sprintf("Failed to open file %s", certFile), err)
+	}
+	switch certType {
+	case CERT_TYPE_P12:
+		key, certs, err = DecodePkcs12(data, password)
+		if err != nil {
+			return tls.Certificate{}, curlerrors.NewCurlErrorFromStringAndError(curlerrors.ERROR_SSL_CLIENT_CERTIFICATE, fmt.Sprintf("Unable to load PKCS#12 file %s", certFile), err)
+		}
+	case CERT_TYPE_DER:
+		cert, err := x509.ParseCertificate(data)
+		if err != nil {
+			return tls.Certificate{}, curlerrors.NewCurlErrorFromStringAndError(curlerrors.ERROR_SSL_CLIENT_CERTIFICATE, fmt.Sprintf("Unable to parse DER certificate %s", certFile), err)
+		}
+		certs = append(certs, cert)
+	default:
 		var keyErr error
-		var cert tls.Certificate
-		for _, h := range pemBlocks {
-			cert.PrivateKey, keyErr = convertPrivateKeyBlock(h, ctx.ClientCertKeyPassword)
-			if keyErr != nil && ctx.FailEarly {
-				return nil, curlerrors.NewCurlErrorFromStringAndError(curlerrors.ERROR_SSL_SYSTEM_FAILURE, "Unable to decrypt private key", keyErr)
+		certs, key, keyErr = parsePemCertsAndKey(data, password)
+		// a key error only matters if the key isn't coming from --key instead
+		if keyErr != nil && sharedKey == nil {
+			return tls.Certificate{}, curlerrors.NewCurlErrorFromStringAndError(curlerrors.ERROR_SSL_CLIENT_CERTIFICATE, fmt.Sprintf("Unable to load private key from %s", certFile), keyErr)
+		}
+		if len(certs) == 0 {
+			return tls.Certificate{}, curlerrors.NewCurlErrorFromString(curlerrors.ERROR_SSL_CLIENT_CERTIFICATE, fmt.Sprintf("No PEM certificate found in %s", certFile))
+		}
+	}
+
+	if key == nil {
+		key = sharedKey
+	}
+	if key == nil {
+		return tls.Certificate{}, curlerrors.NewCurlErrorFromString(curlerrors.ERROR_SSL_CLIENT_CERTIFICATE, fmt.Sprintf("No private key found for client certificate %s, use --key", certFile))
+	}
+	cert, err := buildCertificateChain(key, certs)
+	if err != nil {
+		return tls.Certificate{}, curlerrors.NewCurlErrorFromStringAndError(curlerrors.ERROR_SSL_CLIENT_CERTIFICATE, fmt.Sprintf("Unable to use client certificate %s", certFile), err)
+	}
+	return cert, nil
+}
+
+// loadClientCertificateDirectory loads each .p12/.pfx and .pem/.crt/.cer file in dir (not recursively);
+// PEM certificates without a key use NAME.key beside them, or --key. Files that can't be used are
+// skipped (and noted in verbose output), as a directory is expected to hold other things too.
+func (ctx *CurlContext) loadClientCertificateDirectory(dir string, password string, sharedKey crypto.PrivateKey) ([]tls.Certificate, *curlerrors.CurlError) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, curlerrors.NewCurlErrorFromStringAndError(curlerrors.ERROR_CANNOT_READ_FILE, fmt.Sprintf("Failed to open client certificate directory %s", dir), err)
+	}
+	var ret []tls.Certificate
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		file := filepath.Join(dir, entry.Name())
+		var certType string
+		switch strings.ToLower(filepath.Ext(file)) {
+		case ".p12", ".pfx":
+			certType = CERT_TYPE_P12
+		case ".pem", ".crt", ".cer":
+			certType = CERT_TYPE_PEM
+		default:
+			continue
+		}
+		key := sharedKey
+		keyFile := strings.TrimSuffix(file, filepath.Ext(file)) + ".key"
+		if _, err := os.Stat(keyFile); err == nil && certType == CERT_TYPE_PEM {
+			data, err := os.ReadFile(keyFile) // #nosec G304
+			if err == nil {
+				if _, siblingKey, keyErr := parsePemCertsAndKey(data, password); keyErr == nil && siblingKey != nil {
+					key = siblingKey
+				}
 			}
-			if cert.PrivateKey != nil {
-				ret = append(ret, cert)
+		}
+		cert, cerr := loadClientCertificate(file, certType, password, key)
+		if cerr != nil {
+			ctx.tlsNotes.add(fmt.Sprintf("Skipped client certificate: %s", cerr.ErrorString))
+			continue
+		}
+		ret = append(ret, cert)
+	}
+	if len(ret) == 0 {
+		return nil, curlerrors.NewCurlErrorFromString(curlerrors.ERROR_SSL_CLIENT_CERTIFICATE, fmt.Sprintf("No usable client certificates found in %s", dir))
+	}
+	return ret, nil
+}
+
+// getCertType validates --cert-type/--key-type, defaulting to P12 for .p12/.pfx files and PEM otherwise.
+func getCertType(value string, file string, flagName string) (string, *curlerrors.CurlError) {
+	switch strings.ToUpper(value) {
+	case "":
+		ext := strings.ToLower(filepath.Ext(file))
+		if ext == ".p12" || ext == ".pfx" {
+			return CERT_TYPE_P12, nil
+		}
+		return CERT_TYPE_PEM, nil
+	case CERT_TYPE_PEM:
+		return CERT_TYPE_PEM, nil
+	case CERT_TYPE_DER:
+		return CERT_TYPE_DER, nil
+	case CERT_TYPE_P12, "PKCS12", "PFX":
+		return CERT_TYPE_P12, nil
+	default:
+		return "", curlerrors.NewCurlErrorFromString(curlerrors.ERROR_INVALID_ARGS, fmt.Sprintf("%s %s is not supported, must be PEM, DER or P12", flagName, value))
+	}
+}
+
+// splitCertPassword splits curl's "file:password" form, leaving Windows drive letters (C:\...) alone.
+func splitCertPassword(value string) (string, string) {
+	searchFrom := 0
+	if len(value) > 2 && value[1] == ':' && (value[2] == '\\' || value[2] == '/') {
+		searchFrom = 2
+	}
+	if idx := strings.Index(value[searchFrom:], ":"); idx >= 0 {
+		return value[:searchFrom+idx], value[searchFrom+idx+1:]
+	}
+	return value, ""
+}
+
+func parsePemCertsAndKey(data []byte, password string) (certs []*x509.Certificate, key crypto.PrivateKey, keyErr error) {
+	for _, block := range extractPemBlocks(data, false) {
+		switch {
+		case block.Type == "CERTIFICATE":
+			if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+				certs = append(certs, cert)
 			}
+		case strings.Contains(block.Type, "PRIVATE"):
+			parsed, err := convertPrivateKeyBlock(block, password)
+			if err != nil {
+				keyErr = err
+				continue
+			}
+			key = parsed
 		}
 	}
+	return
+}
 
+// buildCertificateChain puts the certificate matching key first, followed by the rest in file order.
+func buildCertificateChain(key crypto.PrivateKey, certs []*x509.Certificate) (tls.Certificate, error) {
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return tls.Certificate{}, fmt.Errorf("unsupported private key type %T", key)
+	}
+	public, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok {
+		return tls.Certificate{}, fmt.Errorf("unsupported public key type %T", signer.Public())
+	}
+	ret := tls.Certificate{PrivateKey: key}
+	for _, c := range certs {
+		if ret.Leaf == nil && public.Equal(c.PublicKey) {
+			ret.Leaf = c
+			ret.Certificate = append([][]byte{c.Raw}, ret.Certificate...)
+		} else {
+			ret.Certificate = append(ret.Certificate, c.Raw)
+		}
+	}
+	if ret.Leaf == nil {
+		return tls.Certificate{}, fmt.Errorf("private key does not match any certificate given")
+	}
 	return ret, nil
 }
 
+// BuildRootCAsPool returns the CAs servers are verified against: the host's (unless --no-ca-native), plus the
+// --cacert files and the --capath directory. Without either, CURL_CA_BUNDLE is used as --cacert, or failing
+// that SSL_CERT_FILE and SSL_CERT_DIR, as curl does. How many certificates each added is noted for -v.
 func (ctx *CurlContext) BuildRootCAsPool() (*x509.CertPool, *curlerrors.CurlError) {
 	var err error
 	var pool *x509.CertPool
@@ -74,70 +289,278 @@ func (ctx *CurlContext) BuildRootCAsPool() (*x509.CertPool, *curlerrors.CurlErro
 		if err != nil && ctx.FailEarly {
 			return nil, curlerrors.NewCurlErrorFromStringAndError(curlerrors.ERROR_SSL_SYSTEM_FAILURE, "Failed to load system CA", err)
 		}
+		if pool == nil {
+			pool = x509.NewCertPool()
+		}
 	}
 
-	caCertFiles := []string{}
-	if ctx.CaCertFile != nil {
-		caCertFiles = ctx.CaCertFile
+	caFiles, caPaths, required := ctx.getCaLocations()
+	seen := make(map[string]bool) // c_rehash directories hold each certificate twice, as the file and a <hash>.N link
+	for _, file := range caFiles {
+		count, err := appendCaFile(pool, file, seen)
+		if err != nil {
+			if !required {
+				ctx.tlsNotes.add(fmt.Sprintf("Skipped CAfile %s: %v", file, err))
+				continue
+			}
+			return nil, curlerrors.NewCurlErrorFromStringAndError(curlerrors.ERROR_SSL_CACERT_BADFILE, fmt.Sprintf("Failed to load CA cert file %s", file), err)
+		}
+		ctx.tlsNotes.add(fmt.Sprintf("CAfile: %s (%d certificates)", file, count))
 	}
-	if ctx.CaCertPath != "" {
-		// pool = x509.NewCertPool()
-		error := filepath.Walk(ctx.CaCertPath, func(path string, info os.FileInfo, err error) error {
-			if !info.IsDir() {
-				caCertFiles = append(caCertFiles, path)
+	for _, dir := range caPaths {
+		count, skipped, err := appendCaPath(pool, dir, seen)
+		if err != nil {
+			if !required {
+				ctx.tlsNotes.add(fmt.Sprintf("Skipped CApath %s: %v", dir, err))
+				continue
 			}
-			return nil
-		})
-		if error != nil && ctx.FailEarly {
-			return nil, curlerrors.NewCurlErrorFromStringAndError(curlerrors.ERROR_CANNOT_READ_FILE, fmt.Sprintf("Failed to open CA cert path %s", ctx.CaCertPath), error)
+			return nil, curlerrors.NewCurlErrorFromStringAndError(curlerrors.ERROR_SSL_CACERT_BADFILE, fmt.Sprintf("Failed to open CA cert path %s", dir), err)
+		}
+		ctx.tlsNotes.add(fmt.Sprintf("CApath: %s (%d certificates, %d files skipped)", dir, count, skipped))
+	}
+	return pool, nil
+}
+
+// getCaLocations returns the CA files and directories to load, and whether failing to load them is an error:
+// it is for --cacert/--capath and CURL_CA_BUNDLE, but not for SSL_CERT_FILE/SSL_CERT_DIR, which (like Go's
+// own system pool) are only defaults.
+func (ctx *CurlContext) getCaLocations() (files []string, dirs []string, required bool) {
+	if len(ctx.CaCertFile) > 0 || ctx.CaCertPath != "" {
+		if ctx.CaCertPath != "" {
+			dirs = []string{ctx.CaCertPath}
 		}
+		return ctx.CaCertFile, dirs, true
+	}
+	if bundle := os.Getenv("CURL_CA_BUNDLE"); bundle != "" {
+		return []string{bundle}, nil, true
+	}
+	if file := os.Getenv("SSL_CERT_FILE"); file != "" {
+		files = []string{file}
 	}
+	if dir := os.Getenv("SSL_CERT_DIR"); dir != "" {
+		dirs = filepath.SplitList(dir)
+	}
+	return files, dirs, false
+}
 
-	for _, h := range ctx.CaCertFile {
-		caBytes, error := os.ReadFile(h) // #nosec G304
-		if error != nil && ctx.FailEarly {
-			return nil, curlerrors.NewCurlErrorFromStringAndError(curlerrors.ERROR_CANNOT_READ_FILE, fmt.Sprintf("Failed to open file %s", h), error)
+// appendCaFile adds the PEM certificates in file to pool, returning how many were new.
+func appendCaFile(pool *x509.CertPool, file string, seen map[string]bool) (int, error) {
+	data, err := os.ReadFile(file) // #nosec G304
+	if err != nil {
+		return 0, err
+	}
+	certs, err := parsePemCertificates(data)
+	if err != nil {
+		return 0, err
+	}
+	if len(certs) == 0 {
+		return 0, fmt.Errorf("no PEM certificates found")
+	}
+	return addNewCerts(pool, certs, seen), nil
+}
+
+// appendCaPath adds the PEM certificates in each file of dir (not its subdirectories, like OpenSSL), following
+// symlinks such as c_rehash's <hash>.N. Files holding no certificate (keys, CRLs, DER, broken links) are skipped.
+func appendCaPath(pool *x509.CertPool, dir string, seen map[string]bool) (count int, skipped int, err error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
 		}
-		pool.AppendCertsFromPEM(caBytes)
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name())) // #nosec G304
+		if err != nil {
+			skipped++ // a broken link, or one to a directory
+			continue
+		}
+		certs, err := parsePemCertificates(data)
+		if err != nil || len(certs) == 0 {
+			skipped++
+			continue
+		}
+		count += addNewCerts(pool, certs, seen)
 	}
-	return pool, nil
+	return count, skipped, nil
+}
+
+func parsePemCertificates(data []byte) (ret []*x509.Certificate, err error) {
+	for _, block := range extractPemBlocks(data, false) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, cert)
+	}
+	return
 }
 
-func convertPrivateKeyBlock(pem pem.Block, ClientCertKeyPassword string) (crypto.PrivateKey, error) {
-	if key, err := x509.ParsePKCS1PrivateKey(pem.Bytes); err == nil {
-		return key, err
+func addNewCerts(pool *x509.CertPool, certs []*x509.Certificate, seen map[string]bool) (added int) {
+	for _, cert := range certs {
+		if !seen[string(cert.Raw)] {
+			seen[string(cert.Raw)] = true
+			pool.AddCert(cert)
+			added++
+		}
 	}
-	if key, err := x509.ParsePKCS8PrivateKey(pem.Bytes); err == nil {
-		if strings.Contains(pem.Type, "ENCRYPTED") {
-			switch keyType := key.(type) {
-			case *rsa.PrivateKey, *ecdsa.PrivateKey:
-				decrypted, _, err := pkcs8.ParsePrivateKey(pem.Bytes, []byte(ClientCertKeyPassword))
-				if err != nil {
-					return nil, err
-				}
-				return decrypted, nil
-			default:
-				return nil, fmt.Errorf("unable to decrypt %s %s private key", pem.Type, keyType)
-			}
+	return
+}
+
+// convertPrivateKeyBlock parses any PEM private key block go-curling understands: PKCS#1, SEC 1 (EC) and
+// PKCS#8 keys (RSA, ECDSA or Ed25519), each optionally encrypted, either as PKCS#8 "ENCRYPTED PRIVATE KEY"
+// or with OpenSSL's legacy "Proc-Type: 4,ENCRYPTED" / DEK-Info headers. Errors name the kind of key.
+func convertPrivateKeyBlock(block pem.Block, ClientCertKeyPassword string) (crypto.PrivateKey, error) {
+	der := block.Bytes
+	if block.Headers["Proc-Type"] == "4,ENCRYPTED" {
+		if ClientCertKeyPassword == "" {
+			return nil, fmt.Errorf("%s is encrypted (%s), a password is required (--key-password or :password after the file name)", describeKeyBlock(block), block.Headers["DEK-Info"])
+		}
+		var err error
+		der, err = x509.DecryptPEMBlock(&block, []byte(ClientCertKeyPassword)) //nolint:staticcheck // only way to read these keys
+		if errors.Is(err, x509.IncorrectPasswordError) {
+			err = ErrIncorrectKeyPassword
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to decrypt %s (%s): %w", describeKeyBlock(block), block.Headers["DEK-Info"], err)
 		}
-		return key, err
+	} else if block.Type == "ENCRYPTED PRIVATE KEY" {
+		if ClientCertKeyPassword == "" {
+			return nil, fmt.Errorf("%s is encrypted, a password is required (--key-password or :password after the file name)", describeKeyBlock(block))
+		}
+		var err error
+		der, err = decryptPkcs8(block.Bytes, ClientCertKeyPassword)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decrypt %s: %w", describeKeyBlock(block), err)
+		}
+		block.Type = "PRIVATE KEY"
 	}
-	if key, err := x509.ParseECPrivateKey(pem.Bytes); err == nil {
-		return key, err
+
+	var key crypto.PrivateKey
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(der)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(der)
+	default:
+		key, err = parsePrivateKeyDer(der)
 	}
-	return nil, fmt.Errorf("no valid private key found")
+	if err != nil {
+		if algorithm := pkcs8KeyAlgorithm(der); algorithm != "" {
+			return nil, fmt.Errorf("invalid %s (%s): %w", describeKeyBlock(block), algorithm, err)
+		}
+		return nil, fmt.Errorf("invalid %s: %w", describeKeyBlock(block), err)
+	}
+	if _, ok := key.(crypto.Signer); !ok {
+		return nil, fmt.Errorf("%s holds a %s key, which cannot sign so cannot be used for TLS client authentication", describeKeyBlock(block), pkcs8KeyAlgorithm(der))
+	}
+	return key, nil
+}
+
+// decryptPkcs8 decrypts a PBES2 (PBKDF2 or scrypt, with AES or 3DES) encrypted PKCS#8 key, returning it unencrypted.
+func decryptPkcs8(der []byte, password string) ([]byte, error) {
+	key, _, err := pkcs8.ParsePrivateKey(der, []byte(password))
+	if err != nil {
+		if err.Error() == "pkcs8: incorrect password" { // not exported as a variable to compare with
+			return nil, ErrIncorrectKeyPassword
+		}
+		return nil, err
+	}
+	return x509.MarshalPKCS8PrivateKey(key)
+}
+
+// ErrIncorrectKeyPassword is returned when an encrypted private key can't be decrypted with the password given.
+var ErrIncorrectKeyPassword = errors.New("incorrect password")
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+func describeKeyBlock(block pem.Block) string {
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return "PKCS#1 RSA private key"
+	case "EC PRIVATE KEY":
+		return "SEC 1 EC private key"
+	case "PRIVATE KEY":
+		return "PKCS#8 private key"
+	case "ENCRYPTED PRIVATE KEY":
+		return "encrypted PKCS#8 private key"
+	default:
+		return block.Type
+	}
+}
+
+var pkcs8KeyAlgorithmNames = []struct {
+	oid  asn1.ObjectIdentifier
+	name string
+}{
+	{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}, "RSA"},
+	{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 10}, "RSA-PSS"},
+	{asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}, "ECDSA"},
+	{asn1.ObjectIdentifier{1, 2, 840, 10040, 4, 1}, "DSA"},
+	{asn1.ObjectIdentifier{1, 3, 101, 110}, "X25519"},
+	{asn1.ObjectIdentifier{1, 3, 101, 111}, "X448"},
+	{asn1.ObjectIdentifier{1, 3, 101, 112}, "Ed25519"},
+	{asn1.ObjectIdentifier{1, 3, 101, 113}, "Ed448"},
+}
+
+// pkcs8KeyAlgorithm names the algorithm of a PKCS#8 key, so errors can say which kind of key was refused.
+func pkcs8KeyAlgorithm(der []byte) string {
+	var info struct {
+		Version    int
+		Algorithm  pkix.AlgorithmIdentifier
+		PrivateKey []byte
+	}
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return ""
+	}
+	for _, a := range pkcs8KeyAlgorithmNames {
+		if a.oid.Equal(info.Algorithm.Algorithm) {
+			return a.name
+		}
+	}
+	return info.Algorithm.Algorithm.String()
+}
+
+// parsePrivateKeyDer tries each unencrypted DER private key encoding in turn.
+func parsePrivateKeyDer(der []byte) (crypto.PrivateKey, error) {
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("not a PKCS#8, PKCS#1 or SEC 1 private key")
+}
+
+// parsePrivateKeyDerWithPassword is parsePrivateKeyDer, falling back to encrypted PKCS#8 for --key-type DER.
+func parsePrivateKeyDerWithPassword(der []byte, password string) (crypto.PrivateKey, error) {
+	block := pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	var epki encryptedPrivateKeyInfo
+	if rest, err := asn1.Unmarshal(der, &epki); err == nil && len(rest) == 0 && len(epki.Algorithm.Algorithm) > 0 {
+		block.Type = "ENCRYPTED PRIVATE KEY"
+	}
+	return convertPrivateKeyBlock(block, password)
 }
 
 func extractPemBlocks(b []byte, onlyPrivateKeys bool) (ret []pem.Block) {
-	for ok := true; ok; {
-		pemBlock, _ := pem.Decode(b)
-		if pemBlock != nil {
-			if !onlyPrivateKeys || strings.Contains(pemBlock.Type, "PRIVATE") {
-				ret = append(ret, *pemBlock)
-			}
-		} else {
-			ok = false
+	for {
+		pemBlock, rest := pem.Decode(b)
+		if pemBlock == nil {
+			return
 		}
+		if !onlyPrivateKeys || strings.Contains(pemBlock.Type, "PRIVATE") {
+			ret = append(ret, *pemBlock)
+		}
+		b = rest
 	}
-	return
 }
@@ -1,8 +1,18 @@
 package context
 
 import (
+	"crypto/ed25519"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	curlerrors "github.com/cdwiegand/go-curling/errors"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -18,3 +28,240 @@ func TestBuildRootCAsPool(t *testing.T) {
 	assert.Nil(t, cerr)
 	assert.NotNil(t, result)
 }
+
+// newHashedCaDir lays out a CA directory the way c_rehash does: the certificate plus a <hash>.0 link to it,
+// alongside files that aren't certificates at all.
+func newHashedCaDir(t *testing.T, ca *testCA) string {
+	t.Helper()
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "test-ca.pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Cert.Raw}), 0600)
+	os.Symlink("test-ca.pem", filepath.Join(dir, "1a2b3c4d.0"))
+	os.Symlink("missing.pem", filepath.Join(dir, "5e6f7a8b.0"))
+	os.WriteFile(filepath.Join(dir, "README"), []byte("not a certificate"), 0600)
+	os.WriteFile(filepath.Join(dir, "ca.der"), ca.Cert.Raw, 0600)
+	os.Mkdir(filepath.Join(dir, "nested"), 0700)
+	return dir
+}
+
+func Test_BuildRootCAsPool_CaPath(t *testing.T) {
+	ca := newTestCA(t, "CApath CA")
+	dir := newHashedCaDir(t, ca)
+	srv := newTestTLSServer(t, ca.issue(t, "localhost", false, time.Hour), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), nil)
+
+	ctx := &CurlContext{CaCertPath: dir, DoNotUseHostCertificateAuthorities: true, tlsNotes: &tlsNotes{}}
+	pool, cerr := ctx.BuildRootCAsPool()
+	assert.Nil(t, cerr)
+	_, err := ca.issue(t, "localhost", false, time.Hour).Leaf.Verify(x509.VerifyOptions{Roots: pool})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"CApath: " + dir + " (1 certificates, 3 files skipped)"}, ctx.tlsNotes.drain())
+
+	assert.Nil(t, pinnedRequest(t, &CurlContext{CaCertPath: dir, DoNotUseHostCertificateAuthorities: true}, srv.URL))
+	assert.NotNil(t, pinnedRequest(t, &CurlContext{DoNotUseHostCertificateAuthorities: true}, srv.URL))
+
+	_, cerr = (&CurlContext{CaCertPath: filepath.Join(dir, "missing")}).BuildRootCAsPool()
+	assert.Equal(t, curlerrors.ERROR_SSL_CACERT_BADFILE, cerr.ExitCode)
+}
+
+func Test_BuildRootCAsPool_CaCert(t *testing.T) {
+	ca := newTestCA(t, "CAfile CA")
+	caFile := ca.writeCert(t)
+	ctx := &CurlContext{CaCertFile: []string{caFile, caFile}, tlsNotes: &tlsNotes{}}
+	_, cerr := ctx.BuildRootCAsPool()
+	assert.Nil(t, cerr)
+	assert.Equal(t, []string{"CAfile: " + caFile + " (1 certificates)", "CAfile: " + caFile + " (0 certificates)"}, ctx.tlsNotes.drain())
+
+	_, cerr = (&CurlContext{CaCertFile: []string{filepath.Join(t.TempDir(), "missing.pem")}}).BuildRootCAsPool()
+	assert.Equal(t, curlerrors.ERROR_SSL_CACERT_BADFILE, cerr.ExitCode)
+	_, cerr = (&CurlContext{CaCertFile: []string{"testdata/client.key"}}).BuildRootCAsPool()
+	assert.Equal(t, curlerrors.ERROR_SSL_CACERT_BADFILE, cerr.ExitCode)
+}
+
+func Test_BuildRootCAsPool_Environment(t *testing.T) {
+	ca := newTestCA(t, "Environment CA")
+	caFile := ca.writeCert(t)
+	dir := newHashedCaDir(t, ca)
+	notes := func(ctx *CurlContext) string {
+		ctx.tlsNotes = &tlsNotes{}
+		_, cerr := ctx.BuildRootCAsPool()
+		assert.Nil(t, cerr)
+		return strings.Join(ctx.tlsNotes.drain(), "\n")
+	}
+
+	t.Setenv("CURL_CA_BUNDLE", "")
+	t.Setenv("SSL_CERT_FILE", caFile)
+	t.Setenv("SSL_CERT_DIR", dir+string(os.PathListSeparator)+filepath.Join(dir, "missing"))
+	res := notes(&CurlContext{DoNotUseHostCertificateAuthorities: true})
+	assert.Contains(t, res, "CAfile: "+caFile)
+	assert.Contains(t, res, "CApath: "+dir)
+	assert.Contains(t, res, "Skipped CApath "+filepath.Join(dir, "missing")) // only a default, so not an error
+
+	t.Setenv("CURL_CA_BUNDLE", caFile)
+	assert.Equal(t, "CAfile: "+caFile+" (1 certificates)", notes(&CurlContext{DoNotUseHostCertificateAuthorities: true}))
+
+	// --cacert/--capath win over the environment
+	assert.Equal(t, "CApath: "+dir+" (1 certificates, 3 files skipped)", notes(&CurlContext{CaCertPath: dir, DoNotUseHostCertificateAuthorities: true}))
+
+	t.Setenv("CURL_CA_BUNDLE", filepath.Join(dir, "missing.pem"))
+	_, cerr := (&CurlContext{}).BuildRootCAsPool()
+	assert.Equal(t, curlerrors.ERROR_SSL_CACERT_BADFILE, cerr.ExitCode)
+}
+
+func Test_BuildClientCertificates(t *testing.T) {
+	cases := []struct {
+		ctx   CurlContext
+		chain int
+	}{
+		{CurlContext{ClientCertFile: []string{"testdata/client-chain-with-key.pem"}}, 2},
+		{CurlContext{ClientCertFile: []string{"testdata/client.pem"}, ClientCertKeyFile: "testdata/client.key"}, 1},
+		{CurlContext{ClientCertFile: []string{"testdata/client.der"}, ClientCertType: "DER", ClientCertKeyFile: "testdata/client.key.der", ClientCertKeyType: "der"}, 1},
+		{CurlContext{ClientCertFile: []string{"testdata/client.p12:secret"}}, 2},
+		{CurlContext{ClientCertFile: []string{"testdata/client-3des.pfx"}, ClientCertKeyPassword: "secret"}, 2},
+		{CurlContext{ClientCertFile: []string{"testdata/client-legacy.p12:secret"}, ClientCertType: "P12"}, 2},
+	}
+	for _, c := range cases {
+		c.ctx.FailEarly = true
+		certs, cerr := c.ctx.BuildClientCertificates()
+		assert.Nil(t, cerr, c.ctx.ClientCertFile)
+		if assert.Len(t, certs, 1, c.ctx.ClientCertFile) {
+			assert.Equal(t, "go-curling test client", certs[0].Leaf.Subject.CommonName)
+			assert.NotNil(t, certs[0].PrivateKey)
+			assert.Len(t, certs[0].Certificate, c.chain, c.ctx.ClientCertFile)
+		}
+	}
+}
+
+func Test_BuildClientCertificates_Errors(t *testing.T) {
+	ctx := &CurlContext{FailEarly: true, ClientCertFile: []string{"testdata/client.p12:wrong"}}
+	_, cerr := ctx.BuildClientCertificates()
+	assert.NotNil(t, cerr)
+
+	ctx = &CurlContext{FailEarly: true, ClientCertFile: []string{"testdata/client.pem"}, ClientCertType: "ENG"}
+	_, cerr = ctx.BuildClientCertificates()
+	if assert.NotNil(t, cerr) {
+		assert.Equal(t, curlerrors.ERROR_INVALID_ARGS, cerr.ExitCode)
+	}
+
+	// the intermediate's certificate doesn't belong to the client's key
+	ctx = &CurlContext{FailEarly: true, ClientCertFile: []string{"testdata/client-intermediate.pem"}, ClientCertKeyFile: "testdata/client.key"}
+	_, cerr = ctx.BuildClientCertificates()
+	assert.NotNil(t, cerr)
+
+	ctx = &CurlContext{}
+	certs, cerr := ctx.BuildClientCertificates()
+	assert.Nil(t, cerr)
+	assert.Empty(t, certs)
+}
+
+func Test_SplitCertPassword(t *testing.T) {
+	file, password := splitCertPassword("client.p12:s3cr:et")
+	assert.Equal(t, "client.p12", file)
+	assert.Equal(t, "s3cr:et", password)
+	file, password = splitCertPassword(`C:\certs\client.p12:secret`)
+	assert.Equal(t, `C:\certs\client.p12`, file)
+	assert.Equal(t, "secret", password)
+	file, password = splitCertPassword("client.pem")
+	assert.Equal(t, "client.pem", file)
+	assert.Equal(t, "", password)
+}
+
+func Test_ClientCertificate_MutualTLS(t *testing.T) {
+	rootPem, _ := os.ReadFile("testdata/client-root.pem")
+	clientCAs := x509.NewCertPool()
+	clientCAs.AppendCertsFromPEM(rootPem)
+	ca := newTestCA(t, "server CA")
+	srv := newTestTLSServer(t, ca.issue(t, "localhost", false, time.Hour), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}), func(c *tls.Config) {
+		// verifying against the root only passes if the intermediate was sent along with the leaf
+		c.ClientAuth = tls.RequireAndVerifyClientCert
+		c.ClientCAs = clientCAs
+	})
+
+	ctx := &CurlContext{IgnoreBadCerts: true, ClientCertFile: []string{"testdata/client.p12:secret"}}
+	assert.Nil(t, pinnedRequest(t, ctx, srv.URL))
+
+	ctx = &CurlContext{IgnoreBadCerts: true}
+	assert.NotNil(t, pinnedRequest(t, ctx, srv.URL))
+}
+
+func Test_ConvertPrivateKeyBlock_Encrypted(t *testing.T) {
+	for _, file := range []string{
+		"testdata/client-legacy-encrypted.key", // Proc-Type/DEK-Info AES-256-CBC
+		"testdata/ec-legacy-encrypted.key",     // Proc-Type/DEK-Info AES-128-CBC
+		"testdata/client-pbes2.key",            // PBES2, PBKDF2/AES-256
+		"testdata/client-scrypt.key",           // PBES2, scrypt
+		"testdata/ed25519-encrypted.key",
+	} {
+		data, _ := os.ReadFile(file)
+		block, _ := pem.Decode(data)
+		if !assert.NotNil(t, block, file) {
+			continue
+		}
+		key, err := convertPrivateKeyBlock(*block, "secret")
+		assert.Nil(t, err, file)
+		assert.NotNil(t, key, file)
+
+		_, err = convertPrivateKeyBlock(*block, "wrong")
+		assert.Error(t, err, file)
+
+		_, err = convertPrivateKeyBlock(*block, "")
+		if assert.Error(t, err, file) {
+			assert.Contains(t, err.Error(), "password is required", file)
+		}
+	}
+}
+
+func Test_ConvertPrivateKeyBlock_Pbes1Unsupported(t *testing.T) {
+	data, _ := os.ReadFile("testdata/client-pbe-3des.key") // PKCS#12 PBE SHA1/3DES, only PBES2 is supported
+	block, _ := pem.Decode(data)
+	_, err := convertPrivateKeyBlock(*block, "secret")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "encrypted PKCS#8 private key")
+		assert.Contains(t, err.Error(), "PBES2")
+	}
+}
+
+func Test_ConvertPrivateKeyBlock_NamesKeyType(t *testing.T) {
+	data, _ := os.ReadFile("testdata/x25519.key")
+	block, _ := pem.Decode(data)
+	_, err := convertPrivateKeyBlock(*block, "")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "X25519")
+	}
+
+	data, _ = os.ReadFile("testdata/client-legacy-encrypted.key")
+	block, _ = pem.Decode(data)
+	_, err = convertPrivateKeyBlock(*block, "wrong")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "PKCS#1 RSA private key")
+		assert.Contains(t, err.Error(), "AES-256-CBC")
+	}
+}
+
+func Test_BuildClientCertificates_Ed25519(t *testing.T) {
+	ctx := &CurlContext{ClientCertFile: []string{"testdata/ed25519.pem"}, ClientCertKeyFile: "testdata/ed25519-encrypted.key:secret"}
+	certs, cerr := ctx.BuildClientCertificates()
+	assert.Nil(t, cerr)
+	if assert.Len(t, certs, 1) {
+		assert.IsType(t, ed25519.PrivateKey{}, certs[0].PrivateKey)
+	}
+}
+
+func Test_BuildClientCertificates_ErrorsWithoutFailEarly(t *testing.T) {
+	ctx := &CurlContext{ClientCertFile: []string{"testdata/client.pem"}, ClientCertKeyFile: "testdata/client-pbes2.key"}
+	_, cerr := ctx.BuildClientCertificates()
+	if assert.NotNil(t, cerr) {
+		assert.Equal(t, curlerrors.ERROR_SSL_CLIENT_CERTIFICATE, cerr.ExitCode)
+		assert.Contains(t, cerr.ErrorString, "encrypted PKCS#8 private key")
+	}
+
+	ctx = &CurlContext{ClientCertFile: []string{"testdata/missing.pem"}}
+	_, cerr = ctx.BuildClientCertificates()
+	if assert.NotNil(t, cerr) {
+		assert.Equal(t, curlerrors.ERROR_CANNOT_READ_FILE, cerr.ExitCode)
+	}
+
+	ctx = &CurlContext{ClientCertFile: []string{"testdata/client.pem"}}
+	_, cerr = ctx.BuildClientCertificates()
+	assert.NotNil(t, cerr)
+}
@@ -1,34 +1,43 @@
 package context
 
 import (
-	"bufio"
 	"crypto/tls"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
-	"os"
 	"sort"
 	"strings"
 	"time"
 
 	curlerrors "github.com/cdwiegand/go-curling/errors"
-	cookieJar "github.com/cdwiegand/persistent-cookiejar"
 )
 
 type CurlResponses struct {
 	Responses []*CurlResponse
 	IsError   bool
+	Warnings  curlerrors.CurlErrorCollection // not failures, the responses are still written: --warn-cert-expiry's
 }
 type CurlResponse struct {
+	Request      *http.Request
 	HttpResponse *http.Response
 	Error        error
+	ErrorCode    int // curlerrors code classifying Error, see ClassifyRequestError
 	NextUrl      *url.URL
+	Timings      Timings
 }
 
 func (ctx *CurlContext) BuildClient() (*http.Client, *curlerrors.CurlError) {
 	customTransport := http.DefaultTransport.(*http.Transport).Clone()
 	customTransport.TLSClientConfig = &tls.Config{InsecureSkipVerify: ctx.IgnoreBadCerts} // #nosec G402
+	if ctx.TlsServerName != "" {
+		// both the SNI sent and the name the certificate is verified against
+		customTransport.TLSClientConfig.ServerName = ctx.TlsServerName
+	}
+	if keyLogFile := ctx.getKeyLogFile(); keyLogFile != "" {
+		customTransport.TLSClientConfig.KeyLogWriter = &keyLogWriter{file: keyLogFile}
+	}
 
 	if ctx.Tls_MinVersion_1_0 {
 		customTransport.TLSClientConfig.MinVersion = tls.VersionTLS10
@@ -59,18 +68,41 @@ func (ctx *CurlContext) BuildClient() (*http.Client, *curlerrors.CurlError) {
 		customTransport.ExpectContinueTimeout = time.Duration(ctx.Expect100Timeout * float32(time.Second))
 	}
 
+	if ctx.tlsNotes == nil {
+		ctx.tlsNotes = &tlsNotes{}
+	}
 	var cerr *curlerrors.CurlError
 	customTransport.TLSClientConfig.RootCAs, cerr = ctx.BuildRootCAsPool()
 	if cerr != nil {
 		return nil, cerr
 	}
 
+	pinVerifier, proxyPinVerifier, cerr := ctx.BuildPinnedPubKeyVerifiers()
+	if cerr != nil {
+		return nil, cerr
+	}
+	cipherVerifier, cerr := ctx.ConfigureTlsAlgorithms(customTransport.TLSClientConfig)
+	if cerr != nil {
+		return nil, cerr
+	}
+	revocationVerifier, cerr := ctx.BuildRevocationVerifier()
+	if cerr != nil {
+		return nil, cerr
+	}
+	// an HTTPS proxy's handshake shares the above, but nothing below: that's the origin's alone
+	proxyTlsConfig := customTransport.TLSClientConfig.Clone()
+	proxyTlsConfig.VerifyConnection = chainVerifyConnection(proxyPinVerifier, cipherVerifier)
+	customTransport.TLSClientConfig.VerifyConnection = chainVerifyConnection(pinVerifier, cipherVerifier, revocationVerifier)
 	clientCerts, cerr := ctx.BuildClientCertificates()
 	if cerr != nil {
 		return nil, cerr
 	}
 	if len(clientCerts) > 0 {
-		customTransport.TLSClientConfig.Certificates = append(customTransport.TLSClientConfig.Certificates, clientCerts...)
+		customTransport.TLSClientConfig.GetClientCertificate = ctx.BuildClientCertificateSelector(clientCerts)
+	}
+	cerr = ctx.ConfigureEch(customTransport.TLSClientConfig)
+	if cerr != nil {
+		return nil, cerr
 	}
 
 	customTransport.DisableCompression = !ctx.EnableCompression
@@ -80,152 +112,36 @@ func (ctx *CurlContext) BuildClient() (*http.Client, *curlerrors.CurlError) {
 		customTransport.WriteBufferSize = 0
 	}
 
-	return &http.Client{
-		Transport: customTransport,
-		Jar:       ctx.Jar,
+	if ctx.proxy != nil {
+		customTransport.Proxy = ctx.proxy
+	}
+
+	client := &http.Client{
+		Transport: configureProxyTls(customTransport, proxyTlsConfig),
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			return http.ErrUseLastResponse // I want to handle them myself
 		},
-	}, nil
-}
-
-func (ctx *CurlContext) BuildHttpRequest(url string, index int, submitDataFormsPostContents bool, submitAuthenticationHeaders bool) (request *http.Request, err *curlerrors.CurlError) {
-	if url == "" && index < len(ctx.Urls) {
-		url = ctx.Urls[index]
 	}
-
-	var body io.Reader
-	// must call these BEFORE using ctx.method (as they may set it to POST/PUT if not yet explicitly set)
-	// fixme: add support for mixing them (upload file vs all others?)
-	// fixme: add --data-binary support
-	if submitDataFormsPostContents {
-		if len(ctx.Upload_File) > index {
-			body, err = ctx.HandleUploadRawFile(index)
-			if err != nil {
-				return nil, err // just stop now
-			}
-		} else if ctx.HasFormArgs() {
-			body, err = ctx.HandleFormMultipart()
-			if err != nil {
-				return nil, err // just stop now
-			}
-		} else if ctx.HasDataArgs() {
-			bodyData, err := ctx.HandleDataArgs(ctx.ConvertPostFormIntoGet)
-			if err != nil {
-				return nil, err // just stop now
-			}
-			if ctx.ConvertPostFormIntoGet {
-				ctx.SetMethodIfNotSet("GET")
-				if strings.Contains(url, "?") {
-					url += "&"
-				} else {
-					url += "?"
-				}
-				url += bodyData.String()
-				body = nil
-			} else {
-				body = io.Reader(bodyData)
-			}
-		}
+	if ctx.Handler != nil {
+		client.Transport = &handlerTransport{handler: ctx.Handler, disableCompression: !ctx.EnableCompression}
 	}
-
-	// this should be after all other changes to method!
-	ctx.SetMethodIfNotSet("GET")
-
-	// now build
-	// url comes from the user's command line (this is a curl-like client whose purpose is
-	// to fetch user-specified URLs), not from an untrusted remote input, so the SSRF taint
-	// warning does not apply here.
-	request, _ = http.NewRequest(strings.ToUpper(ctx.HttpVerb), url, body) // #nosec G704
-
-	ctx.SetupInitialHeadersOnRequest(request)
-
-	cerr := ctx.SetCookieHeadersOnRequest(request)
+	client.Transport, cerr = ctx.wrapCassetteTransport(client.Transport)
 	if cerr != nil {
 		return nil, cerr
 	}
-
-	cerr = ctx.SetAuthenticationHeadersOnRequest(request)
-	if cerr != nil {
-		return nil, cerr
+	if ctx.Jar != nil { // a nil *Jar in the interface would not be nil, and panic on first use
+		client.Jar = ctx.Jar
 	}
-
-	return request, nil
+	return client, nil
 }
 
-func (ctx *CurlContext) SetupInitialHeadersOnRequest(request *http.Request) {
-	// custom headers ALWAYS come first (we use `set` below to override when needed)
-	if len(ctx.Headers) > 0 {
-		for _, h := range ctx.Headers {
-			parts := strings.SplitN(h, ":", 2)
-			if len(parts) == 2 {
-				// trim the OWS around the name/value so "Name: value" does not send
-				// a leading space in the value (curl trims it; servers strip it too)
-				request.Header.Set(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
-			}
-		}
-	}
-
-	if ctx.UserAgent != "" {
-		request.Header.Set("User-Agent", ctx.UserAgent)
-	} else if request.Header.Get("User-Agent") == "" {
-		request.Header.Del("User-Agent")
-	}
-	if ctx.Referer != "" {
-		request.Header.Set("Referer", ctx.Referer)
-	}
-	if request.Header.Get("Accept") == "" {
-		// curl default, so matching
-		request.Header.Set("Accept", "*/*")
-	}
-}
-
-func (ctx *CurlContext) SetCookieHeadersOnRequest(request *http.Request) *curlerrors.CurlError {
-	if ctx.Cookies != nil {
-		for _, cookie := range ctx.Cookies {
-			if !strings.Contains(cookie, "=") { // curl does this, so... ugh, wish golang had .Net's System.IO.Path.Exists() in a safe way
-				// no '=' means the value is a filename to read cookies from (we use cookieJar's format, not curl's)
-				tmp, err := cookieJar.New(&cookieJar.Options{
-					Filename: cookie,
-				})
-				if err == nil && tmp != nil {
-					for _, y := range tmp.AllCookies() {
-						request.AddCookie(y)
-					}
-				}
-			} else {
-				request.Header.Add("Cookie", cookie)
-			}
-		}
-	}
-	return nil
-}
-
-func (ctx *CurlContext) SetAuthenticationHeadersOnRequest(request *http.Request) *curlerrors.CurlError {
-	if request.Header == nil {
-		request.Header = http.Header{}
-	}
-
-	if ctx.UserAuth != "" {
-		auths := strings.SplitN(ctx.UserAuth, ":", 2) // this way password can contain a :
-		if len(auths) == 1 {
-			if ctx.IsSilent || ctx.SilentFail {
-				return curlerrors.NewCurlErrorFromString(curlerrors.ERROR_INVALID_ARGS, "User auth requires username:password format, operating quiet so not prompting for value.")
-			}
-			fmt.Print("Enter password: ")
-			reader := bufio.NewReader(os.Stdin)
-			input, _ := reader.ReadString('\n') // if unable to read, use blank instead
-			auths = append(auths, input)
-			ctx.UserAuth = strings.Join(auths, ":") // for next request, if any
-		}
-		request.SetBasicAuth(auths[0], auths[1])
-	}
-
-	if request.Header.Get("Authorization") == "" && ctx.OAuth2_BearerToken != "" {
-		request.Header.Set("Authorization", "Bearer "+ctx.OAuth2_BearerToken)
+// BuildHttpRequest plans the request for the index'th URL (see PlanRequest) and builds it.
+func (ctx *CurlContext) BuildHttpRequest(url string, index int, submitDataFormsPostContents bool, submitAuthenticationHeaders bool) (*http.Request, *curlerrors.CurlError) {
+	plan, cerr := ctx.PlanRequest(url, index, submitDataFormsPostContents, submitAuthenticationHeaders)
+	if cerr != nil {
+		return nil, cerr
 	}
-
-	return nil
+	return plan.NewHttpRequest(), nil
 }
 
 func (ctx *CurlContext) GetCompleteResponse(index int, client *http.Client, request *http.Request) (*CurlResponses, *curlerrors.CurlError) {
@@ -238,22 +154,38 @@ func (ctx *CurlContext) GetCompleteResponse(index int, client *http.Client, requ
 		r := urls[i]
 		var respReal *CurlResponse
 		for retry := 0; retry <= ctx.MaxRetries; retry++ {
-			respReal = GetCurlResponse(client, r)
+			attempt := r
+			if retry > 0 {
+				attempt = rewindRequest(r)
+			}
+			respReal = GetCurlResponse(client, attempt, ctx.BuildRedactor())
 			respsReal.Responses = append(respsReal.Responses, respReal)
+			if respReal.HttpResponse != nil && respReal.HttpResponse.TLS != nil && ctx.WarnCertExpiryDays > 0 {
+				expiring := CheckCertificateExpiry(ctx.certificatesNotYetExpiryChecked(connectionChain(*respReal.HttpResponse.TLS)), ctx.WarnCertExpiryDays, time.Now())
+				for _, warning := range expiring.Errors {
+					respsReal.Warnings.AppendCurlError(warning.AtUrl(index, i))
+				}
+			}
 
-			if respReal.HttpResponse != nil && ctx.canStatusCodeRetry(respReal.HttpResponse.StatusCode) && retry < ctx.MaxRetries {
-				time.Sleep(time.Duration(ctx.RetryDelaySeconds) * time.Second)
-			} else {
+			if respReal.HttpResponse == nil || !ctx.canStatusCodeRetry(respReal.HttpResponse.StatusCode) || retry >= ctx.MaxRetries {
 				break
 			}
+			select {
+			case <-time.After(time.Duration(ctx.RetryDelaySeconds) * time.Second):
+			case <-r.Context().Done(): // cancelled while waiting to retry, so don't
+				err := r.Context().Err()
+				respsReal.IsError = true
+				cerr = curlerrors.NewCurlErrorFromStringAndError(ClassifyRequestError(err), fmt.Sprintf("Was unable to query URL %v", ctx.BuildRedactor().RedactUrl(r.URL)), err)
+				return respsReal, cerr.AtUrl(index, i)
+			}
 		}
 
 		respsReal.IsError = (respReal.HttpResponse == nil || respReal.HttpResponse.StatusCode >= 400)
 
 		if respReal.Error != nil {
 			respsReal.IsError = true
-			cerr = curlerrors.NewCurlErrorFromStringAndError(curlerrors.ERROR_NO_RESPONSE, fmt.Sprintf("Was unable to query URL %v", request.URL), respReal.Error)
-			return respsReal, cerr
+			cerr = curlerrors.NewCurlErrorFromStringAndError(respReal.ErrorCode, fmt.Sprintf("Was unable to query URL %v", ctx.BuildRedactor().RedactUrl(r.URL)), respReal.Error)
+			return respsReal, cerr.AtUrl(index, i)
 		}
 
 		if ctx.FollowRedirects && respReal.NextUrl != nil &&
@@ -266,30 +198,74 @@ func (ctx *CurlContext) GetCompleteResponse(index int, client *http.Client, requ
 					(respReal.HttpResponse.StatusCode == 302 && ctx.Allow302Post) ||
 					(respReal.HttpResponse.StatusCode == 303 && ctx.Allow303Post)
 			}
-			newReq, cerr = ctx.BuildHttpRequest(respReal.NextUrl.String(), index, retainData, ctx.RedirectsKeepAuthenticationHeaders)
+			// as curl, credentials only follow a redirect to another host (or port, or scheme) with --location-trusted
+			keepAuth := ctx.RedirectsKeepAuthenticationHeaders || sameOrigin(request.URL, respReal.NextUrl)
+			newReq, cerr = ctx.BuildHttpRequest(respReal.NextUrl.String(), index, retainData, keepAuth)
 			if cerr != nil {
-				return respsReal, cerr
+				return respsReal, cerr.AtUrl(index, i+1)
 			}
 
 			if !retainData {
 				newReq.Method = "GET"
 			}
-			urls = append(urls, newReq)
+			urls = append(urls, newReq.WithContext(r.Context())) // so cancelling the first request stops its redirects too
 		}
 	}
 
 	return respsReal, nil
 }
 
-func GetCurlResponse(client *http.Client, request *http.Request) *CurlResponse {
+// sameOrigin reports whether a and b have the same scheme, host and port.
+func sameOrigin(a *url.URL, b *url.URL) bool {
+	return strings.EqualFold(a.Scheme, b.Scheme) && strings.EqualFold(a.Hostname(), b.Hostname()) && urlPort(a) == urlPort(b)
+}
+
+// urlPort is u's port, or its scheme's default.
+func urlPort(u *url.URL) string {
+	if port := u.Port(); port != "" {
+		return port
+	}
+	if strings.EqualFold(u.Scheme, "https") {
+		return "443"
+	}
+	return "80"
+}
+
+// rewindRequest is r again with its body back at the start, as sending r read it.
+func rewindRequest(r *http.Request) *http.Request {
+	if r.GetBody == nil {
+		return r
+	}
+	body, err := r.GetBody()
+	if err != nil {
+		return r
+	}
+	again := r.Clone(r.Context())
+	again.Body = body
+	return again
+}
+
+// GetCurlResponse sends request, with the URL in any error (net/http's repeat it) masked by redactor (if not nil).
+func GetCurlResponse(client *http.Client, request *http.Request, redactor *Redactor) *CurlResponse {
 	// The request URL is supplied by the user on the command line (this is a curl-like
 	// client whose sole purpose is fetching user-specified URLs), not from an untrusted
 	// remote input, so the SSRF taint warning does not apply here.
-	resp, err := client.Do(request) // #nosec G704
+	trace := newTimingsTrace()
+	resp, err := client.Do(request.WithContext(httptrace.WithClientTrace(request.Context(), trace.clientTrace()))) // #nosec G704
+
+	if urlErr := (*url.Error)(nil); errors.As(err, &urlErr) {
+		urlErr.URL = redactor.RedactUrlString(urlErr.URL) // it's quoted in the error's text, secrets and all
+	}
 
 	respReal := new(CurlResponse)
+	respReal.Request = request
+	respReal.Timings = trace.done()
 	respReal.Error = err
+	respReal.ErrorCode = ClassifyRequestError(err)
 	respReal.HttpResponse = resp
+	if echErr := (*tls.ECHRejectionError)(nil); errors.As(err, &echErr) {
+		respReal.Error = fmt.Errorf("%w (%s)", err, describeEchRejection(echErr))
+	}
 
 	if respReal.HttpResponse != nil && respReal.HttpResponse.StatusCode >= 300 && respReal.HttpResponse.StatusCode <= 399 {
 		location := respReal.HttpResponse.Header.Get("Location")
@@ -316,11 +292,16 @@ func (ctx *CurlContext) canStatusCodeRetry(statusCode int) bool {
 }
 
 func (ctx *CurlContext) ProcessResponseToOutputs(index int, resp *CurlResponses, request *http.Request) (cerrs curlerrors.CurlErrorCollection) {
-	err2 := ctx.Jar.Save() // is ignored if jar's filename is empty
+	err2 := ctx.SaveCookieJar() // is ignored if no -c/--cookie-jar was given
 	if err2 != nil {
 		cerrs.AppendCurlError(curlerrors.NewCurlErrorFromStringAndError(curlerrors.ERROR_CANNOT_WRITE_FILE, "Failed to save cookies to jar", err2))
 		// continue anyways!
 	}
+	err2 = ctx.SaveSession() // is ignored without --session
+	if err2 != nil {
+		cerrs.AppendCurlError(curlerrors.NewCurlErrorFromStringAndError(curlerrors.ERROR_CANNOT_WRITE_FILE, "Failed to save session", err2))
+	}
+	cerrs.AppendCurlErrors(resp.Warnings)
 
 	if resp.IsError {
 		// server returned an error status (>= 400).
@@ -341,10 +322,15 @@ func (ctx *CurlContext) ProcessResponseToOutputs(index int, resp *CurlResponses,
 		// success
 		cerrs.AppendCurlErrors(ctx.EmitResponseToOutputs(index, resp, request))
 	}
+	for _, cerr := range cerrs.Errors {
+		if cerr.UrlIndex < 0 {
+			cerr.AtUrl(index, cerr.Hop)
+		}
+	}
 	return
 }
 
-func DumpResponseHeaders(resp *http.Response, verboseFormat bool) (res []string) {
+func DumpResponseHeaders(resp *http.Response, verboseFormat bool, redactor *Redactor) (res []string) {
 	proto := resp.Proto
 	if resp.Proto == "" {
 		proto = "HTTP/?" // default, sometimes golang won't let you have the HTTP protocol version in the response
@@ -364,14 +350,14 @@ func DumpResponseHeaders(resp *http.Response, verboseFormat bool) (res []string)
 		prefix = "< "
 	}
 	for _, name := range keys { // I want them alphabetical
-		res = append(res, fmt.Sprintf("%s%s: %s", prefix, name, dict[name]))
+		res = append(res, fmt.Sprintf("%s%s: %s", prefix, name, redactor.RedactHeaderValue(name, dict[name])))
 	}
 
 	return
 }
 
-func DumpRequestHeaders(req *http.Request) (res []string) {
-	res = append(res, fmt.Sprintf("%v %v", req.Method, req.URL))
+func DumpRequestHeaders(req *http.Request, redactor *Redactor) (res []string) {
+	res = append(res, fmt.Sprintf("%v %v", req.Method, redactor.RedactUrl(req.URL)))
 	dict := make(map[string]string)
 	keys := make([]string, 0, len(req.Header))
 	for name, values := range req.Header {
@@ -382,7 +368,7 @@ func DumpRequestHeaders(req *http.Request) (res []string) {
 	}
 	sort.Strings(keys)
 	for _, name := range keys { // I want them alphabetical
-		res = append(res, fmt.Sprintf("> %s: %s", name, dict[name]))
+		res = append(res, fmt.Sprintf("> %s: %s", name, redactor.RedactHeaderValue(name, dict[name])))
 	}
 
 	return
@@ -434,11 +420,17 @@ const (
 func DumpTlsDetails(conn *tls.ConnectionState) (res []string) {
 	res = append(res, fmt.Sprintf("TLS Version: %v", GetTlsVersionString(conn.Version)))
 	res = append(res, fmt.Sprintf("TLS Cipher Suite: %v", tls.CipherSuiteName(conn.CipherSuite)))
+	if conn.CurveID != 0 {
+		res = append(res, fmt.Sprintf("TLS Key Exchange: %v", conn.CurveID))
+	}
 	if conn.NegotiatedProtocol != "" {
 		res = append(res, fmt.Sprintf("TLS Negotiated Protocol: %v", conn.NegotiatedProtocol))
 	}
 	if conn.ServerName != "" {
 		res = append(res, fmt.Sprintf("TLS Server Name: %v", conn.ServerName))
 	}
+	if conn.ECHAccepted {
+		res = append(res, "TLS ECH: accepted")
+	}
 	return
 }
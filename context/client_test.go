@@ -10,41 +10,39 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
-func Test_SetAuthenticationHeadersOnRequest(t *testing.T) {
-
-	// request *http.Request) *curlerrors.CurlError
-	req := &http.Request{}
-	ctx := &CurlContext{}
+func Test_PlanRequest_Authentication(t *testing.T) {
+	ctx := &CurlContext{Urls: []string{"http://localhost/"}}
 	ctx.UserAuth = ""
-	cerr := ctx.SetAuthenticationHeadersOnRequest(req)
+	plan, cerr := ctx.PlanRequest("", 0, true, true)
 	assert.Nil(t, cerr)
+	req := plan.NewHttpRequest()
 	user, pass, ok := req.BasicAuth()
 	assert.Empty(t, user)
 	assert.Empty(t, pass)
 	assert.False(t, ok)
 
-	req = &http.Request{}
-	ctx = &CurlContext{}
+	ctx = &CurlContext{Urls: []string{"http://localhost/"}}
 	ctx.UserAuth = "hello:world"
-	cerr = ctx.SetAuthenticationHeadersOnRequest(req)
+	plan, cerr = ctx.PlanRequest("", 0, true, true)
 	assert.Nil(t, cerr)
+	req = plan.NewHttpRequest()
 	user, pass, ok = req.BasicAuth()
 	assert.Equal(t, "hello", user)
 	assert.Equal(t, "world", pass)
 	assert.True(t, ok)
 
-	req = &http.Request{}
-	ctx = &CurlContext{}
+	ctx = &CurlContext{Urls: []string{"http://localhost/"}}
 	ctx.UserAuth = "empty"
 	ctx.SilentFail = true
-	cerr = ctx.SetAuthenticationHeadersOnRequest(req)
+	plan, cerr = ctx.PlanRequest("", 0, true, true)
 	assert.NotNil(t, cerr)
+	assert.Nil(t, plan)
 
-	req = &http.Request{}
-	ctx = &CurlContext{}
+	ctx = &CurlContext{Urls: []string{"http://localhost/"}}
 	ctx.OAuth2_BearerToken = "Artwork-Mountain-Underscore1"
-	cerr = ctx.SetAuthenticationHeadersOnRequest(req)
+	plan, cerr = ctx.PlanRequest("", 0, true, true)
 	assert.Nil(t, cerr)
+	req = plan.NewHttpRequest()
 	user, pass, ok = req.BasicAuth()
 	assert.Empty(t, user)
 	assert.Empty(t, pass)
@@ -52,12 +50,12 @@ func Test_SetAuthenticationHeadersOnRequest(t *testing.T) {
 	foundHeader := req.Header.Get("Authorization")
 	assert.Equal(t, "Bearer Artwork-Mountain-Underscore1", foundHeader)
 
-	req = &http.Request{}
-	ctx = &CurlContext{}
+	ctx = &CurlContext{Urls: []string{"http://localhost/"}}
 	ctx.OAuth2_BearerToken = "Artwork-Mountain-Underscore1"
 	ctx.UserAuth = "hello:world"
-	cerr = ctx.SetAuthenticationHeadersOnRequest(req)
+	plan, cerr = ctx.PlanRequest("", 0, true, true)
 	assert.Nil(t, cerr)
+	req = plan.NewHttpRequest()
 	user, pass, ok = req.BasicAuth()
 	assert.Equal(t, "hello", user)
 	assert.Equal(t, "world", pass)
@@ -67,6 +65,17 @@ func Test_SetAuthenticationHeadersOnRequest(t *testing.T) {
 	assert.Equal(t, "Basic aGVsbG86d29ybGQ=", foundHeader)
 }
 
+func Test_PlanRequest_WithoutAuthentication(t *testing.T) {
+	ctx := &CurlContext{Urls: []string{"http://localhost/"}, UserAuth: "hello", OAuth2_BearerToken: "token",
+		Headers: []string{"Authorization: Bearer custom", "cookie: a=b", "X-Other: kept"}}
+	plan, cerr := ctx.PlanRequest("http://elsewhere/", 0, true, false) // no password prompt, either
+	assert.Nil(t, cerr)
+	req := plan.NewHttpRequest()
+	assert.Empty(t, req.Header.Get("Authorization"))
+	assert.Empty(t, req.Header.Get("Cookie"))
+	assert.Equal(t, "kept", req.Header.Get("X-Other"))
+}
+
 func Test_DumpResponseHeaders(t *testing.T) {
 	resp := &http.Response{}
 	resp.Proto = "HTTP/2"
@@ -76,7 +85,7 @@ func Test_DumpResponseHeaders(t *testing.T) {
 	resp.Header.Add("Y-Hello", "World3")
 	resp.Header.Add("H-Hello", "World1")
 
-	test := DumpResponseHeaders(resp, true)
+	test := DumpResponseHeaders(resp, true, nil)
 	test2 := strings.Join(test, "\n")
 
 	assert.True(t, strings.HasPrefix(test2, "HTTP/2 418\n"))
@@ -85,7 +94,7 @@ func Test_DumpResponseHeaders(t *testing.T) {
 	assert.Equal(t, "< Y-Hello: World3", test[3])
 
 	resp.Proto = ""
-	test = DumpResponseHeaders(resp, true)
+	test = DumpResponseHeaders(resp, true, nil)
 	test2 = strings.Join(test, "\n")
 	assert.True(t, strings.HasPrefix(test2, "HTTP/? 418\n"))
 }
@@ -99,7 +108,7 @@ func Test_DumpRequestHeaders(t *testing.T) {
 	req.Header.Add("Y-Hello", "World3")
 	req.Header.Add("H-Hello", "World1")
 
-	test := DumpRequestHeaders(req)
+	test := DumpRequestHeaders(req, nil)
 	test2 := strings.Join(test, "\n")
 
 	assert.True(t, strings.HasPrefix(test2, "PUT https://github.com/cdwiegand/go-curling/\n"))
@@ -0,0 +1,105 @@
+package context
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"sync"
+)
+
+// tlsNotes collects what happened during TLS handshakes (which happen deep inside the transport),
+// so verbose output can report it alongside the response that used the connection.
+type tlsNotes struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (n *tlsNotes) add(line string) {
+	if n == nil {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.lines = append(n.lines, line)
+}
+
+// drain returns the notes collected so far and forgets them, so each is only reported once.
+func (n *tlsNotes) drain() []string {
+	if n == nil {
+		return nil
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	ret := n.lines
+	n.lines = nil
+	return ret
+}
+
+// BuildClientCertificateSelector returns a tls.Config.GetClientCertificate hook choosing, for each
+// handshake, the first of certs the server's CertificateRequest says it will accept (by CA and
+// signature scheme). If none match, the first is presented anyways, as curl does with its one cert.
+func (ctx *CurlContext) BuildClientCertificateSelector(certs []tls.Certificate) func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return func(cri *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		cert, reason := SelectClientCertificate(certs, cri)
+		ctx.tlsNotes.add(reason)
+		return cert, nil
+	}
+}
+
+// SelectClientCertificate picks the certificate to present and explains why, for verbose output.
+func SelectClientCertificate(certs []tls.Certificate, cri *tls.CertificateRequestInfo) (*tls.Certificate, string) {
+	if len(certs) == 0 {
+		return &tls.Certificate{}, "Server requested a client certificate, none given"
+	}
+	var rejected []string
+	for i := range certs {
+		if err := cri.SupportsCertificate(&certs[i]); err != nil {
+			rejected = append(rejected, fmt.Sprintf("%s (%v)", clientCertificateName(&certs[i]), err))
+			continue
+		}
+		return &certs[i], fmt.Sprintf("Presented client certificate %s: %s", clientCertificateName(&certs[i]), acceptedBecause(&certs[i], cri))
+	}
+	return &certs[0], fmt.Sprintf("Presented client certificate %s although the server may not accept it, no certificate matched: %v", clientCertificateName(&certs[0]), rejected)
+}
+
+func clientCertificateName(cert *tls.Certificate) string {
+	leaf := cert.Leaf
+	if leaf == nil && len(cert.Certificate) > 0 {
+		leaf, _ = x509.ParseCertificate(cert.Certificate[0])
+	}
+	if leaf == nil {
+		return "(unparseable)"
+	}
+	return fmt.Sprintf("%q", leaf.Subject.String())
+}
+
+func acceptedBecause(cert *tls.Certificate, cri *tls.CertificateRequestInfo) string {
+	if len(cri.AcceptableCAs) == 0 {
+		return "server accepts any CA"
+	}
+	for _, der := range cert.Certificate {
+		c, err := x509.ParseCertificate(der)
+		if err != nil {
+			continue
+		}
+		for _, ca := range cri.AcceptableCAs {
+			if bytes.Equal(c.RawIssuer, ca) || bytes.Equal(c.RawSubject, ca) {
+				return fmt.Sprintf("issued under %s, a CA the server accepts", distinguishedName(ca))
+			}
+		}
+	}
+	return "matches the server's acceptable CAs"
+}
+
+func distinguishedName(der []byte) string {
+	var rdn pkix.RDNSequence
+	if _, err := asn1.Unmarshal(der, &rdn); err != nil {
+		return "(unparseable name)"
+	}
+	var name pkix.Name
+	name.FillFromRDNSequence(&rdn)
+	return fmt.Sprintf("%q", name.String())
+}
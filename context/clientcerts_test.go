@@ -0,0 +1,121 @@
+package context
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeCertAndKey writes cert's chain to NAME.pem and its key to NAME.key, returning the .pem path.
+func writeCertAndKey(t *testing.T, dir string, name string, cert tls.Certificate) string {
+	t.Helper()
+	var certPem []byte
+	for _, der := range cert.Certificate {
+		certPem = append(certPem, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	keyDer, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile := filepath.Join(dir, name+".pem")
+	os.WriteFile(certFile, certPem, 0600)
+	os.WriteFile(filepath.Join(dir, name+".key"), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer}), 0600)
+	return certFile
+}
+
+func newClientCertServer(t *testing.T, acceptable *testCA) string {
+	t.Helper()
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(acceptable.Cert)
+	serverCA := newTestCA(t, "server CA")
+	srv := newTestTLSServer(t, serverCA.issue(t, "localhost", false, time.Hour), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}), func(c *tls.Config) {
+		c.ClientAuth = tls.RequireAndVerifyClientCert
+		c.ClientCAs = clientCAs
+	})
+	return srv.URL
+}
+
+func Test_ClientCertificate_ChosenByAcceptableCAs(t *testing.T) {
+	staging := newTestCA(t, "staging CA")
+	production := newTestCA(t, "production CA")
+	dir := t.TempDir()
+	stagingFile := writeCertAndKey(t, dir, "staging", staging.issue(t, "staging client", true, time.Hour))
+	productionFile := writeCertAndKey(t, dir, "production", production.issue(t, "production client", true, time.Hour))
+	// unlike in a directory, a file given to --cert has to carry its own key
+	for _, f := range []string{stagingFile, productionFile} {
+		key, _ := os.ReadFile(strings.TrimSuffix(f, ".pem") + ".key")
+		pemData, _ := os.ReadFile(f)
+		os.WriteFile(f, append(pemData, key...), 0600)
+	}
+
+	// whichever order they're given in, the server's CA list picks the right one
+	for _, order := range [][]string{{stagingFile, productionFile}, {productionFile, stagingFile}} {
+		url := newClientCertServer(t, production)
+		ctx := &CurlContext{IgnoreBadCerts: true, ClientCertFile: order}
+		assert.Nil(t, pinnedRequest(t, ctx, url))
+		notes := strings.Join(ctx.tlsNotes.drain(), "\n")
+		assert.Contains(t, notes, `Presented client certificate "CN=production client": issued under "CN=production CA"`)
+	}
+}
+
+func Test_ClientCertificate_Directory(t *testing.T) {
+	staging := newTestCA(t, "staging CA")
+	production := newTestCA(t, "production CA")
+	dir := t.TempDir()
+	writeCertAndKey(t, dir, "staging", staging.issue(t, "staging client", true, time.Hour))
+	writeCertAndKey(t, dir, "production", production.issue(t, "production client", true, time.Hour))
+	os.WriteFile(filepath.Join(dir, "README.txt"), []byte("not a certificate"), 0600)
+	os.WriteFile(filepath.Join(dir, "broken.pem"), []byte("not a certificate either"), 0600)
+
+	ctx := &CurlContext{ClientCertFile: []string{dir}}
+	certs, cerr := ctx.BuildClientCertificates()
+	assert.Nil(t, cerr)
+	assert.Len(t, certs, 2)
+
+	url := newClientCertServer(t, staging)
+	ctx = &CurlContext{IgnoreBadCerts: true, ClientCertFile: []string{dir}}
+	assert.Nil(t, pinnedRequest(t, ctx, url))
+	notes := strings.Join(ctx.tlsNotes.drain(), "\n")
+	assert.Contains(t, notes, "Skipped client certificate")
+	assert.Contains(t, notes, `Presented client certificate "CN=staging client"`)
+
+	ctx = &CurlContext{ClientCertFile: []string{t.TempDir()}}
+	_, cerr = ctx.BuildClientCertificates()
+	assert.NotNil(t, cerr)
+}
+
+func Test_SelectClientCertificate(t *testing.T) {
+	ecdsaCert := newTestCA(t, "some CA").issue(t, "ecdsa client", true, time.Hour)
+	edCtx := &CurlContext{ClientCertFile: []string{"testdata/ed25519.pem"}, ClientCertKeyFile: "testdata/ed25519-encrypted.key:secret"}
+	edCerts, cerr := edCtx.BuildClientCertificates()
+	assert.Nil(t, cerr)
+	certs := []tls.Certificate{ecdsaCert, edCerts[0]}
+
+	// no CA list: first certificate the signature schemes allow
+	cert, reason := SelectClientCertificate(certs, &tls.CertificateRequestInfo{SignatureSchemes: []tls.SignatureScheme{tls.ECDSAWithP256AndSHA256, tls.Ed25519}, Version: tls.VersionTLS13})
+	assert.Equal(t, &certs[0], cert)
+	assert.Contains(t, reason, "server accepts any CA")
+
+	// server only verifies Ed25519 signatures
+	cert, reason = SelectClientCertificate(certs, &tls.CertificateRequestInfo{SignatureSchemes: []tls.SignatureScheme{tls.Ed25519}, Version: tls.VersionTLS13})
+	assert.Equal(t, &certs[1], cert)
+	assert.Contains(t, reason, "ed25519 client")
+
+	// nothing matches: first is presented, and we say so
+	cert, reason = SelectClientCertificate(certs, &tls.CertificateRequestInfo{SignatureSchemes: []tls.SignatureScheme{tls.PSSWithSHA256}, Version: tls.VersionTLS13})
+	assert.Equal(t, &certs[0], cert)
+	assert.Contains(t, reason, "no certificate matched")
+
+	cert, _ = SelectClientCertificate(nil, &tls.CertificateRequestInfo{})
+	assert.Empty(t, cert.Certificate)
+}
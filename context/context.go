@@ -1,21 +1,25 @@
 package context
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
-	"os"
 	"strings"
+	"time"
 
 	curlerrors "github.com/cdwiegand/go-curling/errors"
 	cookieJar "github.com/cdwiegand/persistent-cookiejar"
-	"golang.org/x/net/publicsuffix"
 )
 
 const DEFAULT_OUTPUT = "/dev/stdout"
 const DEFAULT_STDERR = "/dev/stderr"
 
+// --error-format values
+const ERROR_FORMAT_TEXT = "text"
+const ERROR_FORMAT_JSON = "json"
+
 type CurlContext struct {
 	Version                            bool
 	Verbose                            bool
@@ -47,9 +51,25 @@ type CurlContext struct {
 	ConvertPostFormIntoGet             bool
 	CaCertFile                         []string
 	CaCertPath                         string
-	ClientCertFile                     string
+	ClientCertFile                     []string
 	ClientCertKeyFile                  string
 	ClientCertKeyPassword              string
+	ClientCertType                     string
+	ClientCertKeyType                  string
+	TlsCiphers                         string
+	Tls13Ciphers                       string
+	TlsCurves                          string
+	ListTlsSupport                     bool
+	RequireCertStatus                  bool
+	CrlFile                            string
+	CertInfo                           bool
+	WarnCertExpiryDays                 int
+	TlsServerName                      string
+	KeyLogFile                         string
+	EchMode                            string
+	EchConfig                          string
+	LegacyExitCodes                    bool
+	ErrorFormat                        string
 	IncludeHeadersInMainOutput         bool
 	ShowErrorEvenIfSilent              bool
 	Referer                            string
@@ -57,7 +77,13 @@ type CurlContext struct {
 	Cookies                            []string
 	CookieJar                          string
 	JunkSessionCookies                 bool
+	CookieJarFormat                    string
 	Jar                                *cookieJar.Jar
+	OutputWriter                       CurlOutputWriter // where all output goes, NewDefaultOutputWriter's if not set
+	Handler                            http.Handler     // if set, serves every request in-process instead of the network
+	RecordFile                         string
+	ReplayFile                         string
+	ReplayMatch                        string
 	Upload_File                        []string
 	Data_Standard                      []string
 	Data_Ascii                         []string
@@ -78,16 +104,38 @@ type CurlContext struct {
 	RetryAllErrors                     bool
 	ForceTryHttp2                      bool
 	Expect100Timeout                   float32
+	DoNotRedactSecrets                 bool
+	RedactHeaders                      []string
+	RedactQueryParams                  []string
+	SessionName                        string
+	SessionReadOnly                    string
+	PinnedPubKey                       string
+	ProxyPinnedPubKey                  string
 
 	// internal:
-	filesAlreadyStartedWriting map[string]*os.File
+	cookieJarFormat      string
+	cookiesAtLoad        map[string]string
+	session              *Session
+	sessionFile          string
+	sessionStickyHeaders []string
+	promptedUserAuth     string
+	tlsNotes             *tlsNotes
+	expiryCheckedCerts   map[string]bool
+	proxy                func(*http.Request) (*url.URL, error) // nil for the environment's (HTTPS_PROXY etc.)
 }
 
-type CurlOutputWriter interface {
-	WriteToFileBytes(file string, body []byte) error
+func (ctx *CurlContext) SetupContextForRun(extraArgs []string) *curlerrors.CurlError {
+	return ctx.setupContext(nil, extraArgs)
 }
 
-func (ctx *CurlContext) SetupContextForRun(extraArgs []string) *curlerrors.CurlError {
+// SetupContextForNextGroup is SetupContextForRun for a -:/--next group after the first: rather than loading its
+// own, it shares the cookie jar and session of previous (the group before it), so cookies one group gets are sent
+// by the next, and everything is saved together.
+func (ctx *CurlContext) SetupContextForNextGroup(previous *CurlContext, extraArgs []string) *curlerrors.CurlError {
+	return ctx.setupContext(previous, extraArgs)
+}
+
+func (ctx *CurlContext) setupContext(previous *CurlContext, extraArgs []string) *curlerrors.CurlError {
 	// do sanity checks and "fix" some parts left remaining from flag parsing
 
 	if ctx.Verbose && len(ctx.HeaderOutput) == 0 {
@@ -123,6 +171,14 @@ func (ctx *CurlContext) SetupContextForRun(extraArgs []string) *curlerrors.CurlE
 		return curlerrors.NewCurlErrorFromString(curlerrors.ERROR_INVALID_ARGS, "Cannot include more than one option from: --tls1/-1, --tlsv1.1, --tlsv1.2, --tlsv1.3")
 	}
 
+	if ctx.ErrorFormat != "" && ctx.ErrorFormat != ERROR_FORMAT_TEXT && ctx.ErrorFormat != ERROR_FORMAT_JSON {
+		return curlerrors.NewCurlErrorFromString(curlerrors.ERROR_INVALID_ARGS, "--error-format must be text or json")
+	}
+
+	if cerr := ctx.validateCassetteArgs(); cerr != nil {
+		return cerr
+	}
+
 	if len(extraArgs) > 0 {
 		for _, h := range extraArgs {
 			if strings.HasPrefix(h, "-") {
@@ -131,20 +187,36 @@ func (ctx *CurlContext) SetupContextForRun(extraArgs []string) *curlerrors.CurlE
 		}
 	}
 
+	if previous != nil {
+		ctx.shareSession(previous)
+	} else if cerr := ctx.LoadSession(); cerr != nil {
+		return cerr
+	}
+
 	s, err2 := ctx.setupUrlsFromArgs(extraArgs)
 	if err2 != nil {
-		return curlerrors.NewCurlErrorFromStringAndError(curlerrors.ERROR_INVALID_URL, fmt.Sprintf("Could not parse url: %q", s), err2)
+		redacted := ctx.BuildRedactor().RedactUrlString(s)
+		var urlErr *url.Error
+		if errors.As(err2, &urlErr) {
+			urlErr.URL = redacted // its message quotes the URL too
+		}
+		return curlerrors.NewCurlErrorFromStringAndError(curlerrors.ERROR_INVALID_URL, fmt.Sprintf("Could not parse url: %q", redacted), err2)
 	}
 
-	jar, err := cookieJar.New(&cookieJar.Options{
-		PublicSuffixList:      publicsuffix.List,
-		Filename:              ctx.CookieJar,
-		PersistSessionCookies: !ctx.JunkSessionCookies,
-	})
-	if err != nil {
-		return curlerrors.NewCurlErrorFromStringAndError(curlerrors.ERROR_CANNOT_READ_FILE, "Unable to create cookie jar", err)
+	if previous != nil {
+		if ctx.OutputWriter == nil {
+			ctx.OutputWriter = previous.getOutputWriter() // so a file two groups write to isn't truncated by the second
+		}
+		ctx.shareCookieJar(previous)
+	} else {
+		jar, cerr := ctx.LoadCookieJar()
+		if cerr != nil {
+			return cerr
+		}
+		ctx.Jar = jar
+		ctx.AddSessionCookiesToJar()
 	}
-	ctx.Jar = jar
+	ctx.AddCookieFilesToJar() // after the session's, so -b files win
 
 	return nil
 }
@@ -155,6 +227,7 @@ func (ctx *CurlContext) setupUrlsFromArgs(extraArgs []string) (string, error) {
 
 	if len(urls) > 0 {
 		for _, s := range urls {
+			s = ctx.resolveSessionUrl(s)
 			if strings.Index(s, "/") == 0 {
 				// url is /something/here - assume localhost!
 				s = ctx.DefaultProtocolScheme + "://localhost" + s
@@ -288,15 +361,25 @@ func (ctx *CurlContext) EmitSingleHttpResponseToOutputs(index int, resp *http.Re
 
 	separator := []byte("\n\n")
 	headerBody := []byte("")
+	redactor := ctx.BuildRedactor()
 	if ctx.Verbose {
 		if request != nil {
-			headerBody = appendStrings(headerBody, separator, DumpRequestHeaders(request))
+			headerBody = appendStrings(headerBody, separator, DumpRequestHeaders(request, redactor))
 		}
 		if resp.TLS != nil {
-			headerBody = appendStrings(headerBody, separator, DumpTlsDetails(resp.TLS))
+			headerBody = appendStrings(headerBody, separator, append(DumpTlsDetails(resp.TLS), ctx.tlsNotes.drain()...))
+			if ctx.CertInfo {
+				headerBody = appendStrings(headerBody, separator, DumpCertificateChain(resp.TLS.PeerCertificates, time.Now()))
+			}
+		}
+	} else if ctx.CertInfo && resp.TLS != nil && !ctx.IsSilent {
+		// like curl's verbose output, go to stderr so the body stays clean
+		certInfo := strings.Join(DumpCertificateChain(resp.TLS.PeerCertificates, time.Now()), "\n") + "\n"
+		if err := ctx.WriteToErrorOutput([]byte(certInfo)); err != nil {
+			cerrs.AppendError(curlerrors.ERROR_CANNOT_WRITE_FILE, err)
 		}
 	}
-	headerBody = appendStrings(headerBody, separator, DumpResponseHeaders(resp, ctx.Verbose))
+	headerBody = appendStrings(headerBody, separator, DumpResponseHeaders(resp, ctx.Verbose, redactor))
 	headerOutput, contentOutput := ctx.GetNextOutputsFromContext(index)
 
 	if ctx.HeadOnly {
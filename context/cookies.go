@@ -0,0 +1,439 @@
+package context
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	curlerrors "github.com/cdwiegand/go-curling/errors"
+	cookieJar "github.com/cdwiegand/persistent-cookiejar"
+	"golang.org/x/net/publicsuffix"
+)
+
+const COOKIE_FORMAT_AUTO = "auto"
+const COOKIE_FORMAT_NETSCAPE = "netscape"
+const COOKIE_FORMAT_JSON = "json"
+
+const netscapeHttpOnlyPrefix = "#HttpOnly_"
+const netscapeHeader = "# Netscape HTTP Cookie File\n# https://curl.se/docs/http-cookies.html\n# This file was generated by go-curling! Edit at your own risk.\n\n"
+
+// LoadCookieJar builds the jar used for the whole run, reading -c/--cookie-jar in whichever format it is in.
+func (ctx *CurlContext) LoadCookieJar() (*cookieJar.Jar, *curlerrors.CurlError) {
+	format, err := ctx.getCookieJarFormat()
+	if err != nil {
+		return nil, curlerrors.NewCurlErrorFromStringAndError(curlerrors.ERROR_INVALID_ARGS, "Invalid cookie jar format", err)
+	}
+	ctx.cookieJarFormat = format
+
+	options := &cookieJar.Options{
+		PublicSuffixList:      publicsuffix.List,
+		PersistSessionCookies: !ctx.JunkSessionCookies,
+	}
+	if format == COOKIE_FORMAT_JSON {
+		options.Filename = ctx.CookieJar // persistent-cookiejar reads (and later saves) its own format
+	}
+	jar, err := cookieJar.New(options)
+	if err != nil {
+		return nil, curlerrors.NewCurlErrorFromStringAndError(curlerrors.ERROR_CANNOT_READ_FILE, "Unable to create cookie jar", err)
+	}
+
+	if format == COOKIE_FORMAT_NETSCAPE && ctx.CookieJar != "" {
+		cookies, err := ReadNetscapeCookieFile(ctx.CookieJar)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, curlerrors.NewCurlErrorFromStringAndError(curlerrors.ERROR_CANNOT_READ_FILE, fmt.Sprintf("Unable to read cookie jar %s", ctx.CookieJar), err)
+		}
+		if ctx.JunkSessionCookies {
+			cookies = WithoutSessionCookies(cookies)
+		}
+		AddCookiesToJar(jar, cookies)
+	} else if ctx.JunkSessionCookies {
+		// curl's -j means "start a new session": anything without an expiry is dropped on load, not just on save
+		for _, c := range jar.AllCookies() {
+			if IsSessionCookie(c) {
+				jar.RemoveCookie(c)
+			}
+		}
+	}
+
+	ctx.cookiesAtLoad = nil // this run's own, not one shared with an earlier context
+	ctx.setCookiesAtLoad(JarCookies(jar))
+	return jar, nil
+}
+
+// shareCookieJar uses previous's cookie jar (see SetupContextForNextGroup) instead of loading another.
+func (ctx *CurlContext) shareCookieJar(previous *CurlContext) {
+	ctx.Jar = previous.Jar
+	ctx.cookieJarFormat = previous.cookieJarFormat
+	ctx.cookiesAtLoad = previous.cookiesAtLoad
+}
+
+// AddCookieFilesToJar loads every -b file into the run's jar once, so each request (including every
+// redirect hop) only gets the cookies whose domain, path, secure flag and expiry match it.
+func (ctx *CurlContext) AddCookieFilesToJar() {
+	if ctx.Jar == nil {
+		return
+	}
+	for _, cookie := range ctx.Cookies {
+		if !IsCookieFileArg(cookie) {
+			continue
+		}
+		fileCookies, err := ReadCookieFile(cookie)
+		if err != nil {
+			continue // curl silently ignores unreadable -b files
+		}
+		if ctx.JunkSessionCookies {
+			fileCookies = WithoutSessionCookies(fileCookies) // -j drops session cookies from -b files too, as curl does
+		}
+		AddCookiesToJar(ctx.Jar, fileCookies)
+	}
+}
+
+// IsCookieFileArg reports whether a -b value names a file rather than being a raw "name=value" cookie string.
+func IsCookieFileArg(cookie string) bool {
+	// curl does this, so... ugh, wish golang had .Net's System.IO.Path.Exists() in a safe way
+	return !strings.Contains(cookie, "=")
+}
+
+// SaveCookieJar writes the jar back to -c/--cookie-jar (if given), in the same format it was read in.
+// Several go-curling processes may share one jar, so the save holds an advisory lock on "<jar>.lock",
+// merges in whatever other processes saved since we loaded it, and replaces the file atomically.
+func (ctx *CurlContext) SaveCookieJar() error {
+	if ctx.Jar == nil || ctx.CookieJar == "" {
+		return nil
+	}
+
+	unlock, err := LockFile(ctx.CookieJar + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	cookies := ctx.mergeCookiesFromDisk(JarCookies(ctx.Jar))
+	if ctx.JunkSessionCookies {
+		cookies = WithoutSessionCookies(cookies)
+	}
+
+	if ctx.cookieJarFormat == COOKIE_FORMAT_JSON {
+		err = WriteFileAtomic(ctx.CookieJar, func(tmpPath string) error {
+			// let persistent-cookiejar write its own format, to the temp file
+			tmp, err := cookieJar.New(&cookieJar.Options{
+				PublicSuffixList:      publicsuffix.List,
+				Filename:              tmpPath,
+				PersistSessionCookies: !ctx.JunkSessionCookies,
+			})
+			if err != nil {
+				return err
+			}
+			AddCookiesToJar(tmp, cookies)
+			return tmp.Save()
+		})
+	} else {
+		err = WriteFileAtomic(ctx.CookieJar, func(tmpPath string) error {
+			return os.WriteFile(tmpPath, FormatNetscapeCookies(cookies), 0600)
+		})
+	}
+	if err != nil {
+		return err
+	}
+	ctx.setCookiesAtLoad(cookies) // the file now holds these, so a later save must treat them as if loaded
+	return nil
+}
+
+// setCookiesAtLoad records cookies as the jar file's contents (in place, as -: groups share the map).
+func (ctx *CurlContext) setCookiesAtLoad(cookies []*http.Cookie) {
+	if ctx.cookiesAtLoad == nil {
+		ctx.cookiesAtLoad = make(map[string]string)
+	}
+	clear(ctx.cookiesAtLoad)
+	for _, c := range cookies {
+		ctx.cookiesAtLoad[cookieKey(c)] = c.Value
+	}
+}
+
+// mergeCookiesFromDisk unions our cookies with the ones currently in the jar file. Ours win on
+// conflicts, and cookies we loaded but that were deleted (expired by a server) during this run
+// stay deleted unless another process has since changed them.
+func (ctx *CurlContext) mergeCookiesFromDisk(ours []*http.Cookie) []*http.Cookie {
+	onDisk, err := ReadCookieFile(ctx.CookieJar)
+	if err != nil {
+		return ours // nothing (readable) there yet
+	}
+
+	seen := make(map[string]bool)
+	for _, c := range ours {
+		seen[cookieKey(c)] = true
+	}
+	now := time.Now()
+	for _, c := range onDisk {
+		key := cookieKey(c)
+		if seen[key] {
+			continue
+		}
+		if loadedValue, wasLoaded := ctx.cookiesAtLoad[key]; wasLoaded && loadedValue == c.Value {
+			continue
+		}
+		if !IsSessionCookie(c) && c.Expires.Before(now) {
+			continue
+		}
+		ours = append(ours, c)
+	}
+	return ours
+}
+
+func cookieKey(c *http.Cookie) string {
+	path := c.Path
+	if path == "" {
+		path = "/"
+	}
+	return strings.ToLower(strings.TrimPrefix(c.Domain, ".")) + "\t" + path + "\t" + c.Name
+}
+
+// WriteFileAtomic has write create the new content at a temp path next to file, then renames it over
+// file so readers (and other processes) never see a partially written file.
+func WriteFileAtomic(file string, write func(tmpPath string) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(file), "."+filepath.Base(file)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	tmp.Close()
+	defer os.Remove(tmpPath) // no-op once renamed
+
+	if err := write(tmpPath); err != nil {
+		return err
+	}
+	if err := syncFile(tmpPath); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, file)
+}
+
+func syncFile(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0600) // #nosec G304
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
+
+func (ctx *CurlContext) getCookieJarFormat() (string, error) {
+	switch strings.ToLower(ctx.CookieJarFormat) {
+	case "", COOKIE_FORMAT_AUTO:
+		if ctx.CookieJar == "" {
+			return COOKIE_FORMAT_NETSCAPE, nil
+		}
+		return DetectCookieFileFormat(ctx.CookieJar), nil
+	case COOKIE_FORMAT_NETSCAPE, "curl", "txt":
+		return COOKIE_FORMAT_NETSCAPE, nil
+	case COOKIE_FORMAT_JSON:
+		return COOKIE_FORMAT_JSON, nil
+	default:
+		return "", fmt.Errorf("unknown cookie jar format %q (use auto, netscape or json)", ctx.CookieJarFormat)
+	}
+}
+
+// DetectCookieFileFormat sniffs a cookie file: persistent-cookiejar's JSON starts with [ or {, anything else
+// (including a missing or empty file) is treated as a Netscape/curl cookies.txt file.
+func DetectCookieFileFormat(path string) string {
+	data, err := os.ReadFile(path) // #nosec G304
+	if err != nil {
+		return COOKIE_FORMAT_NETSCAPE
+	}
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && (trimmed[0] == '[' || trimmed[0] == '{') {
+		return COOKIE_FORMAT_JSON
+	}
+	return COOKIE_FORMAT_NETSCAPE
+}
+
+// ReadCookieFile reads every cookie from a -b file, in either format.
+func ReadCookieFile(path string) ([]*http.Cookie, error) {
+	if DetectCookieFileFormat(path) == COOKIE_FORMAT_JSON {
+		tmp, err := cookieJar.New(&cookieJar.Options{
+			Filename: path,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return JarCookies(tmp), nil
+	}
+	return ReadNetscapeCookieFile(path)
+}
+
+func ReadNetscapeCookieFile(path string) ([]*http.Cookie, error) {
+	file, err := os.Open(path) // #nosec G304
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var ret []*http.Cookie
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		cookie := ParseNetscapeCookieLine(scanner.Text())
+		if cookie != nil {
+			ret = append(ret, cookie)
+		}
+	}
+	return ret, scanner.Err()
+}
+
+// ParseNetscapeCookieLine parses one cookies.txt line:
+// domain <TAB> include-subdomains <TAB> path <TAB> secure <TAB> expires <TAB> name <TAB> value
+// Comments, blank and malformed lines return nil. A leading dot on the domain (or
+// include-subdomains TRUE) makes it a domain cookie, otherwise it is host-only.
+func ParseNetscapeCookieLine(line string) *http.Cookie {
+	line = strings.TrimRight(line, "\r\n")
+	httpOnly := false
+	if strings.HasPrefix(line, netscapeHttpOnlyPrefix) {
+		httpOnly = true
+		line = strings.TrimPrefix(line, netscapeHttpOnlyPrefix)
+	}
+	if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+		return nil
+	}
+
+	fields := strings.Split(line, "\t")
+	if len(fields) == 6 {
+		fields = append(fields, "") // curl writes cookies with empty values without the trailing field
+	}
+	if len(fields) != 7 {
+		return nil
+	}
+
+	expires, err := strconv.ParseInt(fields[4], 10, 64)
+	if err != nil {
+		return nil
+	}
+
+	cookie := &http.Cookie{
+		Name:     fields[5],
+		Value:    fields[6],
+		Path:     fields[2],
+		Secure:   strings.EqualFold(fields[3], "TRUE"),
+		HttpOnly: httpOnly,
+	}
+	domain := fields[0]
+	if strings.EqualFold(fields[1], "TRUE") || strings.HasPrefix(domain, ".") {
+		cookie.Domain = "." + strings.TrimPrefix(domain, ".")
+	} else {
+		cookie.Domain = domain
+	}
+	if expires > 0 {
+		cookie.Expires = time.Unix(expires, 0)
+	}
+	return cookie
+}
+
+// AddCookiesToJar stores cookies read from a file into a jar so the jar's domain/path/secure matching applies to them.
+// As in cookies.txt, a leading dot on Domain marks a domain cookie, anything else is stored host-only.
+func AddCookiesToJar(jar http.CookieJar, cookies []*http.Cookie) {
+	for _, c := range cookies {
+		host := strings.TrimPrefix(c.Domain, ".")
+		if host == "" {
+			continue
+		}
+		scheme := "http"
+		if c.Secure {
+			scheme = "https"
+		}
+		path := c.Path
+		if path == "" {
+			path = "/"
+		}
+		stored := *c
+		if !strings.HasPrefix(c.Domain, ".") {
+			stored.Domain = "" // no Domain attribute == host-only cookie
+		}
+		jar.SetCookies(&url.URL{Scheme: scheme, Host: host, Path: path}, []*http.Cookie{&stored})
+	}
+}
+
+// FormatNetscapeCookies renders cookies as a curl-compatible cookies.txt file.
+func FormatNetscapeCookies(cookies []*http.Cookie) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(netscapeHeader)
+	for _, c := range cookies {
+		buf.WriteString(FormatNetscapeCookieLine(c))
+		buf.WriteString("\n")
+	}
+	return buf.Bytes()
+}
+
+// FormatNetscapeCookieLine renders one cookies.txt line; a leading dot on Domain marks a domain cookie.
+func FormatNetscapeCookieLine(c *http.Cookie) string {
+	domain := c.Domain
+	includeSubdomains := "FALSE"
+	if strings.HasPrefix(domain, ".") {
+		includeSubdomains = "TRUE"
+	}
+	if c.HttpOnly {
+		domain = netscapeHttpOnlyPrefix + domain
+	}
+	path := c.Path
+	if path == "" {
+		path = "/"
+	}
+	secure := "FALSE"
+	if c.Secure {
+		secure = "TRUE"
+	}
+	var expires int64
+	if !IsSessionCookie(c) {
+		expires = c.Expires.Unix()
+	}
+	return strings.Join([]string{domain, includeSubdomains, path, secure, strconv.FormatInt(expires, 10), c.Name, c.Value}, "\t")
+}
+
+// IsSessionCookie reports whether the cookie has no expiry. persistent-cookiejar reports session
+// cookies with an "end of time" expiry rather than a zero one, so both are treated as session cookies.
+func IsSessionCookie(c *http.Cookie) bool {
+	return c.Expires.IsZero() || c.Expires.Year() >= 9999
+}
+
+func WithoutSessionCookies(cookies []*http.Cookie) (ret []*http.Cookie) {
+	for _, c := range cookies {
+		if !IsSessionCookie(c) {
+			ret = append(ret, c)
+		}
+	}
+	return
+}
+
+// JarCookies returns every cookie in the jar, with a leading dot on Domain for domain (not host-only) cookies.
+func JarCookies(jar *cookieJar.Jar) []*http.Cookie {
+	cookies := jar.AllCookies()
+	for _, c := range cookies {
+		if isDomainCookie(jar, c) {
+			c.Domain = "." + strings.TrimPrefix(c.Domain, ".")
+		}
+	}
+	return cookies
+}
+
+// AllCookies() doesn't say whether a cookie was host-only, so ask the jar whether it would send it to a subdomain.
+func isDomainCookie(jar http.CookieJar, c *http.Cookie) bool {
+	domain := strings.TrimPrefix(c.Domain, ".")
+	if domain == "" {
+		return false
+	}
+	path := c.Path
+	if path == "" {
+		path = "/"
+	}
+	probe := &url.URL{Scheme: "https", Host: "go-curling-probe." + domain, Path: path}
+	for _, found := range jar.Cookies(probe) {
+		if found.Name == c.Name && found.Value == c.Value {
+			return true
+		}
+	}
+	return false
+}
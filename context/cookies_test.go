@@ -0,0 +1,215 @@
+package context
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testNetscapeCookies = "# Netscape HTTP Cookie File\n" +
+	"\n" +
+	".example.com\tTRUE\t/\tFALSE\t4102444800\tdomaincookie\tdomainvalue\n" +
+	"#HttpOnly_www.example.com\tFALSE\t/app\tTRUE\t4102444800\thttponly\tsecret\n" +
+	"www.example.com\tFALSE\t/\tFALSE\t0\tsession\tsessionvalue\n" +
+	"www.example.com\tFALSE\t/\tFALSE\t4102444800\tempty\n" +
+	"this line is not a cookie\n"
+
+func Test_ParseNetscapeCookieLine(t *testing.T) {
+	assert.Nil(t, ParseNetscapeCookieLine(""))
+	assert.Nil(t, ParseNetscapeCookieLine("# comment"))
+	assert.Nil(t, ParseNetscapeCookieLine("too\tfew\tfields"))
+
+	c := ParseNetscapeCookieLine("#HttpOnly_.example.com\tTRUE\t/path\tTRUE\t4102444800\tname\tvalue")
+	assert.NotNil(t, c)
+	assert.Equal(t, ".example.com", c.Domain)
+	assert.Equal(t, "/path", c.Path)
+	assert.True(t, c.Secure)
+	assert.True(t, c.HttpOnly)
+	assert.Equal(t, int64(4102444800), c.Expires.Unix())
+	assert.Equal(t, "name", c.Name)
+	assert.Equal(t, "value", c.Value)
+
+	c = ParseNetscapeCookieLine("host.example.com\tFALSE\t/\tFALSE\t0\tname\tvalue")
+	assert.Equal(t, "host.example.com", c.Domain)
+	assert.True(t, IsSessionCookie(c))
+}
+
+func Test_FormatNetscapeCookieLine(t *testing.T) {
+	c := &http.Cookie{Name: "a", Value: "b", Domain: ".example.com", Path: "/", HttpOnly: true, Secure: true, Expires: time.Unix(4102444800, 0)}
+	assert.Equal(t, "#HttpOnly_.example.com\tTRUE\t/\tTRUE\t4102444800\ta\tb", FormatNetscapeCookieLine(c))
+
+	c = &http.Cookie{Name: "a", Value: "b", Domain: "example.com"}
+	assert.Equal(t, "example.com\tFALSE\t/\tFALSE\t0\ta\tb", FormatNetscapeCookieLine(c))
+}
+
+func Test_DetectCookieFileFormat(t *testing.T) {
+	dir := t.TempDir()
+	jsonFile := filepath.Join(dir, "jar.json")
+	os.WriteFile(jsonFile, []byte("  [ ]"), 0600)
+	txtFile := filepath.Join(dir, "cookies.txt")
+	os.WriteFile(txtFile, []byte(testNetscapeCookies), 0600)
+
+	assert.Equal(t, COOKIE_FORMAT_JSON, DetectCookieFileFormat(jsonFile))
+	assert.Equal(t, COOKIE_FORMAT_NETSCAPE, DetectCookieFileFormat(txtFile))
+	assert.Equal(t, COOKIE_FORMAT_NETSCAPE, DetectCookieFileFormat(filepath.Join(dir, "missing")))
+}
+
+func Test_LoadCookieJar_Netscape(t *testing.T) {
+	jarFile := filepath.Join(t.TempDir(), "cookies.txt")
+	os.WriteFile(jarFile, []byte(testNetscapeCookies), 0600)
+
+	ctx := &CurlContext{CookieJar: jarFile}
+	jar, cerr := ctx.LoadCookieJar()
+	assert.Nil(t, cerr)
+
+	www, _ := url.Parse("https://www.example.com/app/page")
+	names := cookieNames(jar.Cookies(www))
+	assert.Contains(t, names, "domaincookie")
+	assert.Contains(t, names, "httponly")
+	assert.Contains(t, names, "session")
+	assert.Contains(t, names, "empty")
+
+	other, _ := url.Parse("http://other.example.com/")
+	names = cookieNames(jar.Cookies(other))
+	assert.Contains(t, names, "domaincookie")
+	assert.NotContains(t, names, "session", "host-only cookie must not reach other hosts")
+
+	// round trip through the writer keeps the format, the HttpOnly prefix and the domain flag
+	ctx.Jar = jar
+	assert.Nil(t, ctx.SaveCookieJar())
+	saved, _ := os.ReadFile(jarFile)
+	assert.True(t, strings.HasPrefix(string(saved), "# Netscape HTTP Cookie File"))
+	assert.Contains(t, string(saved), "#HttpOnly_www.example.com\tFALSE\t/app\tTRUE\t4102444800\thttponly\tsecret")
+	assert.Contains(t, string(saved), ".example.com\tTRUE\t/\tFALSE\t4102444800\tdomaincookie\tdomainvalue")
+}
+
+func Test_LoadCookieJar_JunkSessionCookies(t *testing.T) {
+	jarFile := filepath.Join(t.TempDir(), "cookies.txt")
+	os.WriteFile(jarFile, []byte(testNetscapeCookies), 0600)
+
+	ctx := &CurlContext{CookieJar: jarFile, JunkSessionCookies: true}
+	jar, cerr := ctx.LoadCookieJar()
+	assert.Nil(t, cerr)
+
+	www, _ := url.Parse("https://www.example.com/")
+	names := cookieNames(jar.Cookies(www))
+	assert.Contains(t, names, "domaincookie")
+	assert.NotContains(t, names, "session")
+}
+
+func Test_LoadCookieJar_InvalidFormat(t *testing.T) {
+	ctx := &CurlContext{CookieJarFormat: "yaml"}
+	_, cerr := ctx.LoadCookieJar()
+	assert.NotNil(t, cerr)
+}
+
+func cookieNames(cookies []*http.Cookie) (ret []string) {
+	for _, c := range cookies {
+		ret = append(ret, c.Name)
+	}
+	return
+}
+
+func Test_SaveCookieJar_ConcurrentSavesUnion(t *testing.T) {
+	jarFile := filepath.Join(t.TempDir(), "cookies.txt")
+	const writers = 8
+
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ctx := &CurlContext{CookieJar: jarFile}
+			jar, cerr := ctx.LoadCookieJar()
+			if cerr != nil {
+				t.Error(cerr)
+				return
+			}
+			ctx.Jar = jar
+			u, _ := url.Parse("https://www.example.com/")
+			jar.SetCookies(u, []*http.Cookie{{Name: fmt.Sprintf("writer%d", i), Value: "1", Expires: time.Now().Add(time.Hour)}})
+			if err := ctx.SaveCookieJar(); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	cookies, err := ReadNetscapeCookieFile(jarFile)
+	assert.Nil(t, err)
+	names := cookieNames(cookies)
+	for i := 0; i < writers; i++ {
+		assert.Contains(t, names, fmt.Sprintf("writer%d", i))
+	}
+	leftovers, _ := filepath.Glob(filepath.Join(filepath.Dir(jarFile), ".cookies.txt.*.tmp"))
+	assert.Empty(t, leftovers, "temp files should be renamed or removed")
+}
+
+func Test_SaveCookieJar_KeepsDeletionsAndOthersChanges(t *testing.T) {
+	jarFile := filepath.Join(t.TempDir(), "cookies.txt")
+	os.WriteFile(jarFile, []byte(testNetscapeCookies), 0600)
+
+	ctx := &CurlContext{CookieJar: jarFile}
+	jar, _ := ctx.LoadCookieJar()
+	ctx.Jar = jar
+
+	// another process adds a cookie after we loaded
+	other := &CurlContext{CookieJar: jarFile}
+	otherJar, _ := other.LoadCookieJar()
+	other.Jar = otherJar
+	u, _ := url.Parse("http://www.example.com/")
+	otherJar.SetCookies(u, []*http.Cookie{{Name: "fromother", Value: "1", Expires: time.Now().Add(time.Hour)}})
+	assert.Nil(t, other.SaveCookieJar())
+
+	// meanwhile the server expired one of ours
+	jar.SetCookies(u, []*http.Cookie{{Name: "session", Value: "", MaxAge: -1}})
+	assert.Nil(t, ctx.SaveCookieJar())
+
+	cookies, _ := ReadNetscapeCookieFile(jarFile)
+	names := cookieNames(cookies)
+	assert.Contains(t, names, "fromother")
+	assert.Contains(t, names, "domaincookie")
+	assert.NotContains(t, names, "session")
+}
+
+func Test_SaveCookieJar_KeepsDeletionsAcrossSaves(t *testing.T) {
+	jarFile := filepath.Join(t.TempDir(), "cookies.txt")
+	ctx := &CurlContext{CookieJar: jarFile}
+	jar, _ := ctx.LoadCookieJar()
+	ctx.Jar = jar
+
+	// set and saved by the first request, then expired by the server and saved again by a later one
+	u, _ := url.Parse("http://www.example.com/")
+	jar.SetCookies(u, []*http.Cookie{{Name: "short", Value: "1", Expires: time.Now().Add(time.Hour)}, {Name: "kept", Value: "1", Expires: time.Now().Add(time.Hour)}})
+	assert.Nil(t, ctx.SaveCookieJar())
+	jar.SetCookies(u, []*http.Cookie{{Name: "short", Value: "", MaxAge: -1}})
+	assert.Nil(t, ctx.SaveCookieJar())
+
+	cookies, _ := ReadNetscapeCookieFile(jarFile)
+	names := cookieNames(cookies)
+	assert.Contains(t, names, "kept")
+	assert.NotContains(t, names, "short", "a cookie this run saved, then deleted, must not come back from the file")
+}
+
+func Test_SaveCookieJar_Json(t *testing.T) {
+	jarFile := filepath.Join(t.TempDir(), "jar.json")
+	ctx := &CurlContext{CookieJar: jarFile, CookieJarFormat: COOKIE_FORMAT_JSON}
+	jar, _ := ctx.LoadCookieJar()
+	ctx.Jar = jar
+	u, _ := url.Parse("http://www.example.com/")
+	jar.SetCookies(u, []*http.Cookie{{Name: "a", Value: "b", Expires: time.Now().Add(time.Hour)}})
+	assert.Nil(t, ctx.SaveCookieJar())
+
+	assert.Equal(t, COOKIE_FORMAT_JSON, DetectCookieFileFormat(jarFile))
+	cookies, err := ReadCookieFile(jarFile)
+	assert.Nil(t, err)
+	assert.Contains(t, cookieNames(cookies), "a")
+}
@@ -0,0 +1,65 @@
+package context
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	curlerrors "github.com/cdwiegand/go-curling/errors"
+)
+
+// --ech modes, as curl names them
+const (
+	ECH_MODE_FALSE  = "false"  // never use ECH (the default)
+	ECH_MODE_GREASE = "grease" // send a fake ECH extension: Go's client can't, so this is the same as false
+	ECH_MODE_TRUE   = "true"   // use ECH when we have a config for the server, otherwise connect without it
+	ECH_MODE_HARD   = "hard"   // refuse to connect without ECH
+)
+
+// ConfigureEch applies --ech and --ech-config to config. Once an ECHConfigList is set Go will only complete
+// a handshake in which the server accepted ECH, so a rejection fails the request in both true and hard modes.
+// Configs are not looked up from HTTPS DNS records, as we resolve through the system resolver which can't.
+func (ctx *CurlContext) ConfigureEch(config *tls.Config) *curlerrors.CurlError {
+	mode := strings.ToLower(ctx.EchMode)
+	echConfig := ctx.EchConfig
+	if after, ok := strings.CutPrefix(ctx.EchMode, "ecl:"); ok { // curl's --ech ecl:BASE64 form
+		mode, echConfig = ECH_MODE_TRUE, after
+	}
+	switch mode {
+	case "", ECH_MODE_FALSE:
+		return nil
+	case ECH_MODE_GREASE:
+		ctx.tlsNotes.add("ECH GREASE is not supported, connecting without ECH")
+		return nil
+	case ECH_MODE_TRUE, ECH_MODE_HARD:
+	default:
+		return curlerrors.NewCurlErrorFromString(curlerrors.ERROR_INVALID_ARGS, fmt.Sprintf("Unsupported --ech mode %s, expected false, grease, true, hard or ecl:BASE64", ctx.EchMode))
+	}
+
+	if echConfig == "" {
+		if mode == ECH_MODE_HARD {
+			return curlerrors.NewCurlErrorFromString(curlerrors.ERROR_SSL_ECH_REQUIRED, "--ech hard requires an ECHConfigList from --ech-config")
+		}
+		ctx.tlsNotes.add("ECH not attempted: no --ech-config given")
+		return nil
+	}
+	list, err := base64.StdEncoding.DecodeString(echConfig)
+	if err != nil {
+		return curlerrors.NewCurlErrorFromStringAndError(curlerrors.ERROR_INVALID_ARGS, "Invalid --ech-config, expected base64 ECHConfigList", err)
+	}
+	if config.MaxVersion != 0 && config.MaxVersion < tls.VersionTLS13 {
+		return curlerrors.NewCurlErrorFromString(curlerrors.ERROR_INVALID_ARGS, "--ech requires TLS 1.3, but --tls-max is lower")
+	}
+	config.MinVersion = tls.VersionTLS13
+	config.EncryptedClientHelloConfigList = list
+	return nil
+}
+
+// describeEchRejection adds the server's retry configs (if any) to a rejected-ECH error, ready for --ech-config.
+func describeEchRejection(err *tls.ECHRejectionError) string {
+	if len(err.RetryConfigList) == 0 {
+		return "server rejected ECH and offered no retry configs"
+	}
+	return "server rejected ECH, retry with --ech-config " + base64.StdEncoding.EncodeToString(err.RetryConfigList)
+}
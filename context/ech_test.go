@@ -0,0 +1,96 @@
+package context
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	curlerrors "github.com/cdwiegand/go-curling/errors"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/cryptobyte"
+)
+
+// newEchKey returns an ECH server key and its ECHConfigList (draft-ietf-tls-esni-18, X25519/HKDF-SHA256/AES-128-GCM).
+func newEchKey(t *testing.T, publicName string) (tls.EncryptedClientHelloKey, []byte) {
+	t.Helper()
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b cryptobyte.Builder
+	b.AddUint16(0xfe0d) // version
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddUint8(1)       // config_id
+		b.AddUint16(0x0020) // DHKEM(X25519, HKDF-SHA256)
+		b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes(key.PublicKey().Bytes()) })
+		b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddUint16(0x0001) // HKDF-SHA256
+			b.AddUint16(0x0001) // AES-128-GCM
+		})
+		b.AddUint8(0) // maximum_name_length
+		b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes([]byte(publicName)) })
+		b.AddUint16(0) // no extensions
+	})
+	config := b.BytesOrPanic()
+
+	var list cryptobyte.Builder
+	list.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes(config) })
+	return tls.EncryptedClientHelloKey{Config: config, PrivateKey: key.Bytes(), SendAsRetry: true}, list.BytesOrPanic()
+}
+
+func Test_Ech(t *testing.T) {
+	ca := newTestCA(t, "ECH CA")
+	caFile := ca.writeCert(t)
+	echKey, echConfigList := newEchKey(t, "public.test")
+	echConfig := base64.StdEncoding.EncodeToString(echConfigList)
+	var accepted bool
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { accepted = r.TLS.ECHAccepted })
+	srv := newTestTLSServer(t, ca.issue(t, "public.test", false, time.Hour), handler, func(c *tls.Config) {
+		c.EncryptedClientHelloKeys = []tls.EncryptedClientHelloKey{echKey}
+	})
+	url := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+
+	assert.Nil(t, pinnedRequest(t, &CurlContext{CaCertFile: []string{caFile}, EchMode: "true", EchConfig: echConfig}, url))
+	assert.True(t, accepted)
+	assert.Nil(t, pinnedRequest(t, &CurlContext{CaCertFile: []string{caFile}, EchMode: "ecl:" + echConfig}, url))
+	assert.True(t, accepted)
+
+	for _, mode := range []string{"", "false", "grease", "true"} { // no config: plain TLS
+		assert.Nil(t, pinnedRequest(t, &CurlContext{CaCertFile: []string{caFile}, EchMode: mode}, url), mode)
+		assert.False(t, accepted, mode)
+	}
+
+	cerr := pinnedRequest(t, &CurlContext{CaCertFile: []string{caFile}, EchMode: "hard"}, url)
+	assert.Equal(t, curlerrors.ERROR_SSL_ECH_REQUIRED, cerr.ExitCode)
+	cerr = pinnedRequest(t, &CurlContext{CaCertFile: []string{caFile}, EchMode: "true", EchConfig: "not base64!"}, url)
+	assert.Equal(t, curlerrors.ERROR_INVALID_ARGS, cerr.ExitCode)
+	cerr = pinnedRequest(t, &CurlContext{CaCertFile: []string{caFile}, EchMode: "maybe"}, url)
+	assert.Equal(t, curlerrors.ERROR_INVALID_ARGS, cerr.ExitCode)
+	cerr = pinnedRequest(t, &CurlContext{CaCertFile: []string{caFile}, EchMode: "true", EchConfig: echConfig, Tls_MaxVersionString: "1.2"}, url)
+	assert.Equal(t, curlerrors.ERROR_INVALID_ARGS, cerr.ExitCode)
+}
+
+func Test_Ech_Rejected(t *testing.T) {
+	ca := newTestCA(t, "ECH CA")
+	caFile := ca.writeCert(t)
+	_, staleConfigList := newEchKey(t, "public.test")
+	serverKey, _ := newEchKey(t, "public.test")
+	srv := newTestTLSServer(t, ca.issue(t, "public.test", false, time.Hour), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), func(c *tls.Config) {
+		c.EncryptedClientHelloKeys = []tls.EncryptedClientHelloKey{serverKey}
+	})
+	url := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+
+	cerr := pinnedRequest(t, &CurlContext{CaCertFile: []string{caFile}, EchMode: "true", EchConfig: base64.StdEncoding.EncodeToString(staleConfigList)}, url)
+	assert.Equal(t, curlerrors.ERROR_SSL_ECH_REQUIRED, cerr.ExitCode)
+	assert.Contains(t, cerr.ErrorString, "retry with --ech-config ")
+}
+
+func Test_DumpTlsDetails_Ech(t *testing.T) {
+	res := DumpTlsDetails(&tls.ConnectionState{Version: tls.VersionTLS13, ECHAccepted: true})
+	assert.Contains(t, res, "TLS ECH: accepted")
+}
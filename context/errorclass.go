@@ -0,0 +1,76 @@
+package context
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	curlerrors "github.com/cdwiegand/go-curling/errors"
+)
+
+// ClassifyRequestError maps an error from http.Client.Do onto the curlerrors code (and so curl exit code) for it.
+func ClassifyRequestError(err error) int {
+	var echErr *tls.ECHRejectionError
+	var verifyErr *tls.CertificateVerificationError
+	var alertErr tls.AlertError
+	var recordErr tls.RecordHeaderError
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var certInvalidErr x509.CertificateInvalidError
+	var dnsErr *net.DNSError
+	var opErr *net.OpError
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, ErrPinnedPubKeyMismatch) || errors.Is(err, ErrProxyPinnedPubKeyMismatch):
+		return curlerrors.ERROR_SSL_PINNED_PUBKEY_MISMATCH
+	case errors.Is(err, ErrCipherNotAllowed):
+		return curlerrors.ERROR_SSL_CIPHER
+	case errors.Is(err, ErrCertStatus):
+		return curlerrors.ERROR_SSL_INVALID_CERT_STATUS
+	case errors.Is(err, ErrCertRevoked):
+		return curlerrors.ERROR_SSL_CERT_REVOKED
+	case errors.As(err, &echErr):
+		return curlerrors.ERROR_SSL_ECH_REQUIRED
+	case errors.As(err, &verifyErr) || errors.As(err, &unknownAuthorityErr) || errors.As(err, &hostnameErr) || errors.As(err, &certInvalidErr):
+		return curlerrors.ERROR_SSL_PEER_VERIFICATION
+	case errors.Is(err, context.Canceled): // the caller (a library user's context.Context) gave up on it
+		return curlerrors.ERROR_ABORTED
+	case errors.As(err, &opErr) && opErr.Op == "proxyconnect": // the transport's wrapper for failing to reach the proxy
+		if errors.As(err, &dnsErr) {
+			return curlerrors.ERROR_COULDNT_RESOLVE_PROXY
+		}
+		return curlerrors.ERROR_COULDNT_CONNECT
+	case errors.As(err, &dnsErr):
+		return curlerrors.ERROR_COULDNT_RESOLVE_HOST
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()):
+		return curlerrors.ERROR_OPERATION_TIMEDOUT
+	case errors.As(err, &alertErr) || errors.As(err, &recordErr) || errors.Is(err, http.ErrSchemeMismatch):
+		return curlerrors.ERROR_SSL_CONNECT
+	case errors.As(err, &opErr) && opErr.Op == "dial":
+		return curlerrors.ERROR_COULDNT_CONNECT
+	case errors.Is(err, io.EOF): // the server closed the connection without responding
+		return curlerrors.ERROR_GOT_NOTHING
+	case strings.Contains(err.Error(), "unsupported protocol scheme"): // a plain error from net/http, so only its text tells
+		return curlerrors.ERROR_UNSUPPORTED_PROTOCOL
+	}
+	return curlerrors.ERROR_NO_RESPONSE
+}
+
+// GetExitCode is the process exit code for cerr: curl's, or with --legacy-exit-codes the one go-curling used to return.
+func (ctx *CurlContext) GetExitCode(cerr *curlerrors.CurlError) int {
+	if cerr == nil {
+		return 0
+	}
+	if ctx.LegacyExitCodes {
+		return curlerrors.LegacyExitCode(cerr.ExitCode)
+	}
+	return curlerrors.CurlExitCode(cerr.ExitCode)
+}
@@ -0,0 +1,120 @@
+package context
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	curlerrors "github.com/cdwiegand/go-curling/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func requestErrorCode(t *testing.T, url string) int {
+	t.Helper()
+	client, cerr := (&CurlContext{}).BuildClient()
+	assert.Nil(t, cerr)
+	request, _ := http.NewRequest("GET", url, nil)
+	return GetCurlResponse(client, request, nil).ErrorCode
+}
+
+func Test_ClassifyRequestError(t *testing.T) {
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer plain.Close()
+	untrusted := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer untrusted.Close()
+	hangup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+	}))
+	defer hangup.Close()
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	closedPort := listener.Addr().String()
+	listener.Close()
+
+	assert.Equal(t, 0, requestErrorCode(t, plain.URL))
+	assert.Equal(t, curlerrors.ERROR_COULDNT_CONNECT, requestErrorCode(t, "http://"+closedPort+"/"))
+	assert.Equal(t, curlerrors.ERROR_COULDNT_RESOLVE_HOST, requestErrorCode(t, "http://does-not-exist.invalid/"))
+	assert.Equal(t, curlerrors.ERROR_UNSUPPORTED_PROTOCOL, requestErrorCode(t, "ftp://example.com/"))
+	assert.Equal(t, curlerrors.ERROR_SSL_PEER_VERIFICATION, requestErrorCode(t, untrusted.URL))
+	assert.Equal(t, curlerrors.ERROR_SSL_CONNECT, requestErrorCode(t, "https://"+plain.Listener.Addr().String()+"/"))
+	assert.Equal(t, curlerrors.ERROR_GOT_NOTHING, requestErrorCode(t, hangup.URL))
+
+	assert.Equal(t, curlerrors.ERROR_OPERATION_TIMEDOUT, ClassifyRequestError(fmt.Errorf("Get: %w", context.DeadlineExceeded)))
+	assert.Equal(t, curlerrors.ERROR_SSL_PINNED_PUBKEY_MISMATCH, ClassifyRequestError(fmt.Errorf("%w: abc", ErrPinnedPubKeyMismatch)))
+	assert.Equal(t, curlerrors.ERROR_COULDNT_RESOLVE_PROXY, ClassifyRequestError(&net.OpError{Op: "proxyconnect", Err: &net.DNSError{Name: "proxy"}}))
+	assert.Equal(t, curlerrors.ERROR_COULDNT_CONNECT, ClassifyRequestError(&net.OpError{Op: "proxyconnect", Err: errors.New("connection refused")}))
+	assert.Equal(t, curlerrors.ERROR_NO_RESPONSE, ClassifyRequestError(errors.New("something else")))
+	assert.Equal(t, curlerrors.ERROR_NO_RESPONSE, ClassifyRequestError(errors.New("tls: not a TLS error at all, just saying so")))
+	assert.Equal(t, curlerrors.ERROR_SSL_PEER_VERIFICATION, ClassifyRequestError(fmt.Errorf("verify: %w", x509.HostnameError{Certificate: &x509.Certificate{}, Host: "example.com"})))
+	assert.Equal(t, curlerrors.ERROR_SSL_PEER_VERIFICATION, ClassifyRequestError(x509.UnknownAuthorityError{}))
+	assert.Equal(t, curlerrors.ERROR_SSL_CONNECT, ClassifyRequestError(fmt.Errorf("handshake: %w", tls.AlertError(40))))
+}
+
+func Test_ClassifyRequestError_Cancelled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	client, _ := (&CurlContext{}).BuildClient()
+	request, _ := http.NewRequestWithContext(ctx, "GET", srv.URL, nil)
+	code := GetCurlResponse(client, request, nil).ErrorCode
+	assert.Equal(t, curlerrors.ERROR_ABORTED, code)
+
+	cerr := curlerrors.NewCurlErrorFromString(code, "cancelled")
+	assert.Equal(t, 42, (&CurlContext{}).GetExitCode(cerr))
+	assert.Equal(t, curlerrors.ERROR_NO_RESPONSE, (&CurlContext{LegacyExitCodes: true}).GetExitCode(cerr))
+	assert.Equal(t, curlerrors.CATEGORY_ABORTED, cerr.Category)
+}
+
+func Test_GetExitCode(t *testing.T) {
+	cerr := curlerrors.NewCurlErrorFromString(curlerrors.ERROR_COULDNT_RESOLVE_HOST, "no such host")
+	assert.Equal(t, 6, (&CurlContext{}).GetExitCode(cerr))
+	assert.Equal(t, curlerrors.ERROR_NO_RESPONSE, (&CurlContext{LegacyExitCodes: true}).GetExitCode(cerr))
+	assert.Equal(t, 0, (&CurlContext{}).GetExitCode(nil))
+
+	cerr = curlerrors.NewCurlErrorFromString(curlerrors.ERROR_CERT_EXPIRING, "expires soon")
+	assert.Equal(t, 120, (&CurlContext{}).GetExitCode(cerr))
+}
+
+func Test_GetExitCode_TlsErrorsDistinct(t *testing.T) {
+	// conditions curl itself reports with one exit code, so go-curling does too
+	sameInCurl := map[int]int{
+		curlerrors.ERROR_SSL_SYSTEM_FAILURE: curlerrors.ERROR_SSL_CACERT_BADFILE,    // CURLE_SSL_CACERT_BADFILE
+		curlerrors.ERROR_SSL_CERT_REVOKED:   curlerrors.ERROR_SSL_PEER_VERIFICATION, // CURLE_PEER_FAILED_VERIFICATION
+	}
+	seen := map[int]int{}
+	for code := curlerrors.ERROR_INTERNAL; code >= curlerrors.ERROR_ABORTED; code-- {
+		cerr := curlerrors.NewCurlErrorFromString(code, "")
+		if cerr.Category != curlerrors.CATEGORY_TLS {
+			continue
+		}
+		exitCode := (&CurlContext{}).GetExitCode(cerr)
+		if other, ok := seen[exitCode]; ok && sameInCurl[code] != other && sameInCurl[other] != code {
+			t.Errorf("TLS errors %d and %d share exit code %d", other, code, exitCode)
+		}
+		seen[exitCode] = code
+	}
+}
+
+func Test_GetCompleteResponse_ErrorWrapsCause(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://does-not-exist.invalid/", http.StatusFound)
+	}))
+	defer srv.Close()
+	ctx := &CurlContext{FollowRedirects: true}
+	client, _ := ctx.BuildClient()
+	request, _ := ctx.BuildHttpRequest(srv.URL, 1, true, true)
+	_, cerr := ctx.GetCompleteResponse(1, client, request)
+
+	var dnsErr *net.DNSError
+	assert.True(t, errors.As(cerr, &dnsErr))
+	assert.Equal(t, curlerrors.CATEGORY_DNS, cerr.Category)
+	assert.Equal(t, 1, cerr.UrlIndex)
+	assert.Equal(t, 1, cerr.Hop) // failed following the redirect
+}
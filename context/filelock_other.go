@@ -0,0 +1,38 @@
+//go:build !unix
+
+package context
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+const lockFileTimeout = 30 * time.Second
+const lockFileStaleAfter = 2 * time.Minute
+
+// LockFile takes an exclusive lock on path, blocking until it is available. Without flock we rely
+// on O_EXCL creation of the lock file; a lock file older than lockFileStaleAfter is assumed to be
+// left behind by a crashed process and is removed. The returned func releases it.
+func LockFile(path string) (func(), error) {
+	deadline := time.Now().Add(lockFileTimeout)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600) // #nosec G304
+		if err == nil {
+			f.Close()
+			return func() { _ = os.Remove(path) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		if info, statErr := os.Stat(path); statErr == nil && time.Since(info.ModTime()) > lockFileStaleAfter {
+			_ = os.Remove(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for lock %s", path)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
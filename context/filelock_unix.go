@@ -0,0 +1,26 @@
+//go:build unix
+
+package context
+
+import (
+	"os"
+	"syscall"
+)
+
+// LockFile takes an exclusive advisory (flock) lock on path, creating it if needed, blocking until
+// it is available. The returned func releases it. The lock file itself is left in place, as removing
+// it would let a waiting process lock an unlinked file.
+func LockFile(path string) (func(), error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600) // #nosec G304
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil { // #nosec G115
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		_ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN) // #nosec G115
+		f.Close()
+	}, nil
+}
@@ -0,0 +1,81 @@
+package context
+
+import (
+	"compress/gzip"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+)
+
+// handlerTransport sends requests straight to an http.Handler instead of over the network, as if the handler were
+// the server every URL pointed at: redirects, cookies, retries and output all work as usual, with no sockets.
+type handlerTransport struct {
+	handler            http.Handler
+	disableCompression bool
+}
+
+func (t *handlerTransport) RoundTrip(req *http.Request) (resp *http.Response, err error) {
+	if err := req.Context().Err(); err != nil {
+		return nil, err
+	}
+
+	// what a server would see of the request
+	serverReq := req.Clone(req.Context())
+	serverReq.Proto, serverReq.ProtoMajor, serverReq.ProtoMinor = "HTTP/1.1", 1, 1
+	serverReq.RequestURI = req.URL.RequestURI()
+	serverReq.RemoteAddr = "192.0.2.1:1234" // as httptest.NewRequest, a TEST-NET-1 address
+	if serverReq.Host == "" {
+		serverReq.Host = req.URL.Host
+	}
+	if serverReq.Body == nil {
+		serverReq.Body = http.NoBody
+	}
+	if req.ContentLength > 0 {
+		serverReq.Header.Set("Content-Length", strconv.FormatInt(req.ContentLength, 10))
+	}
+	// ask for (and transparently decompress) gzip as http.Transport would, so --compressed behaves the same
+	requestedGzip := false
+	if !t.disableCompression && req.Header.Get("Accept-Encoding") == "" && req.Header.Get("Range") == "" && req.Method != "HEAD" {
+		requestedGzip = true
+		serverReq.Header.Set("Accept-Encoding", "gzip")
+	}
+	if req.URL.Scheme == "https" {
+		serverReq.TLS = &tls.ConnectionState{Version: tls.VersionTLS13, HandshakeComplete: true, ServerName: req.URL.Hostname()}
+	}
+
+	defer func() {
+		// a real server would drop the connection, which the client sees as no response
+		if r := recover(); r != nil {
+			resp, err = nil, fmt.Errorf("handler panicked: %v", r)
+		}
+	}()
+	recorder := httptest.NewRecorder()
+	t.handler.ServeHTTP(recorder, serverReq)
+
+	resp = recorder.Result()
+	resp.Request = req
+	if requestedGzip && resp.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = &gzipBody{Reader: gz, body: resp.Body}
+		resp.Header.Del("Content-Encoding")
+		resp.Header.Del("Content-Length")
+		resp.ContentLength = -1
+		resp.Uncompressed = true
+	}
+	return resp, nil
+}
+
+type gzipBody struct {
+	*gzip.Reader
+	body io.ReadCloser
+}
+
+func (b *gzipBody) Close() error {
+	return b.body.Close()
+}
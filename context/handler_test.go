@@ -0,0 +1,169 @@
+package context
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	curlerrors "github.com/cdwiegand/go-curling/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func handlerResponses(t *testing.T, ctx *CurlContext, url string) (*CurlResponses, *CurlResponse) {
+	t.Helper()
+	client, cerr := ctx.BuildClient()
+	if !assert.Nil(t, cerr) {
+		t.FailNow()
+	}
+	request, cerr := ctx.BuildHttpRequest(url, 0, true, true)
+	if !assert.Nil(t, cerr) {
+		t.FailNow()
+	}
+	resps, _ := ctx.GetCompleteResponse(0, client, request)
+	return resps, resps.Responses[len(resps.Responses)-1]
+}
+
+func Test_Handler_RedirectsCookiesAndRetries(t *testing.T) {
+	attempts := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc", Path: "/"})
+		http.Redirect(w, r, "/report", http.StatusFound)
+	})
+	mux.HandleFunc("/report", func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		cookie, _ := r.Cookie("session")
+		_, _ = io.WriteString(w, "session="+cookie.Value+" host="+r.Host+" remote="+r.RemoteAddr)
+	})
+	ctx := &CurlContext{Handler: mux, FollowRedirects: true, MaxRetries: 1}
+	assert.Nil(t, ctx.SetupContextForRun([]string{"http://service.test/login"}))
+
+	resps, last := handlerResponses(t, ctx, "")
+	assert.Len(t, resps.Responses, 3, "the redirect, then the report twice")
+	assert.Equal(t, http.StatusOK, last.HttpResponse.StatusCode)
+	body, _ := io.ReadAll(last.HttpResponse.Body)
+	assert.Equal(t, "session=abc host=service.test remote=192.0.2.1:1234", string(body))
+}
+
+func Test_Handler_RedirectAuthentication(t *testing.T) {
+	authSeen := map[string]string{}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authSeen[r.Host+r.URL.Path] = r.Header.Get("Authorization")
+		switch r.URL.Path {
+		case "/start":
+			http.Redirect(w, r, "/same", http.StatusFound)
+		case "/same":
+			http.Redirect(w, r, "http://other.test/dest", http.StatusFound)
+		}
+	})
+	for _, trusted := range []bool{false, true} {
+		clear(authSeen)
+		ctx := &CurlContext{Handler: handler, FollowRedirects: true, UserAuth: "hello:world", RedirectsKeepAuthenticationHeaders: trusted}
+		assert.Nil(t, ctx.SetupContextForRun([]string{"http://service.test/start"}))
+		handlerResponses(t, ctx, "")
+
+		assert.Equal(t, "Basic aGVsbG86d29ybGQ=", authSeen["service.test/start"])
+		assert.Equal(t, "Basic aGVsbG86d29ybGQ=", authSeen["service.test/same"], "same host, so still trusted")
+		if trusted {
+			assert.Equal(t, "Basic aGVsbG86d29ybGQ=", authSeen["other.test/dest"], "--location-trusted")
+		} else {
+			assert.Contains(t, authSeen, "other.test/dest")
+			assert.Empty(t, authSeen["other.test/dest"], "another host only gets credentials with --location-trusted")
+		}
+	}
+}
+
+func Test_Handler_CancelWhileWaitingToRetry(t *testing.T) {
+	attempts := 0
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	ctx := &CurlContext{Handler: handler, MaxRetries: 3, RetryDelaySeconds: 60}
+	assert.Nil(t, ctx.SetupContextForRun([]string{"http://service.test/"}))
+	client, cerr := ctx.BuildClient()
+	if !assert.Nil(t, cerr) {
+		return
+	}
+	request, cerr := ctx.BuildHttpRequest(ctx.Urls[0], 0, true, true)
+	if !assert.Nil(t, cerr) {
+		return
+	}
+	reqCtx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	started := time.Now()
+	resps, cerr := ctx.GetCompleteResponse(0, client, request.WithContext(reqCtx))
+	assert.Less(t, time.Since(started), 10*time.Second, "the wait to retry must end with the request's context")
+	assert.Equal(t, 1, attempts)
+	assert.True(t, resps.IsError)
+	if assert.NotNil(t, cerr) {
+		assert.Equal(t, curlerrors.ERROR_OPERATION_TIMEDOUT, cerr.ExitCode)
+	}
+}
+
+func Test_Handler_SeesRequestAsServerWould(t *testing.T) {
+	var got *http.Request
+	var gotBody string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		b, _ := io.ReadAll(r.Body)
+		gotBody = string(b)
+	})
+	ctx := &CurlContext{Handler: handler, Data_Json: []string{`{"a":1}`}}
+	assert.Nil(t, ctx.SetupContextForRun([]string{"https://service.test/items?x=1"}))
+
+	_, last := handlerResponses(t, ctx, "")
+	assert.Nil(t, last.Error)
+	assert.Equal(t, "POST", got.Method)
+	assert.Equal(t, "/items?x=1", got.RequestURI)
+	assert.Equal(t, "application/json", got.Header.Get("Content-Type"))
+	assert.Equal(t, "7", got.Header.Get("Content-Length"))
+	assert.Equal(t, `{"a":1}`, gotBody)
+	assert.NotNil(t, got.TLS, "an https URL looks like TLS to the handler")
+	assert.Nil(t, last.HttpResponse.TLS)
+}
+
+func Test_Handler_PanicAndCancel(t *testing.T) {
+	transport := &handlerTransport{handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})}
+	request, _ := http.NewRequest("GET", "http://service.test/", nil)
+	resp, err := transport.RoundTrip(request)
+	assert.Nil(t, resp)
+	assert.ErrorContains(t, err, "handler panicked: boom")
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = transport.RoundTrip(request.WithContext(cancelled))
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func Test_Handler_Compressed(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept-Encoding") != "gzip" {
+			_, _ = io.WriteString(w, "plain")
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		_, _ = io.WriteString(gz, "unzipped")
+		_ = gz.Close()
+	})
+
+	for compressed, want := range map[bool]string{true: "unzipped", false: "plain"} {
+		ctx := &CurlContext{Handler: handler, EnableCompression: compressed}
+		assert.Nil(t, ctx.SetupContextForRun([]string{"http://service.test/"}))
+		_, last := handlerResponses(t, ctx, "")
+		body, _ := io.ReadAll(last.HttpResponse.Body)
+		assert.Equal(t, want, string(body))
+		assert.Empty(t, last.HttpResponse.Header.Get("Content-Encoding"))
+	}
+}
@@ -0,0 +1,32 @@
+package context
+
+import (
+	"os"
+	"sync"
+)
+
+// keyLogWriter appends NSS key log lines (tls.Config.KeyLogWriter) to a file, opening it for each
+// write, so nothing is left open once the run is over (it isn't output, so doesn't go to an OutputWriter).
+type keyLogWriter struct {
+	mu   sync.Mutex
+	file string
+}
+
+func (w *keyLogWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	f, err := os.OpenFile(w.file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600) // #nosec G304
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return f.Write(p)
+}
+
+// getKeyLogFile is --keylog, or else the SSLKEYLOGFILE environment variable browsers and curl honour.
+func (ctx *CurlContext) getKeyLogFile() string {
+	if ctx.KeyLogFile != "" {
+		return ctx.KeyLogFile
+	}
+	return os.Getenv("SSLKEYLOGFILE")
+}
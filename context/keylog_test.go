@@ -0,0 +1,46 @@
+package context
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_TlsServerName(t *testing.T) {
+	ca := newTestCA(t, "SNI CA")
+	caFile := ca.writeCert(t)
+	var sni string
+	srv := newTestTLSServer(t, ca.issue(t, "origin.test", false, time.Hour), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sni = r.TLS.ServerName
+	}), nil)
+
+	assert.Nil(t, pinnedRequest(t, &CurlContext{CaCertFile: []string{caFile}, TlsServerName: "origin.test"}, srv.URL))
+	assert.Equal(t, "origin.test", sni)
+
+	// the certificate is verified against --tls-servername, not the URL's host
+	assert.NotNil(t, pinnedRequest(t, &CurlContext{CaCertFile: []string{caFile}, TlsServerName: "other.test"}, srv.URL))
+}
+
+func Test_KeyLogFile(t *testing.T) {
+	ca := newTestCA(t, "Key Log CA")
+	caFile := ca.writeCert(t)
+	srv := newTestTLSServer(t, ca.issue(t, "origin.test", false, time.Hour), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), nil)
+
+	keyLog := filepath.Join(t.TempDir(), "keys.log")
+	assert.Nil(t, pinnedRequest(t, &CurlContext{CaCertFile: []string{caFile}, KeyLogFile: keyLog}, srv.URL))
+	data, err := os.ReadFile(keyLog)
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), "CLIENT_HANDSHAKE_TRAFFIC_SECRET ")
+
+	// SSLKEYLOGFILE is used when --keylog isn't given
+	envLog := filepath.Join(t.TempDir(), "env.log")
+	t.Setenv("SSLKEYLOGFILE", envLog)
+	assert.Nil(t, pinnedRequest(t, &CurlContext{CaCertFile: []string{caFile}}, srv.URL))
+	data, err = os.ReadFile(envLog)
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), "CLIENT_TRAFFIC_SECRET_0 ")
+}
@@ -1,39 +1,186 @@
 package context
 
 import (
+	"bytes"
+	"errors"
+	"io"
+	"maps"
 	"os"
+	"slices"
+	"sync"
 )
 
-func (ctx *CurlContext) WriteToFileBytes(file string, body []byte) (err error) {
-	if ctx.filesAlreadyStartedWriting == nil {
-		ctx.filesAlreadyStartedWriting = make(map[string]*os.File)
+// CurlOutputWriter is where everything go-curling outputs goes: bodies, header dumps, verbose output and errors.
+// file is the -o/-D/--stderr target, standardized (see standardizeFileName) to /dev/null, /dev/stdout, /dev/stderr
+// or a file path; a writer ignores targets it doesn't handle.
+type CurlOutputWriter interface {
+	WriteToFileBytes(file string, body []byte) error
+}
+
+// NewDefaultOutputWriter writes as the command line does: /dev/stdout and /dev/stderr to the process's, and
+// everything else to files.
+func NewDefaultOutputWriter() CurlOutputWriter {
+	return NewTeeOutputWriter(NewStdioOutputWriter(os.Stdout, os.Stderr), NewFileOutputWriter())
+}
+
+func (ctx *CurlContext) getOutputWriter() CurlOutputWriter {
+	if ctx.OutputWriter == nil {
+		ctx.OutputWriter = NewDefaultOutputWriter()
+	}
+	return ctx.OutputWriter
+}
+
+// WriteToFileBytes writes to the context's OutputWriter, the default one if none was set.
+func (ctx *CurlContext) WriteToFileBytes(file string, body []byte) error {
+	return ctx.getOutputWriter().WriteToFileBytes(file, body)
+}
+
+// WriteToErrorOutput writes to --stderr.
+func (ctx *CurlContext) WriteToErrorOutput(body []byte) error {
+	return ctx.WriteToFileBytes(standardizeFileName(ctx.ErrorOutput), body)
+}
+
+// CloseOutputs closes the OutputWriter (so any files it has open), if it can be closed.
+func (ctx *CurlContext) CloseOutputs() error {
+	if closer, ok := ctx.OutputWriter.(io.Closer); ok {
+		return closer.Close()
 	}
+	return nil
+}
+
+// StdioOutputWriter writes /dev/stdout and /dev/stderr, ignoring files.
+type StdioOutputWriter struct {
+	mu     sync.Mutex
+	Stdout io.Writer
+	Stderr io.Writer
+}
 
+func NewStdioOutputWriter(stdout io.Writer, stderr io.Writer) *StdioOutputWriter {
+	return &StdioOutputWriter{Stdout: stdout, Stderr: stderr}
+}
+
+func (w *StdioOutputWriter) WriteToFileBytes(file string, body []byte) (err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
 	switch file {
-	case "", "/dev/null":
-		// do nothing
-	case "/dev/stderr":
-		_, err = os.Stderr.Write(body)
 	case "/dev/stdout":
-		_, err = os.Stdout.Write(body)
-	default:
-		fileref, found := ctx.filesAlreadyStartedWriting[file]
-		if !found || fileref == nil {
-			// first write to this file: create and truncate so we don't leave stale trailing bytes
-			fileref, err = os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600) // #nosec G304
-			if err != nil {
-				return err
-			}
-			ctx.filesAlreadyStartedWriting[file] = fileref
-		} else {
-			// subsequent writes append to what we already started
-			fileref, err = os.OpenFile(file, os.O_WRONLY|os.O_APPEND, 0600) // #nosec G304
-			if err != nil {
-				return err
-			}
-		}
-		defer fileref.Close()
-		_, err = fileref.Write(body)
+		_, err = w.Stdout.Write(body)
+	case "/dev/stderr":
+		_, err = w.Stderr.Write(body)
 	}
 	return
 }
+
+// FileOutputWriter writes files, ignoring /dev/null, /dev/stdout and /dev/stderr. A file is created (or truncated)
+// by the first write to it, and kept open for the rest until Close.
+type FileOutputWriter struct {
+	mu    sync.Mutex
+	files map[string]*os.File
+}
+
+func NewFileOutputWriter() *FileOutputWriter {
+	return &FileOutputWriter{files: make(map[string]*os.File)}
+}
+
+func (w *FileOutputWriter) WriteToFileBytes(file string, body []byte) error {
+	switch file {
+	case "", "/dev/null", "/dev/stdout", "/dev/stderr":
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	fileref, found := w.files[file]
+	if !found {
+		// first write to this file: create and truncate so we don't leave stale trailing bytes
+		var err error
+		fileref, err = os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600) // #nosec G304
+		if err != nil {
+			return err
+		}
+		w.files[file] = fileref
+	}
+	_, err := fileref.Write(body)
+	return err
+}
+
+func (w *FileOutputWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var errs []error
+	for file, fileref := range w.files {
+		errs = append(errs, fileref.Close())
+		delete(w.files, file)
+	}
+	return errors.Join(errs...)
+}
+
+// MemoryOutputWriter keeps everything written to each target (but /dev/null), for library users and tests to read
+// back instead of going through files.
+type MemoryOutputWriter struct {
+	mu      sync.Mutex
+	outputs map[string]*bytes.Buffer
+}
+
+func NewMemoryOutputWriter() *MemoryOutputWriter {
+	return &MemoryOutputWriter{outputs: make(map[string]*bytes.Buffer)}
+}
+
+func (w *MemoryOutputWriter) WriteToFileBytes(file string, body []byte) error {
+	if file == "" || file == "/dev/null" {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	buf, found := w.outputs[file]
+	if !found {
+		buf = &bytes.Buffer{}
+		w.outputs[file] = buf
+	}
+	buf.Write(body)
+	return nil
+}
+
+// Bytes is everything written to file (a standardized name, as passed to WriteToFileBytes), nil if nothing was.
+func (w *MemoryOutputWriter) Bytes(file string) []byte {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if buf, found := w.outputs[file]; found {
+		return bytes.Clone(buf.Bytes())
+	}
+	return nil
+}
+
+// Files lists every target written to.
+func (w *MemoryOutputWriter) Files() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return slices.Sorted(maps.Keys(w.outputs))
+}
+
+// TeeOutputWriter writes to each of its writers in turn, all of them even if one fails.
+type TeeOutputWriter struct {
+	Writers []CurlOutputWriter
+}
+
+func NewTeeOutputWriter(writers ...CurlOutputWriter) *TeeOutputWriter {
+	return &TeeOutputWriter{Writers: writers}
+}
+
+func (w *TeeOutputWriter) WriteToFileBytes(file string, body []byte) error {
+	var errs []error
+	for _, writer := range w.Writers {
+		errs = append(errs, writer.WriteToFileBytes(file, body))
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes those of its writers that can be.
+func (w *TeeOutputWriter) Close() error {
+	var errs []error
+	for _, writer := range w.Writers {
+		if closer, ok := writer.(io.Closer); ok {
+			errs = append(errs, closer.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,63 @@
+package context
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_FileOutputWriter(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "out")
+	assert.Nil(t, os.WriteFile(file, []byte("stale contents, longer than the new"), 0600))
+
+	w := NewFileOutputWriter()
+	assert.Nil(t, w.WriteToFileBytes(file, []byte("one ")))
+	assert.Nil(t, w.WriteToFileBytes(file, []byte("two")))
+	assert.Nil(t, w.WriteToFileBytes("/dev/stdout", []byte("not a file")))
+	assert.Nil(t, w.Close())
+
+	// #nosec G304
+	got, err := os.ReadFile(file)
+	assert.Nil(t, err)
+	assert.Equal(t, "one two", string(got), "truncated by the first write, appended to after")
+
+	assert.NotNil(t, w.WriteToFileBytes(filepath.Join(t.TempDir(), "no", "such", "dir"), []byte("x")))
+}
+
+func Test_StdioOutputWriter(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	w := NewStdioOutputWriter(&stdout, &stderr)
+	assert.Nil(t, w.WriteToFileBytes("/dev/stdout", []byte("body")))
+	assert.Nil(t, w.WriteToFileBytes("/dev/stderr", []byte("error")))
+	assert.Nil(t, w.WriteToFileBytes(filepath.Join(t.TempDir(), "file"), []byte("ignored")))
+	assert.Equal(t, "body", stdout.String())
+	assert.Equal(t, "error", stderr.String())
+}
+
+func Test_MemoryAndTeeOutputWriter(t *testing.T) {
+	first := NewMemoryOutputWriter()
+	second := NewMemoryOutputWriter()
+	w := NewTeeOutputWriter(first, second)
+	assert.Nil(t, w.WriteToFileBytes("/dev/stdout", []byte("a")))
+	assert.Nil(t, w.WriteToFileBytes("/dev/stdout", []byte("b")))
+	assert.Nil(t, w.WriteToFileBytes("headers.txt", []byte("c")))
+	assert.Nil(t, w.WriteToFileBytes("/dev/null", []byte("d")))
+
+	for _, m := range []*MemoryOutputWriter{first, second} {
+		assert.Equal(t, "ab", string(m.Bytes("/dev/stdout")))
+		assert.Equal(t, "c", string(m.Bytes("headers.txt")))
+		assert.Nil(t, m.Bytes("/dev/null"))
+		assert.Equal(t, []string{"/dev/stdout", "headers.txt"}, m.Files())
+	}
+	assert.Nil(t, w.Close())
+}
+
+func Test_WriteToErrorOutput(t *testing.T) {
+	m := NewMemoryOutputWriter()
+	ctx := &CurlContext{ErrorOutput: "-", OutputWriter: m}
+	assert.Nil(t, ctx.WriteToErrorOutput([]byte("oops")))
+	assert.Equal(t, "oops", string(m.Bytes("/dev/stdout")), "--stderr - is stdout")
+}
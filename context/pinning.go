@@ -0,0 +1,128 @@
+package context
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	curlerrors "github.com/cdwiegand/go-curling/errors"
+)
+
+const pinnedPubKeyHashPrefix = "sha256//"
+
+// ErrPinnedPubKeyMismatch is returned (wrapped) from the TLS handshake when --pinnedpubkey doesn't match.
+var ErrPinnedPubKeyMismatch = errors.New("server public key does not match --pinnedpubkey")
+
+// ErrProxyPinnedPubKeyMismatch is returned (wrapped) from the TLS handshake when --proxy-pinnedpubkey doesn't match.
+var ErrProxyPinnedPubKeyMismatch = errors.New("proxy public key does not match --proxy-pinnedpubkey")
+
+// ParsePinnedPubKeys parses a curl --pinnedpubkey value into the SHA-256 hashes of the allowed
+// SubjectPublicKeyInfo structures. It is either "sha256//BASE64;sha256//BASE64..." or the path to
+// a PEM or DER file holding a public key (or a certificate, whose public key is used).
+func ParsePinnedPubKeys(value string) ([][]byte, error) {
+	if strings.HasPrefix(value, pinnedPubKeyHashPrefix) {
+		var ret [][]byte
+		for _, h := range strings.Split(value, ";") {
+			h = strings.TrimSpace(h)
+			if !strings.HasPrefix(h, pinnedPubKeyHashPrefix) {
+				return nil, fmt.Errorf("pinned public key %q must start with %s", h, pinnedPubKeyHashPrefix)
+			}
+			hash, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(h, pinnedPubKeyHashPrefix))
+			if err != nil {
+				return nil, fmt.Errorf("pinned public key %q is not valid base64: %w", h, err)
+			}
+			if len(hash) != sha256.Size {
+				return nil, fmt.Errorf("pinned public key %q is not a SHA-256 hash", h)
+			}
+			ret = append(ret, hash)
+		}
+		return ret, nil
+	}
+
+	data, err := os.ReadFile(value) // #nosec G304
+	if err != nil {
+		return nil, err
+	}
+	spki, err := extractSubjectPublicKeyInfo(data)
+	if err != nil {
+		return nil, fmt.Errorf("no public key found in %s: %w", value, err)
+	}
+	hash := sha256.Sum256(spki)
+	return [][]byte{hash[:]}, nil
+}
+
+func extractSubjectPublicKeyInfo(data []byte) ([]byte, error) {
+	der := data
+	if block, _ := pem.Decode(data); block != nil {
+		der = block.Bytes
+	}
+	if _, err := x509.ParsePKIXPublicKey(der); err == nil {
+		return der, nil
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return cert.RawSubjectPublicKeyInfo, nil
+}
+
+// PublicKeyPin returns the sha256//BASE64 pin for a certificate, as --pinnedpubkey expects it.
+func PublicKeyPin(cert *x509.Certificate) string {
+	hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return pinnedPubKeyHashPrefix + base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// BuildPinnedPubKeyVerifiers returns tls.Config.VerifyConnection hooks checking the leaf's public key against
+// --pinnedpubkey (for the origin's config) and --proxy-pinnedpubkey (for an HTTPS proxy's), nil for either not
+// given. VerifyConnection runs on every handshake even with -k, and for every connection (so every redirect hop).
+func (ctx *CurlContext) BuildPinnedPubKeyVerifiers() (origin func(tls.ConnectionState) error, proxy func(tls.ConnectionState) error, cerr *curlerrors.CurlError) {
+	if ctx.PinnedPubKey != "" {
+		pins, err := ParsePinnedPubKeys(ctx.PinnedPubKey)
+		if err != nil {
+			return nil, nil, curlerrors.NewCurlErrorFromStringAndError(curlerrors.ERROR_INVALID_ARGS, "Invalid --pinnedpubkey", err)
+		}
+		origin = func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return ErrPinnedPubKeyMismatch
+			}
+			if !containsHash(pins, publicKeyHash(cs.PeerCertificates[0])) {
+				return fmt.Errorf("%w (%s presented %s)", ErrPinnedPubKeyMismatch, cs.ServerName, PublicKeyPin(cs.PeerCertificates[0]))
+			}
+			return nil
+		}
+	}
+	if ctx.ProxyPinnedPubKey != "" {
+		pins, err := ParsePinnedPubKeys(ctx.ProxyPinnedPubKey)
+		if err != nil {
+			return nil, nil, curlerrors.NewCurlErrorFromStringAndError(curlerrors.ERROR_INVALID_ARGS, "Invalid --proxy-pinnedpubkey", err)
+		}
+		proxy = func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 || !containsHash(pins, publicKeyHash(cs.PeerCertificates[0])) {
+				return fmt.Errorf("%w (%s)", ErrProxyPinnedPubKeyMismatch, cs.ServerName)
+			}
+			return nil
+		}
+	}
+	return origin, proxy, nil
+}
+
+func publicKeyHash(cert *x509.Certificate) []byte {
+	hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return hash[:]
+}
+
+func containsHash(pins [][]byte, hash []byte) bool {
+	for _, p := range pins {
+		if bytes.Equal(p, hash) {
+			return true
+		}
+	}
+	return false
+}
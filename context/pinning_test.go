@@ -0,0 +1,129 @@
+package context
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	curlerrors "github.com/cdwiegand/go-curling/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func pinnedRequest(t *testing.T, ctx *CurlContext, url string) *curlerrors.CurlError {
+	t.Helper()
+	client, cerr := ctx.BuildClient()
+	if cerr != nil {
+		return cerr
+	}
+	request, cerr := ctx.BuildHttpRequest(url, 0, true, true)
+	if cerr != nil {
+		return cerr
+	}
+	_, cerr = ctx.GetCompleteResponse(0, client, request)
+	return cerr
+}
+
+func Test_ParsePinnedPubKeys(t *testing.T) {
+	hash := sha256.Sum256([]byte("hello"))
+	pin := "sha256//" + base64.StdEncoding.EncodeToString(hash[:])
+
+	pins, err := ParsePinnedPubKeys(pin + ";" + pin)
+	assert.Nil(t, err)
+	assert.Len(t, pins, 2)
+	assert.Equal(t, hash[:], pins[0])
+
+	_, err = ParsePinnedPubKeys("sha256//not*base64")
+	assert.Error(t, err)
+	_, err = ParsePinnedPubKeys("sha256//aGVsbG8=") // valid base64, but not 32 bytes
+	assert.Error(t, err)
+	_, err = ParsePinnedPubKeys(pin + ";md5//abc")
+	assert.Error(t, err)
+	_, err = ParsePinnedPubKeys(filepath.Join(t.TempDir(), "missing.pem"))
+	assert.Error(t, err)
+}
+
+func Test_PinnedPubKey_WithInsecure(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/start" {
+			http.Redirect(w, r, "/dest", http.StatusFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+	goodPin := PublicKeyPin(srv.Certificate())
+	badHash := sha256.Sum256([]byte("not the key"))
+	badPin := "sha256//" + base64.StdEncoding.EncodeToString(badHash[:])
+
+	ctx := &CurlContext{IgnoreBadCerts: true, FollowRedirects: true, PinnedPubKey: badPin + ";" + goodPin}
+	assert.Nil(t, pinnedRequest(t, ctx, srv.URL+"/start"))
+
+	ctx = &CurlContext{IgnoreBadCerts: true, PinnedPubKey: badPin}
+	cerr := pinnedRequest(t, ctx, srv.URL+"/start")
+	assert.NotNil(t, cerr)
+	assert.Equal(t, curlerrors.ERROR_SSL_PINNED_PUBKEY_MISMATCH, cerr.ExitCode)
+}
+
+func Test_PinnedPubKey_FromFile(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	pemFile := filepath.Join(dir, "key.pem")
+	os.WriteFile(pemFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: srv.Certificate().RawSubjectPublicKeyInfo}), 0600)
+	derFile := filepath.Join(dir, "cert.der")
+	os.WriteFile(derFile, srv.Certificate().Raw, 0600)
+
+	assert.Nil(t, pinnedRequest(t, &CurlContext{IgnoreBadCerts: true, PinnedPubKey: pemFile}, srv.URL))
+	assert.Nil(t, pinnedRequest(t, &CurlContext{IgnoreBadCerts: true, PinnedPubKey: derFile}, srv.URL))
+
+	// a redirect to a server with a different key is caught on that hop
+	ca := newTestCA(t, "Pinning Test CA")
+	other := newTestTLSServer(t, ca.issue(t, "other", false, time.Hour), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, srv.URL, http.StatusFound)
+	}), nil)
+	cerr := pinnedRequest(t, &CurlContext{IgnoreBadCerts: true, FollowRedirects: true, PinnedPubKey: PublicKeyPin(other.Certificate())}, other.URL)
+	if assert.NotNil(t, cerr) {
+		assert.Equal(t, curlerrors.ERROR_SSL_PINNED_PUBKEY_MISMATCH, cerr.ExitCode)
+	}
+}
+
+func Test_PinnedPubKey_ProxyOnSameHost(t *testing.T) {
+	ca := newTestCA(t, "Proxy pinning test CA")
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	originCert := ca.issue(t, "127.0.0.1", false, time.Hour)
+	proxyCert := ca.issue(t, "127.0.0.1", false, time.Hour)
+	origin := newTestTLSServer(t, originCert, handler, nil)
+	proxy := newTestHttpsProxy(t, proxyCert)
+	originPin := PublicKeyPin(originCert.Leaf)
+	proxyPin := PublicKeyPin(proxyCert.Leaf)
+
+	// both are 127.0.0.1, so only the connection tells the two handshakes apart
+	ctx := viaProxy(&CurlContext{IgnoreBadCerts: true, PinnedPubKey: originPin, ProxyPinnedPubKey: proxyPin}, proxy)
+	assert.Nil(t, pinnedRequest(t, ctx, origin.URL))
+
+	ctx = viaProxy(&CurlContext{IgnoreBadCerts: true, PinnedPubKey: proxyPin, ProxyPinnedPubKey: proxyPin}, proxy)
+	cerr := pinnedRequest(t, ctx, origin.URL)
+	if assert.NotNil(t, cerr, "the origin's key must be checked even though the proxy shares its host") {
+		assert.Equal(t, curlerrors.ERROR_SSL_PINNED_PUBKEY_MISMATCH, cerr.ExitCode)
+	}
+
+	ctx = viaProxy(&CurlContext{IgnoreBadCerts: true, PinnedPubKey: originPin, ProxyPinnedPubKey: originPin}, proxy)
+	cerr = pinnedRequest(t, ctx, origin.URL)
+	if assert.NotNil(t, cerr) {
+		assert.Equal(t, curlerrors.ERROR_SSL_PINNED_PUBKEY_MISMATCH, cerr.ExitCode)
+		assert.Contains(t, cerr.ErrorString, "--proxy-pinnedpubkey")
+	}
+
+	// --tls-servername is the origin's name, so naming the proxy's host doesn't move the origin's pin onto it
+	ctx = viaProxy(&CurlContext{IgnoreBadCerts: true, TlsServerName: "127.0.0.1", PinnedPubKey: proxyPin}, proxy)
+	assert.NotNil(t, pinnedRequest(t, ctx, origin.URL))
+}
@@ -0,0 +1,21 @@
+package context
+
+import (
+	"crypto"
+	"crypto/x509"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// ErrPkcs12IncorrectPassword is returned when the bundle's MAC (or a decryption) fails with the password given.
+var ErrPkcs12IncorrectPassword = pkcs12.ErrIncorrectPassword
+
+// DecodePkcs12 returns the private key and every certificate in a .p12/.pfx bundle, the leaf first. Both OpenSSL 3's
+// default (PBES2/AES with a SHA-256 MAC) and the older 3DES and RC2 bundles are understood.
+func DecodePkcs12(data []byte, password string) (crypto.PrivateKey, []*x509.Certificate, error) {
+	key, leaf, chain, err := pkcs12.DecodeChain(data, password)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, append([]*x509.Certificate{leaf}, chain...), nil
+}
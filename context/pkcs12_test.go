@@ -0,0 +1,43 @@
+package context
+
+import (
+	"crypto/rsa"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_DecodePkcs12(t *testing.T) {
+	// client.p12 is OpenSSL 3's default (PBES2/AES-256, SHA-256 MAC), client-3des.pfx the older
+	// 3DES/SHA-1 one and client-legacy.p12 uses RC2-40 for certificates
+	for _, file := range []string{"testdata/client.p12", "testdata/client-3des.pfx", "testdata/client-legacy.p12"} {
+		data, err := os.ReadFile(file)
+		assert.Nil(t, err)
+		key, certs, err := DecodePkcs12(data, "secret")
+		assert.Nil(t, err, file)
+		assert.IsType(t, &rsa.PrivateKey{}, key, file)
+		if assert.Len(t, certs, 2, file) {
+			assert.Equal(t, "go-curling test client", certs[0].Subject.CommonName, file)
+			assert.Equal(t, "go-curling test intermediate", certs[1].Subject.CommonName, file)
+		}
+
+		_, _, err = DecodePkcs12(data, "wrong")
+		assert.ErrorIs(t, err, ErrPkcs12IncorrectPassword, file)
+	}
+}
+
+func Test_DecodePkcs12_EmptyPassword(t *testing.T) {
+	data, err := os.ReadFile("testdata/client-nopass.p12")
+	assert.Nil(t, err)
+	key, certs, err := DecodePkcs12(data, "")
+	assert.Nil(t, err)
+	assert.NotNil(t, key)
+	assert.Len(t, certs, 2)
+}
+
+func Test_DecodePkcs12_NotPkcs12(t *testing.T) {
+	data, _ := os.ReadFile("testdata/client.pem")
+	_, _, err := DecodePkcs12(data, "secret")
+	assert.Error(t, err)
+}
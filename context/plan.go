@@ -0,0 +1,196 @@
+package context
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	curlerrors "github.com/cdwiegand/go-curling/errors"
+)
+
+// RequestPlan is one request to send: its method, headers and body as worked out from the context's options for
+// one URL. Planning never changes the context, so what one URL needs (a -T upload's PUT and Content-Type, say)
+// can't leak into the next URL, and each redirect plans its own request.
+type RequestPlan struct {
+	Index       int
+	Url         string
+	Method      string
+	Headers     []string // "Name: value": -H's first, then defaults only for names they don't have
+	Cookies     []string // -b name=value cookies, each sent as its own Cookie header
+	Body        []byte   // nil when there is no body
+	UserAuth    string   // user:password for basic auth, the password already prompted for if it wasn't given
+	BearerToken string
+}
+
+func (plan *RequestPlan) setMethodIfNotSet(httpMethod string) {
+	if plan.Method == "" {
+		plan.Method = httpMethod
+	}
+}
+
+// setHeader replaces any headers of the same name.
+func (plan *RequestPlan) setHeader(headerName string, headerValue string) {
+	plan.Headers = slices.DeleteFunc(plan.Headers, func(h string) bool {
+		name, _, _ := strings.Cut(h, ":")
+		return strings.EqualFold(strings.TrimSpace(name), headerName)
+	})
+	plan.Headers = append(plan.Headers, headerName+": "+headerValue)
+}
+
+func (plan *RequestPlan) setHeaderIfNotSet(headerName string, headerValue string) {
+	for _, h := range plan.Headers {
+		parts := strings.SplitN(h, ":", 2)
+		if len(parts) == 2 && strings.EqualFold(strings.TrimSpace(parts[0]), headerName) {
+			return
+		}
+	}
+	plan.Headers = append(plan.Headers, headerName+": "+headerValue)
+}
+
+// PlanRequest works out the request for the index'th URL (or url, if given, such as a redirect's Location).
+// Without submitAuthenticationHeaders (a redirect to another host, without --location-trusted) it has no
+// credentials: neither -u's nor --oauth2-bearer's, nor any Authorization or Cookie header given with -H.
+// A --session's headers and auth are added for its own host only (see sessionFor).
+func (ctx *CurlContext) PlanRequest(url string, index int, submitDataFormsPostContents bool, submitAuthenticationHeaders bool) (*RequestPlan, *curlerrors.CurlError) {
+	if url == "" && index < len(ctx.Urls) {
+		url = ctx.Urls[index]
+	}
+	plan := &RequestPlan{Index: index, Url: url, Method: ctx.HttpVerb, Headers: slices.Clone(ctx.Headers)}
+	session := ctx.sessionFor(plan.Url)
+	if session != nil {
+		for _, h := range session.Headers { // command line wins over anything stored
+			name, value, found := strings.Cut(h, ":")
+			if found {
+				plan.setHeaderIfNotSet(strings.TrimSpace(name), strings.TrimSpace(value))
+			}
+		}
+	}
+
+	// must run BEFORE the method defaults to GET below (as they may set it to POST/PUT if not explicitly set)
+	// fixme: add support for mixing them (upload file vs all others?)
+	if submitDataFormsPostContents {
+		if len(ctx.Upload_File) > index {
+			body, cerr := ctx.HandleUploadRawFile(plan, index)
+			if cerr != nil {
+				return nil, cerr
+			}
+			plan.Body = body.Bytes()
+		} else if ctx.HasFormArgs() {
+			body, cerr := ctx.HandleFormMultipart(plan)
+			if cerr != nil {
+				return nil, cerr
+			}
+			plan.Body = body.Bytes()
+		} else if ctx.HasDataArgs() {
+			bodyData, cerr := ctx.HandleDataArgs(plan, ctx.ConvertPostFormIntoGet)
+			if cerr != nil {
+				return nil, cerr
+			}
+			if ctx.ConvertPostFormIntoGet {
+				plan.setMethodIfNotSet("GET")
+				if strings.Contains(plan.Url, "?") {
+					plan.Url += "&"
+				} else {
+					plan.Url += "?"
+				}
+				plan.Url += bodyData.String()
+			} else {
+				plan.Body = bodyData.Bytes()
+			}
+		}
+	}
+	// this should be after all other changes to method!
+	plan.setMethodIfNotSet("GET")
+	plan.Method = strings.ToUpper(plan.Method)
+
+	if ctx.UserAgent != "" {
+		plan.setHeader("User-Agent", ctx.UserAgent)
+	}
+	if ctx.Referer != "" {
+		plan.setHeader("Referer", ctx.Referer)
+	}
+	plan.setHeaderIfNotSet("Accept", "*/*") // curl default, so matching
+
+	for _, cookie := range ctx.Cookies {
+		// -b files were loaded into the jar by AddCookieFilesToJar, which the client applies per request/hop
+		if !IsCookieFileArg(cookie) {
+			plan.Cookies = append(plan.Cookies, cookie)
+		}
+	}
+
+	if !submitAuthenticationHeaders {
+		plan.Headers = slices.DeleteFunc(plan.Headers, func(h string) bool {
+			name, _, _ := strings.Cut(h, ":")
+			name = strings.TrimSpace(name)
+			return strings.EqualFold(name, "Authorization") || strings.EqualFold(name, "Cookie")
+		})
+		return plan, nil
+	}
+	userAuth, cerr := ctx.getUserAuth()
+	if cerr != nil {
+		return nil, cerr
+	}
+	plan.UserAuth = userAuth
+	plan.BearerToken = ctx.OAuth2_BearerToken
+	if session != nil {
+		plan.UserAuth = cmp.Or(plan.UserAuth, session.Auth.User)
+		plan.BearerToken = cmp.Or(plan.BearerToken, session.Auth.BearerToken)
+	}
+	return plan, nil
+}
+
+// NewHttpRequest is the request the plan describes; call it again for a fresh body, as sending one consumes it.
+func (plan *RequestPlan) NewHttpRequest() *http.Request {
+	var body io.Reader
+	if plan.Body != nil {
+		body = bytes.NewReader(plan.Body) // also sets GetBody, so retries and 307/308 redirects can resend it
+	}
+	// url comes from the user's command line (this is a curl-like client whose purpose is
+	// to fetch user-specified URLs), not from an untrusted remote input, so the SSRF taint
+	// warning does not apply here.
+	request, _ := http.NewRequest(plan.Method, plan.Url, body) // #nosec G704
+
+	for _, h := range plan.Headers {
+		parts := strings.SplitN(h, ":", 2)
+		if len(parts) == 2 {
+			// trim the OWS around the name/value so "Name: value" does not send
+			// a leading space in the value (curl trims it; servers strip it too)
+			request.Header.Set(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+		}
+	}
+	for _, cookie := range plan.Cookies {
+		request.Header.Add("Cookie", cookie)
+	}
+	if plan.UserAuth != "" {
+		auths := strings.SplitN(plan.UserAuth, ":", 2)
+		request.SetBasicAuth(auths[0], auths[1])
+	}
+	if request.Header.Get("Authorization") == "" && plan.BearerToken != "" {
+		request.Header.Set("Authorization", "Bearer "+plan.BearerToken)
+	}
+	return request
+}
+
+// getUserAuth is -u's user:password. Given just a user, the password is prompted for once, then reused for every
+// request; ctx.UserAuth is left as given (so a session doesn't save the typed password).
+func (ctx *CurlContext) getUserAuth() (string, *curlerrors.CurlError) {
+	if ctx.UserAuth == "" || strings.Contains(ctx.UserAuth, ":") { // this way password can contain a :
+		return ctx.UserAuth, nil
+	}
+	if ctx.promptedUserAuth != "" {
+		return ctx.promptedUserAuth, nil
+	}
+	if ctx.IsSilent || ctx.SilentFail {
+		return "", curlerrors.NewCurlErrorFromString(curlerrors.ERROR_INVALID_ARGS, "User auth requires username:password format, operating quiet so not prompting for value.")
+	}
+	_ = ctx.WriteToErrorOutput([]byte("Enter password: ")) // not stdout, which may well be the response body's
+	reader := bufio.NewReader(os.Stdin)
+	input, _ := reader.ReadString('\n') // if unable to read, use blank instead
+	ctx.promptedUserAuth = ctx.UserAuth + ":" + strings.TrimRight(input, "\r\n")
+	return ctx.promptedUserAuth, nil
+}
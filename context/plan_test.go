@@ -0,0 +1,99 @@
+package context
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_PlanRequest_DoesNotChangeContext(t *testing.T) {
+	ctx := &CurlContext{Urls: []string{"http://localhost/one", "http://localhost/two"}}
+	ctx.Data_Json = []string{`{"a":1}`}
+	ctx.Headers = []string{"X-Test: yes"}
+
+	plan, cerr := ctx.PlanRequest("", 0, true, true)
+	assert.Nil(t, cerr)
+	assert.Equal(t, "POST", plan.Method)
+	assert.Equal(t, []string{"X-Test: yes", "Accept: application/json", "Content-Type: application/json"}, plan.Headers)
+	assert.Equal(t, `{"a":1}`, string(plan.Body))
+
+	// a redirect that drops the data doesn't inherit the POST or the JSON headers
+	plan, cerr = ctx.PlanRequest("http://localhost/elsewhere", 0, false, true)
+	assert.Nil(t, cerr)
+	assert.Equal(t, "GET", plan.Method)
+	assert.Equal(t, []string{"X-Test: yes", "Accept: */*"}, plan.Headers)
+	assert.Nil(t, plan.Body)
+
+	assert.Empty(t, ctx.HttpVerb)
+	assert.Equal(t, []string{"X-Test: yes"}, ctx.Headers)
+}
+
+func Test_PlanRequest_HeadersAndMethod(t *testing.T) {
+	ctx := &CurlContext{Urls: []string{"http://localhost/"}}
+	ctx.Headers = []string{"user-agent: from-header", "Accept: text/plain"}
+	ctx.UserAgent = "from-flag"
+	ctx.HttpVerb = "HEAD"
+
+	plan, cerr := ctx.PlanRequest("", 0, true, true)
+	assert.Nil(t, cerr)
+	assert.Equal(t, "HEAD", plan.Method)
+	request := plan.NewHttpRequest()
+	assert.Equal(t, "from-flag", request.Header.Get("User-Agent"), "-A wins over -H")
+	assert.Equal(t, "text/plain", request.Header.Get("Accept"), "-H wins over the default")
+
+	ctx.HttpVerb = "patch"
+	plan, _ = ctx.PlanRequest("", 0, true, true)
+	assert.Equal(t, "PATCH", plan.Method, "an explicit -X wins")
+}
+
+func Test_PlanRequest_NewHttpRequestResendsBody(t *testing.T) {
+	ctx := &CurlContext{Urls: []string{"http://localhost/"}}
+	ctx.Data_RawAsIs = []string{"a=b"}
+	plan, cerr := ctx.PlanRequest("", 0, true, true)
+	assert.Nil(t, cerr)
+
+	for range 2 {
+		request := plan.NewHttpRequest()
+		body, err := request.GetBody()
+		assert.Nil(t, err)
+		buf := make([]byte, 10)
+		n, _ := body.Read(buf)
+		assert.Equal(t, "a=b", string(buf[:n]))
+	}
+}
+
+func Test_getUserAuth_PromptsOnce(t *testing.T) {
+	ctx := &CurlContext{Urls: []string{"http://localhost/"}}
+	ctx.UserAuth = "alice"
+	ctx.promptedUserAuth = "alice:typed" // as if already prompted for
+
+	plan, cerr := ctx.PlanRequest("", 0, true, true)
+	assert.Nil(t, cerr)
+	assert.Equal(t, "alice:typed", plan.UserAuth)
+	assert.Equal(t, "alice", ctx.UserAuth, "the typed password isn't written back to -u")
+
+	ctx.UserAuth = "bob:given"
+	auth, cerr := ctx.getUserAuth()
+	assert.Nil(t, cerr)
+	assert.Equal(t, "bob:given", auth)
+}
+
+func Test_PlanRequest_PasswordPromptToStderr(t *testing.T) {
+	stdin, typed, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(saved *os.File) { os.Stdin = saved }(os.Stdin)
+	os.Stdin = stdin
+	_, _ = typed.WriteString("secret\n")
+	typed.Close()
+
+	outputs := NewMemoryOutputWriter()
+	ctx := &CurlContext{Urls: []string{"http://localhost/"}, UserAuth: "hello", ErrorOutput: DEFAULT_STDERR, OutputWriter: outputs}
+	plan, cerr := ctx.PlanRequest("", 0, true, true)
+	assert.Nil(t, cerr)
+	assert.Equal(t, "hello:secret", plan.UserAuth)
+	assert.Equal(t, "Enter password: ", string(outputs.Bytes(DEFAULT_STDERR)))
+	assert.Empty(t, outputs.Bytes(DEFAULT_OUTPUT), "the prompt mustn't end up in the body's output")
+}
@@ -0,0 +1,67 @@
+package context
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+)
+
+// An HTTPS proxy's TLS handshake and the origin's are made with different tls.Configs: --pinnedpubkey,
+// --tls-servername, ECH and the revocation checks only apply to the origin, --proxy-pinnedpubkey only to the proxy.
+// Which handshake is which is decided by the connection being dialed, never by the host name, as the proxy and
+// the origin may well share one.
+
+// viaHttpsProxyKey marks a request's context when it is sent through an HTTPS proxy, so its connection's first
+// handshake (made by DialTLSContext) is with the proxy. The origin's, through the proxy's tunnel, uses
+// TLSClientConfig.
+type viaHttpsProxyKey struct{}
+
+// proxyTlsTransport marks each request that goes through an HTTPS proxy before handing it to the transport.
+type proxyTlsTransport struct {
+	transport *http.Transport
+}
+
+func (t *proxyTlsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.transport.Proxy != nil {
+		proxyUrl, err := t.transport.Proxy(req)
+		if err != nil {
+			return nil, err
+		}
+		if proxyUrl != nil && proxyUrl.Scheme == "https" {
+			req = req.WithContext(context.WithValue(req.Context(), viaHttpsProxyKey{}, true))
+		}
+	}
+	return t.transport.RoundTrip(req)
+}
+
+// configureProxyTls has transport make an HTTPS proxy's handshakes with proxyConfig, leaving the origin's to
+// transport.TLSClientConfig, and returns the RoundTripper to send requests with.
+func configureProxyTls(transport *http.Transport, proxyConfig *tls.Config) http.RoundTripper {
+	proxyConfig.ServerName = "" // the proxy's own name, not --tls-servername
+	dial := transport.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	// only called for a connection's first hop: the proxy if it's an HTTPS one, otherwise the origin
+	transport.DialTLSContext = func(dialCtx context.Context, network string, addr string) (net.Conn, error) {
+		config := transport.TLSClientConfig.Clone() // now, once the transport has added its ALPN protocols
+		if viaProxy, _ := dialCtx.Value(viaHttpsProxyKey{}).(bool); viaProxy {
+			config = proxyConfig.Clone()
+			config.NextProtos = nil // requests are tunneled through the proxy, so always HTTP/1.1 to it
+		}
+		if config.ServerName == "" {
+			host, _, err := net.SplitHostPort(addr)
+			if err != nil {
+				return nil, err
+			}
+			config.ServerName = host
+		}
+		conn, err := dial(dialCtx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return tls.Client(conn, config), nil // the transport handshakes, so its tracing still sees it
+	}
+	return &proxyTlsTransport{transport: transport}
+}
@@ -0,0 +1,167 @@
+package context
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	curlerrors "github.com/cdwiegand/go-curling/errors"
+	"golang.org/x/crypto/ocsp"
+)
+
+// ErrCertStatus is returned (wrapped) from the TLS handshake when --cert-status finds no valid, good OCSP staple.
+var ErrCertStatus = errors.New("invalid certificate status")
+
+// ErrCertRevoked is returned (wrapped) from the TLS handshake when a --crlfile lists a certificate as revoked.
+var ErrCertRevoked = errors.New("certificate revoked")
+
+// ReadCrlFile reads one or more PEM ("X509 CRL") or a single DER certificate revocation list.
+func ReadCrlFile(file string) ([]*x509.RevocationList, error) {
+	data, err := os.ReadFile(file) // #nosec G304
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Contains(data, []byte("-----BEGIN")) {
+		crl, err := x509.ParseRevocationList(data)
+		if err != nil {
+			return nil, err
+		}
+		return []*x509.RevocationList{crl}, nil
+	}
+	var ret []*x509.RevocationList
+	for _, block := range extractPemBlocks(data, false) {
+		if block.Type != "X509 CRL" {
+			continue
+		}
+		crl, err := x509.ParseRevocationList(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, crl)
+	}
+	if len(ret) == 0 {
+		return nil, fmt.Errorf("no X509 CRL found")
+	}
+	return ret, nil
+}
+
+// BuildRevocationVerifier returns a tls.Config.VerifyConnection hook for --cert-status and --crlfile, or nil
+// if neither was given. It only goes in the origin's tls.Config, not an HTTPS proxy's (see configureProxyTls).
+func (ctx *CurlContext) BuildRevocationVerifier() (func(tls.ConnectionState) error, *curlerrors.CurlError) {
+	if !ctx.RequireCertStatus && ctx.CrlFile == "" {
+		return nil, nil
+	}
+	var crls []*x509.RevocationList
+	if ctx.CrlFile != "" {
+		var err error
+		crls, err = ReadCrlFile(ctx.CrlFile)
+		if err != nil {
+			return nil, curlerrors.NewCurlErrorFromStringAndError(curlerrors.ERROR_SSL_CRL_BADFILE, fmt.Sprintf("Failed to load --crlfile %s", ctx.CrlFile), err)
+		}
+	}
+	return func(cs tls.ConnectionState) error {
+		chain := connectionChain(cs)
+		if len(chain) == 0 {
+			return fmt.Errorf("%w: server presented no certificate", ErrCertStatus)
+		}
+		if ctx.RequireCertStatus {
+			if err := CheckStapledOcspResponse(cs.OCSPResponse, chain, time.Now()); err != nil {
+				return err
+			}
+		}
+		if crls != nil {
+			if err := CheckCrls(crls, chain, time.Now()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, nil
+}
+
+// connectionChain is the verified chain when there is one, otherwise (-k) what the server presented.
+func connectionChain(cs tls.ConnectionState) []*x509.Certificate {
+	if len(cs.VerifiedChains) > 0 {
+		return cs.VerifiedChains[0]
+	}
+	return cs.PeerCertificates
+}
+
+// CheckStapledOcspResponse requires staple to be a correctly signed, current OCSP response saying chain[0] is good.
+func CheckStapledOcspResponse(staple []byte, chain []*x509.Certificate, now time.Time) error {
+	if len(staple) == 0 {
+		return fmt.Errorf("%w: server did not staple an OCSP response", ErrCertStatus)
+	}
+	if len(chain) < 2 {
+		return fmt.Errorf("%w: no issuer certificate to check the OCSP response against", ErrCertStatus)
+	}
+	resp, err := ocsp.ParseResponseForCert(staple, chain[0], chain[1])
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrCertStatus, err)
+	}
+	switch resp.Status {
+	case ocsp.Good:
+	case ocsp.Revoked:
+		return fmt.Errorf("%w: OCSP response says the certificate was revoked at %s", ErrCertStatus, resp.RevokedAt.Format(time.RFC3339))
+	default:
+		return fmt.Errorf("%w: OCSP responder does not know the certificate", ErrCertStatus)
+	}
+	if now.Before(resp.ThisUpdate) {
+		return fmt.Errorf("%w: OCSP response is not valid until %s", ErrCertStatus, resp.ThisUpdate.Format(time.RFC3339))
+	}
+	if !resp.NextUpdate.IsZero() && now.After(resp.NextUpdate) {
+		return fmt.Errorf("%w: OCSP response expired at %s", ErrCertStatus, resp.NextUpdate.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// CheckCrls rejects a chain containing a revoked certificate. As with curl (OpenSSL), the server's own
+// certificate must be covered by one of the CRLs; the rest of the chain is checked where a CRL exists.
+func CheckCrls(crls []*x509.RevocationList, chain []*x509.Certificate, now time.Time) error {
+	for i, cert := range chain {
+		var issuer *x509.Certificate
+		if i+1 < len(chain) {
+			issuer = chain[i+1]
+		} else if bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+			break // a self-signed root isn't revoked by anyone
+		}
+		crl, err := findCrl(crls, cert, issuer)
+		if err != nil {
+			return err
+		}
+		if crl == nil {
+			if i == 0 {
+				return fmt.Errorf("%w: --crlfile has no CRL from %s", ErrCertRevoked, cert.Issuer)
+			}
+			continue
+		}
+		if !crl.NextUpdate.IsZero() && now.After(crl.NextUpdate) {
+			return fmt.Errorf("%w: CRL from %s expired at %s", ErrCertRevoked, crl.Issuer, crl.NextUpdate.Format(time.RFC3339))
+		}
+		for _, revoked := range crl.RevokedCertificateEntries {
+			if revoked.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+				return fmt.Errorf("%w: %s (serial %X) was revoked at %s", ErrCertRevoked, cert.Subject, cert.SerialNumber, revoked.RevocationTime.Format(time.RFC3339))
+			}
+		}
+	}
+	return nil
+}
+
+// findCrl returns the CRL covering cert, checking its signature when the issuer is known.
+func findCrl(crls []*x509.RevocationList, cert *x509.Certificate, issuer *x509.Certificate) (*x509.RevocationList, error) {
+	for _, crl := range crls {
+		if !bytes.Equal(crl.RawIssuer, cert.RawIssuer) {
+			continue
+		}
+		if issuer != nil {
+			if err := crl.CheckSignatureFrom(issuer); err != nil {
+				return nil, fmt.Errorf("%w: CRL from %s has an invalid signature: %v", ErrCertRevoked, crl.Issuer, err)
+			}
+		}
+		return crl, nil
+	}
+	return nil, nil
+}
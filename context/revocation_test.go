@@ -0,0 +1,154 @@
+package context
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	curlerrors "github.com/cdwiegand/go-curling/errors"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ocsp"
+)
+
+func (ca *testCA) ocspStaple(t *testing.T, leaf *x509.Certificate, status int, nextUpdate time.Time) []byte {
+	t.Helper()
+	template := ocsp.Response{Status: status, SerialNumber: leaf.SerialNumber, ThisUpdate: time.Now().Add(-time.Minute), NextUpdate: nextUpdate}
+	if status == ocsp.Revoked {
+		template.RevokedAt = time.Now().Add(-time.Minute)
+	}
+	staple, err := ocsp.CreateResponse(ca.Cert, ca.Cert, template, ca.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return staple
+}
+
+// writeCrl writes a PEM CRL from ca revoking the given certificates, returning the file name.
+func (ca *testCA) writeCrl(t *testing.T, nextUpdate time.Time, revoked ...*x509.Certificate) string {
+	t.Helper()
+	template := &x509.RevocationList{Number: big.NewInt(1), ThisUpdate: time.Now().Add(-time.Hour), NextUpdate: nextUpdate}
+	for _, r := range revoked {
+		template.RevokedCertificateEntries = append(template.RevokedCertificateEntries, x509.RevocationListEntry{SerialNumber: r.SerialNumber, RevocationTime: time.Now().Add(-time.Minute)})
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, template, ca.Cert, ca.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "crl.pem")
+	os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der}), 0600)
+	return file
+}
+
+func (ca *testCA) writeCert(t *testing.T) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "ca.pem")
+	os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Cert.Raw}), 0600)
+	return file
+}
+
+func Test_CertStatus(t *testing.T) {
+	ca := newTestCA(t, "OCSP test CA")
+	caFile := ca.writeCert(t)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	serve := func(staple func(leaf *x509.Certificate) []byte) string {
+		cert := ca.issue(t, "localhost", false, time.Hour)
+		if staple != nil {
+			cert.OCSPStaple = staple(cert.Leaf)
+		}
+		return newTestTLSServer(t, cert, handler, nil).URL
+	}
+
+	good := serve(func(leaf *x509.Certificate) []byte {
+		return ca.ocspStaple(t, leaf, ocsp.Good, time.Now().Add(time.Hour))
+	})
+	assert.Nil(t, pinnedRequest(t, &CurlContext{CaCertFile: []string{caFile}, RequireCertStatus: true}, good))
+	assert.Nil(t, pinnedRequest(t, &CurlContext{IgnoreBadCerts: true, RequireCertStatus: true}, good))
+
+	for name, url := range map[string]string{
+		"revoked": serve(func(leaf *x509.Certificate) []byte {
+			return ca.ocspStaple(t, leaf, ocsp.Revoked, time.Now().Add(time.Hour))
+		}),
+		"expired": serve(func(leaf *x509.Certificate) []byte {
+			return ca.ocspStaple(t, leaf, ocsp.Good, time.Now().Add(-time.Second))
+		}),
+		"none": serve(nil),
+		"other CA": serve(func(leaf *x509.Certificate) []byte {
+			return newTestCA(t, "someone else").ocspStaple(t, leaf, ocsp.Good, time.Now().Add(time.Hour))
+		}),
+	} {
+		cerr := pinnedRequest(t, &CurlContext{CaCertFile: []string{caFile}, RequireCertStatus: true}, url)
+		if assert.NotNil(t, cerr, name) {
+			assert.Equal(t, curlerrors.ERROR_SSL_INVALID_CERT_STATUS, cerr.ExitCode, name)
+		}
+		// without --cert-status the staple is ignored
+		assert.Nil(t, pinnedRequest(t, &CurlContext{CaCertFile: []string{caFile}}, url), name)
+	}
+}
+
+func Test_CrlFile(t *testing.T) {
+	ca := newTestCA(t, "CRL test CA")
+	caFile := ca.writeCert(t)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	okCert := ca.issue(t, "localhost", false, time.Hour)
+	revokedCert := ca.issue(t, "localhost", false, time.Hour)
+	okServer := newTestTLSServer(t, okCert, handler, nil).URL
+	revokedServer := newTestTLSServer(t, revokedCert, handler, nil).URL
+
+	crl := ca.writeCrl(t, time.Now().Add(time.Hour), revokedCert.Leaf)
+	assert.Nil(t, pinnedRequest(t, &CurlContext{CaCertFile: []string{caFile}, CrlFile: crl}, okServer))
+	cerr := pinnedRequest(t, &CurlContext{CaCertFile: []string{caFile}, CrlFile: crl}, revokedServer)
+	if assert.NotNil(t, cerr) {
+		assert.Equal(t, curlerrors.ERROR_SSL_CERT_REVOKED, cerr.ExitCode)
+		assert.Contains(t, cerr.ErrorString, "was revoked")
+	}
+
+	// a CRL from some other CA doesn't cover the server, which curl also treats as a failure
+	otherCrl := newTestCA(t, "someone else").writeCrl(t, time.Now().Add(time.Hour))
+	assert.NotNil(t, pinnedRequest(t, &CurlContext{CaCertFile: []string{caFile}, CrlFile: otherCrl}, okServer))
+
+	expiredCrl := ca.writeCrl(t, time.Now().Add(-time.Second))
+	assert.NotNil(t, pinnedRequest(t, &CurlContext{CaCertFile: []string{caFile}, CrlFile: expiredCrl}, okServer))
+
+	cerr = pinnedRequest(t, &CurlContext{CrlFile: filepath.Join(t.TempDir(), "missing.pem")}, okServer)
+	if assert.NotNil(t, cerr) {
+		assert.Equal(t, curlerrors.ERROR_SSL_CRL_BADFILE, cerr.ExitCode)
+	}
+}
+
+func Test_CrlFile_ProxyOnSameHost(t *testing.T) {
+	ca := newTestCA(t, "CRL test CA")
+	proxyCa := newTestCA(t, "Proxy CA")
+	caFiles := []string{ca.writeCert(t), proxyCa.writeCert(t)}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	okCert := ca.issue(t, "127.0.0.1", false, time.Hour)
+	revokedCert := ca.issue(t, "127.0.0.1", false, time.Hour)
+	okServer := newTestTLSServer(t, okCert, handler, nil).URL
+	revokedServer := newTestTLSServer(t, revokedCert, handler, nil).URL
+	// the CRL doesn't cover the proxy's CA, so checking the proxy's chain against it would fail
+	proxy := newTestHttpsProxy(t, proxyCa.issue(t, "127.0.0.1", false, time.Hour))
+	crl := ca.writeCrl(t, time.Now().Add(time.Hour), revokedCert.Leaf)
+
+	assert.Nil(t, pinnedRequest(t, viaProxy(&CurlContext{CaCertFile: caFiles, CrlFile: crl}, proxy), okServer))
+	cerr := pinnedRequest(t, viaProxy(&CurlContext{CaCertFile: caFiles, CrlFile: crl}, proxy), revokedServer)
+	if assert.NotNil(t, cerr, "the origin must be checked even though the proxy shares its host") {
+		assert.Equal(t, curlerrors.ERROR_SSL_CERT_REVOKED, cerr.ExitCode)
+	}
+}
+
+func Test_CheckCrls_ForgedSignature(t *testing.T) {
+	ca := newTestCA(t, "CRL test CA")
+	leaf := ca.issue(t, "localhost", false, time.Hour).Leaf
+	// same name as the real CA, different key: its CRL must not be trusted
+	impostor := newTestCA(t, "CRL test CA")
+	crls, err := ReadCrlFile(impostor.writeCrl(t, time.Now().Add(time.Hour)))
+	assert.Nil(t, err)
+	err = CheckCrls(crls, []*x509.Certificate{leaf, ca.Cert}, time.Now())
+	assert.ErrorIs(t, err, ErrCertRevoked)
+	assert.ErrorContains(t, err, "invalid signature")
+}
@@ -0,0 +1,243 @@
+package context
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	curlerrors "github.com/cdwiegand/go-curling/errors"
+)
+
+// Session is what --session NAME persists between runs, in the style of HTTPie sessions.
+type Session struct {
+	BaseUrl string          `json:"base_url,omitempty"`
+	Headers []string        `json:"headers,omitempty"`
+	Auth    SessionAuth     `json:"auth"`
+	Cookies []SessionCookie `json:"cookies,omitempty"`
+}
+
+type SessionAuth struct {
+	User        string `json:"user,omitempty"`
+	BearerToken string `json:"bearer,omitempty"`
+}
+
+type SessionCookie struct {
+	Name     string    `json:"name"`
+	Value    string    `json:"value"`
+	Domain   string    `json:"domain"`
+	Path     string    `json:"path"`
+	Secure   bool      `json:"secure,omitempty"`
+	HttpOnly bool      `json:"http_only,omitempty"`
+	Expires  time.Time `json:"expires,omitempty"`
+}
+
+// headers that describe one particular request body or condition, so are never made sticky
+var sessionExcludedHeaders = []string{"Content-Type", "Content-Length", "Cookie", "Host"}
+
+// GetSessionFile maps a session name to its file: names are stored in <user config dir>/go-curling/sessions/NAME.json,
+// anything that looks like a path (contains a separator or ends in .json) is used as-is.
+func GetSessionFile(name string) (string, error) {
+	if strings.ContainsAny(name, `/\`) || strings.HasSuffix(name, ".json") {
+		return name, nil
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "go-curling", "sessions", name+".json"), nil
+}
+
+func (ctx *CurlContext) getSessionName() (string, bool) {
+	if ctx.SessionReadOnly != "" {
+		return ctx.SessionReadOnly, true
+	}
+	return ctx.SessionName, false
+}
+
+// LoadSession reads the --session/--session-read-only file (a missing file is a new, empty session).
+// Its base URL resolves root-relative URLs; its headers and auth are added by PlanRequest, to its own host only.
+func (ctx *CurlContext) LoadSession() *curlerrors.CurlError {
+	name, _ := ctx.getSessionName()
+	if name == "" {
+		return nil
+	}
+	if ctx.SessionName != "" && ctx.SessionReadOnly != "" {
+		return curlerrors.NewCurlErrorFromString(curlerrors.ERROR_INVALID_ARGS, "Cannot include both --session and --session-read-only")
+	}
+
+	file, err := GetSessionFile(name)
+	if err != nil {
+		return curlerrors.NewCurlErrorFromStringAndError(curlerrors.ERROR_CANNOT_READ_FILE, "Unable to find session directory", err)
+	}
+	ctx.sessionFile = file
+
+	session := &Session{}
+	data, err := os.ReadFile(file) // #nosec G304
+	if err != nil && !os.IsNotExist(err) {
+		return curlerrors.NewCurlErrorFromStringAndError(curlerrors.ERROR_CANNOT_READ_FILE, fmt.Sprintf("Unable to read session %s", file), err)
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, session); err != nil {
+			return curlerrors.NewCurlErrorFromStringAndError(curlerrors.ERROR_CANNOT_READ_FILE, fmt.Sprintf("Unable to parse session %s", file), err)
+		}
+	}
+	ctx.session = session
+	ctx.applySession()
+	return nil
+}
+
+// shareSession uses previous's session (see SetupContextForNextGroup), keeping the headers both groups gave.
+func (ctx *CurlContext) shareSession(previous *CurlContext) {
+	if previous.session == nil {
+		return
+	}
+	ctx.session = previous.session
+	ctx.sessionFile = previous.sessionFile
+	ctx.applySession()
+	ctx.sessionStickyHeaders = mergeSessionHeaders(previous.sessionStickyHeaders, ctx.sessionStickyHeaders)
+}
+
+// applySession remembers which command line headers to keep in the session (not per-request ones such as If-None-Match).
+func (ctx *CurlContext) applySession() {
+	ctx.sessionStickyHeaders = stickySessionHeaders(ctx.Headers)
+}
+
+// sessionFor is the session if rawUrl is on the host it was created for (or it isn't bound to one yet), else nil:
+// like HTTPie, a session's credentials and headers are never sent to another host.
+func (ctx *CurlContext) sessionFor(rawUrl string) *Session {
+	if ctx.session == nil || ctx.session.BaseUrl == "" {
+		return ctx.session
+	}
+	base, err := url.Parse(ctx.session.BaseUrl)
+	if err != nil {
+		return nil
+	}
+	u, err := url.Parse(rawUrl)
+	if err != nil || !sameOrigin(base, u) {
+		return nil
+	}
+	return ctx.session
+}
+
+// AddSessionCookiesToJar puts the session's cookies into the run's jar, once the jar exists.
+func (ctx *CurlContext) AddSessionCookiesToJar() {
+	if ctx.session == nil || ctx.Jar == nil {
+		return
+	}
+	var cookies []*http.Cookie
+	for _, c := range ctx.session.Cookies {
+		cookies = append(cookies, &http.Cookie{Name: c.Name, Value: c.Value, Domain: c.Domain, Path: c.Path, Secure: c.Secure, HttpOnly: c.HttpOnly, Expires: c.Expires})
+	}
+	if ctx.JunkSessionCookies {
+		cookies = WithoutSessionCookies(cookies)
+	}
+	AddCookiesToJar(ctx.Jar, cookies)
+}
+
+// resolveSessionUrl makes root-relative URLs ("/users") relative to the session's base URL.
+func (ctx *CurlContext) resolveSessionUrl(s string) string {
+	if ctx.session == nil || ctx.session.BaseUrl == "" || !strings.HasPrefix(s, "/") {
+		return s
+	}
+	return strings.TrimSuffix(ctx.session.BaseUrl, "/") + s
+}
+
+// SaveSession writes the session back, unless it was opened with --session-read-only.
+func (ctx *CurlContext) SaveSession() error {
+	if ctx.session == nil || ctx.sessionFile == "" {
+		return nil
+	}
+	if _, readOnly := ctx.getSessionName(); readOnly {
+		return nil
+	}
+
+	session := *ctx.session
+	// headers and auth given for another host belong to that host, so aren't stored in this one's session
+	if len(ctx.Urls) == 0 || ctx.sessionFor(ctx.Urls[0]) != nil {
+		session.Headers = mergeSessionHeaders(session.Headers, ctx.sessionStickyHeaders)
+		session.Auth = SessionAuth{User: cmp.Or(ctx.UserAuth, session.Auth.User), BearerToken: cmp.Or(ctx.OAuth2_BearerToken, session.Auth.BearerToken)}
+	}
+	if session.BaseUrl == "" && len(ctx.Urls) > 0 {
+		if u, err := url.Parse(ctx.Urls[0]); err == nil && u.Host != "" {
+			session.BaseUrl = u.Scheme + "://" + u.Host
+		}
+	}
+	session.Cookies = nil
+	if ctx.Jar != nil {
+		for _, c := range JarCookies(ctx.Jar) {
+			if ctx.JunkSessionCookies && IsSessionCookie(c) {
+				continue
+			}
+			sc := SessionCookie{Name: c.Name, Value: c.Value, Domain: c.Domain, Path: c.Path, Secure: c.Secure, HttpOnly: c.HttpOnly}
+			if !IsSessionCookie(c) {
+				sc.Expires = c.Expires
+			}
+			session.Cookies = append(session.Cookies, sc)
+		}
+	}
+
+	data, err := json.MarshalIndent(session, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(ctx.sessionFile), 0700); err != nil {
+		return err
+	}
+	unlock, err := LockFile(ctx.sessionFile + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return WriteFileAtomic(ctx.sessionFile, func(tmpPath string) error {
+		return os.WriteFile(tmpPath, data, 0600) // holds credentials, so owner-only
+	})
+}
+
+func stickySessionHeaders(headers []string) (ret []string) {
+	for _, h := range headers {
+		name, _, found := strings.Cut(h, ":")
+		if !found || isSessionExcludedHeader(strings.TrimSpace(name)) {
+			continue
+		}
+		ret = append(ret, h)
+	}
+	return
+}
+
+func isSessionExcludedHeader(name string) bool {
+	if strings.HasPrefix(strings.ToLower(name), "if-") {
+		return true // conditional requests are per-request
+	}
+	for _, h := range sessionExcludedHeaders {
+		if strings.EqualFold(h, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeSessionHeaders keeps stored headers, replaced by any of the same name given this run.
+func mergeSessionHeaders(stored []string, current []string) []string {
+	ret := append([]string{}, current...)
+	for _, h := range stored {
+		name, _, _ := strings.Cut(h, ":")
+		replaced := false
+		for _, c := range current {
+			cname, _, _ := strings.Cut(c, ":")
+			if strings.EqualFold(strings.TrimSpace(name), strings.TrimSpace(cname)) {
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			ret = append(ret, h)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,188 @@
+package context
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func runSessionRequest(t *testing.T, ctx *CurlContext) {
+	t.Helper()
+	ctx.BodyOutput = []string{"/dev/null"}
+	if cerr := ctx.SetupContextForRun(nil); cerr != nil {
+		t.Fatal(cerr)
+	}
+	client, cerr := ctx.BuildClient()
+	if cerr != nil {
+		t.Fatal(cerr)
+	}
+	request, cerr := ctx.BuildHttpRequest(ctx.Urls[0], 0, true, true)
+	if cerr != nil {
+		t.Fatal(cerr)
+	}
+	resp, cerr := ctx.GetCompleteResponse(0, client, request)
+	if cerr != nil {
+		t.Fatal(cerr)
+	}
+	cerrs := ctx.ProcessResponseToOutputs(0, resp, request)
+	assert.False(t, cerrs.HasError())
+}
+
+func Test_Session_RoundTrip(t *testing.T) {
+	var lastRequest *http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastRequest = r
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{Name: "sid", Value: "abc", Path: "/"})
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+	sessionFile := filepath.Join(t.TempDir(), "api.json")
+
+	runSessionRequest(t, &CurlContext{
+		SessionName: sessionFile,
+		Urls:        []string{srv.URL + "/login"},
+		Headers:     []string{"X-Api-Version: 2", "Content-Type: text/plain"},
+		UserAuth:    "alice:secret",
+		Data_Json:   []string{`{"a":1}`},
+	})
+	info, err := os.Stat(sessionFile)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// second run: only the session and a root-relative URL
+	runSessionRequest(t, &CurlContext{
+		SessionName: sessionFile,
+		Urls:        []string{"/report"},
+	})
+	assert.Equal(t, "/report", lastRequest.URL.Path)
+	assert.Equal(t, "2", lastRequest.Header.Get("X-Api-Version"))
+	assert.Empty(t, lastRequest.Header.Get("Content-Type"), "per-request headers are not sticky")
+	user, pass, ok := lastRequest.BasicAuth()
+	assert.True(t, ok)
+	assert.Equal(t, "alice", user)
+	assert.Equal(t, "secret", pass)
+	cookie, err := lastRequest.Cookie("sid")
+	assert.Nil(t, err)
+	assert.Equal(t, "abc", cookie.Value)
+
+	// command line overrides the stored header, and is remembered
+	runSessionRequest(t, &CurlContext{
+		SessionName: sessionFile,
+		Urls:        []string{"/report"},
+		Headers:     []string{"X-Api-Version: 3"},
+	})
+	assert.Equal(t, "3", lastRequest.Header.Get("X-Api-Version"))
+	runSessionRequest(t, &CurlContext{
+		SessionName: sessionFile,
+		Urls:        []string{"/report"},
+	})
+	assert.Equal(t, "3", lastRequest.Header.Get("X-Api-Version"))
+}
+
+func Test_Session_OtherHostGetsNoCredentials(t *testing.T) {
+	var lastRequest *http.Request
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastRequest = r
+		w.WriteHeader(http.StatusOK)
+	})
+	api := httptest.NewServer(handler)
+	defer api.Close()
+	other := httptest.NewServer(handler) // another port, so another origin
+	defer other.Close()
+	sessionFile := filepath.Join(t.TempDir(), "api.json")
+
+	runSessionRequest(t, &CurlContext{
+		SessionName:        sessionFile,
+		Urls:               []string{api.URL + "/login"},
+		Headers:            []string{"X-Api-Key: k1"},
+		UserAuth:           "alice:secret",
+		OAuth2_BearerToken: "tok",
+	})
+
+	runSessionRequest(t, &CurlContext{
+		SessionName: sessionFile,
+		Urls:        []string{other.URL + "/x"},
+		Headers:     []string{"X-Other: 1"},
+		UserAuth:    "bob:pw",
+	})
+	assert.Empty(t, lastRequest.Header.Get("X-Api-Key"))
+	user, _, _ := lastRequest.BasicAuth()
+	assert.Equal(t, "bob", user, "only what this run's command line gave")
+
+	// and nothing from the other host found its way into the session
+	runSessionRequest(t, &CurlContext{
+		SessionName: sessionFile,
+		Urls:        []string{"/report"},
+	})
+	assert.Equal(t, "k1", lastRequest.Header.Get("X-Api-Key"))
+	assert.Empty(t, lastRequest.Header.Get("X-Other"))
+	user, pass, ok := lastRequest.BasicAuth()
+	assert.True(t, ok)
+	assert.Equal(t, "alice", user)
+	assert.Equal(t, "secret", pass)
+
+	// bearer only, so no basic auth either
+	runSessionRequest(t, &CurlContext{
+		SessionName: sessionFile,
+		Urls:        []string{other.URL + "/y"},
+	})
+	assert.Empty(t, lastRequest.Header.Get("Authorization"))
+}
+
+func Test_Session_ReadOnly(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+	sessionFile := filepath.Join(t.TempDir(), "ro.json")
+	original := []byte(`{"base_url":"` + srv.URL + `","headers":["X-Hello: World"],"auth":{}}`)
+	os.WriteFile(sessionFile, original, 0600)
+
+	runSessionRequest(t, &CurlContext{
+		SessionReadOnly: sessionFile,
+		Urls:            []string{"/x"},
+		Headers:         []string{"X-Other: 1"},
+	})
+	after, _ := os.ReadFile(sessionFile)
+	assert.Equal(t, string(original), string(after))
+}
+
+func Test_Session_BothFlagsInvalid(t *testing.T) {
+	ctx := &CurlContext{SessionName: "a", SessionReadOnly: "b"}
+	assert.NotNil(t, ctx.LoadSession())
+}
+
+func Test_GetSessionFile(t *testing.T) {
+	file, err := GetSessionFile("./my-session.json")
+	assert.Nil(t, err)
+	assert.Equal(t, "./my-session.json", file)
+
+	file, err = GetSessionFile("work")
+	if err == nil { // no config dir in some CI sandboxes
+		assert.Equal(t, filepath.Join("go-curling", "sessions", "work.json"), filepath.Join(filepath.Base(filepath.Dir(filepath.Dir(file))), "sessions", filepath.Base(file)))
+	}
+}
+
+func Test_SetupContextForNextGroup_SharesJarAndSession(t *testing.T) {
+	dir := t.TempDir()
+	first := &CurlContext{SessionName: filepath.Join(dir, "s.json"), Headers: []string{"X-One: 1"}}
+	assert.Nil(t, first.SetupContextForRun([]string{"http://localhost/a"}))
+	next := &CurlContext{SessionName: first.SessionName, Headers: []string{"X-Two: 2"}}
+	assert.Nil(t, next.SetupContextForNextGroup(first, []string{"http://localhost/b"}))
+
+	assert.Same(t, first.Jar, next.Jar)
+	assert.Same(t, first.session, next.session)
+	assert.Equal(t, []string{"X-Two: 2"}, next.Headers, "the first group's -H isn't sent by the next")
+	assert.Nil(t, next.SaveSession())
+
+	data, err := os.ReadFile(first.SessionName)
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), "X-One: 1")
+	assert.Contains(t, string(data), "X-Two: 2")
+}
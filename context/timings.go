@@ -0,0 +1,56 @@
+package context
+
+import (
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Timings of one request, each measured from when it was sent, as curl's -w time_* variables are.
+// Phases that didn't happen (such as DNS and connecting on a reused connection) are zero.
+type Timings struct {
+	Start         time.Time
+	NameLookup    time.Duration // DNS resolution done
+	Connect       time.Duration // TCP connection to the host (or proxy) made
+	AppConnect    time.Duration // TLS handshake done
+	StartTransfer time.Duration // first byte of the response received
+	Headers       time.Duration // response headers read; the body is read after this, by whoever consumes it
+}
+
+// timingsTrace collects Timings through httptrace, whose hooks may run on other goroutines.
+type timingsTrace struct {
+	mu      sync.Mutex
+	timings Timings
+}
+
+func newTimingsTrace() *timingsTrace {
+	return &timingsTrace{timings: Timings{Start: time.Now()}}
+}
+
+func (tt *timingsTrace) mark(d *time.Duration) {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+	*d = time.Since(tt.timings.Start)
+}
+
+func (tt *timingsTrace) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSDone: func(httptrace.DNSDoneInfo) { tt.mark(&tt.timings.NameLookup) },
+		ConnectDone: func(network string, addr string, err error) {
+			if err == nil {
+				tt.mark(&tt.timings.Connect)
+			}
+		},
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { tt.mark(&tt.timings.AppConnect) },
+		GotFirstResponseByte: func() { tt.mark(&tt.timings.StartTransfer) },
+	}
+}
+
+// done records the headers as read and returns the Timings.
+func (tt *timingsTrace) done() Timings {
+	tt.mark(&tt.timings.Headers)
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+	return tt.timings
+}
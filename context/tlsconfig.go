@@ -0,0 +1,195 @@
+package context
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	curlerrors "github.com/cdwiegand/go-curling/errors"
+)
+
+// OpenSSL's names for the cipher suites Go implements, as used by curl's --ciphers and --tls13-ciphers.
+// IANA names (as tls.CipherSuiteName returns) are accepted as well.
+var openSslCipherNames = map[uint16]string{
+	tls.TLS_RSA_WITH_RC4_128_SHA:                      "RC4-SHA",
+	tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA:                 "DES-CBC3-SHA",
+	tls.TLS_RSA_WITH_AES_128_CBC_SHA:                  "AES128-SHA",
+	tls.TLS_RSA_WITH_AES_256_CBC_SHA:                  "AES256-SHA",
+	tls.TLS_RSA_WITH_AES_128_CBC_SHA256:               "AES128-SHA256",
+	tls.TLS_RSA_WITH_AES_128_GCM_SHA256:               "AES128-GCM-SHA256",
+	tls.TLS_RSA_WITH_AES_256_GCM_SHA384:               "AES256-GCM-SHA384",
+	tls.TLS_ECDHE_ECDSA_WITH_RC4_128_SHA:              "ECDHE-ECDSA-RC4-SHA",
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA:          "ECDHE-ECDSA-AES128-SHA",
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA:          "ECDHE-ECDSA-AES256-SHA",
+	tls.TLS_ECDHE_RSA_WITH_RC4_128_SHA:                "ECDHE-RSA-RC4-SHA",
+	tls.TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA:           "ECDHE-RSA-DES-CBC3-SHA",
+	tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA:            "ECDHE-RSA-AES128-SHA",
+	tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA:            "ECDHE-RSA-AES256-SHA",
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256:       "ECDHE-ECDSA-AES128-SHA256",
+	tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256:         "ECDHE-RSA-AES128-SHA256",
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256:         "ECDHE-RSA-AES128-GCM-SHA256",
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256:       "ECDHE-ECDSA-AES128-GCM-SHA256",
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384:         "ECDHE-RSA-AES256-GCM-SHA384",
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384:       "ECDHE-ECDSA-AES256-GCM-SHA384",
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256:   "ECDHE-RSA-CHACHA20-POLY1305",
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256: "ECDHE-ECDSA-CHACHA20-POLY1305",
+	tls.TLS_AES_128_GCM_SHA256:                        "TLS_AES_128_GCM_SHA256",
+	tls.TLS_AES_256_GCM_SHA384:                        "TLS_AES_256_GCM_SHA384",
+	tls.TLS_CHACHA20_POLY1305_SHA256:                  "TLS_CHACHA20_POLY1305_SHA256",
+}
+
+// names accepted by --curves, lower case; OpenSSL and IANA spellings both work
+var curveNames = []struct {
+	id    tls.CurveID
+	names []string
+}{
+	{tls.X25519MLKEM768, []string{"x25519mlkem768"}},
+	{tls.SecP256r1MLKEM768, []string{"secp256r1mlkem768"}},
+	{tls.SecP384r1MLKEM1024, []string{"secp384r1mlkem1024"}},
+	{tls.X25519, []string{"x25519"}},
+	{tls.CurveP256, []string{"p-256", "prime256v1", "secp256r1"}},
+	{tls.CurveP384, []string{"p-384", "secp384r1"}},
+	{tls.CurveP521, []string{"p-521", "secp521r1"}},
+}
+
+// splitTlsList splits an OpenSSL style list, which may use ':', ',' or spaces between entries.
+func splitTlsList(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return r == ':' || r == ',' || r == ' '
+	})
+}
+
+func allCipherSuites() []*tls.CipherSuite {
+	return append(tls.CipherSuites(), tls.InsecureCipherSuites()...)
+}
+
+// ParseCipherSuites maps --ciphers/--tls13-ciphers names to suite IDs; tls13 selects which family is allowed.
+func ParseCipherSuites(value string, tls13 bool) ([]uint16, error) {
+	var ret []uint16
+	for _, name := range splitTlsList(value) {
+		var found *tls.CipherSuite
+		for _, suite := range allCipherSuites() {
+			if strings.EqualFold(name, suite.Name) || strings.EqualFold(name, openSslCipherNames[suite.ID]) {
+				found = suite
+				break
+			}
+		}
+		if found == nil {
+			return nil, fmt.Errorf("unknown cipher %s", name)
+		}
+		if isTls13 := slices.Contains(found.SupportedVersions, tls.VersionTLS13); isTls13 != tls13 {
+			if tls13 {
+				return nil, fmt.Errorf("%s is not a TLS 1.3 cipher, use --ciphers", name)
+			}
+			return nil, fmt.Errorf("%s is a TLS 1.3 cipher, use --tls13-ciphers", name)
+		}
+		ret = append(ret, found.ID)
+	}
+	if len(ret) == 0 {
+		return nil, fmt.Errorf("no ciphers given")
+	}
+	return ret, nil
+}
+
+// ParseCurves maps --curves names to tls.CurveIDs, in the order given (which is the preference order).
+func ParseCurves(value string) ([]tls.CurveID, error) {
+	var ret []tls.CurveID
+	for _, name := range splitTlsList(value) {
+		found := false
+		for _, c := range curveNames {
+			if slices.Contains(c.names, strings.ToLower(name)) {
+				ret = append(ret, c.id)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown curve %s", name)
+		}
+	}
+	if len(ret) == 0 {
+		return nil, fmt.Errorf("no curves given")
+	}
+	return ret, nil
+}
+
+// ConfigureTlsAlgorithms applies --ciphers and --curves to config and returns a VerifyConnection hook
+// enforcing --tls13-ciphers (nil if not given): Go always offers all of its TLS 1.3 suites, so the best
+// we can do is refuse a connection on which the server chose one that wasn't allowed.
+func (ctx *CurlContext) ConfigureTlsAlgorithms(config *tls.Config) (func(tls.ConnectionState) error, *curlerrors.CurlError) {
+	if ctx.TlsCiphers != "" {
+		suites, err := ParseCipherSuites(ctx.TlsCiphers, false)
+		if err != nil {
+			return nil, curlerrors.NewCurlErrorFromStringAndError(curlerrors.ERROR_SSL_CIPHER, "Invalid --ciphers", err)
+		}
+		config.CipherSuites = suites
+	}
+	if ctx.TlsCurves != "" {
+		curves, err := ParseCurves(ctx.TlsCurves)
+		if err != nil {
+			return nil, curlerrors.NewCurlErrorFromStringAndError(curlerrors.ERROR_SSL_CIPHER, "Invalid --curves", err)
+		}
+		config.CurvePreferences = curves
+	}
+	if ctx.Tls13Ciphers == "" {
+		return nil, nil
+	}
+	allowed, err := ParseCipherSuites(ctx.Tls13Ciphers, true)
+	if err != nil {
+		return nil, curlerrors.NewCurlErrorFromStringAndError(curlerrors.ERROR_SSL_CIPHER, "Invalid --tls13-ciphers", err)
+	}
+	return func(cs tls.ConnectionState) error {
+		if cs.Version == tls.VersionTLS13 && !slices.Contains(allowed, cs.CipherSuite) {
+			return fmt.Errorf("%w: server chose %s, not allowed by --tls13-ciphers", ErrCipherNotAllowed, tls.CipherSuiteName(cs.CipherSuite))
+		}
+		return nil
+	}, nil
+}
+
+// ErrCipherNotAllowed is returned (wrapped) from the TLS handshake when --tls13-ciphers rules out the server's choice.
+var ErrCipherNotAllowed = errors.New("cipher not allowed")
+
+// chainVerifyConnection runs each non-nil hook in turn, for tls.Config.VerifyConnection.
+func chainVerifyConnection(hooks ...func(tls.ConnectionState) error) func(tls.ConnectionState) error {
+	var active []func(tls.ConnectionState) error
+	for _, h := range hooks {
+		if h != nil {
+			active = append(active, h)
+		}
+	}
+	if len(active) == 0 {
+		return nil
+	}
+	return func(cs tls.ConnectionState) error {
+		for _, h := range active {
+			if err := h(cs); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// DescribeTlsSupport describes the ciphers and curves this build supports, for --list-tls.
+func DescribeTlsSupport() string {
+	var sb strings.Builder
+	sb.WriteString("Ciphers (--ciphers for TLS 1.2 and below, --tls13-ciphers for TLS 1.3):\n")
+	for _, suite := range allCipherSuites() {
+		var versions []string
+		for _, v := range suite.SupportedVersions {
+			versions = append(versions, GetTlsVersionString(v))
+		}
+		insecure := ""
+		if suite.Insecure {
+			insecure = " (insecure)"
+		}
+		fmt.Fprintf(&sb, "  %-30s %-45s %s%s\n", openSslCipherNames[suite.ID], suite.Name, strings.Join(versions, ","), insecure)
+	}
+	sb.WriteString("Curves (--curves):\n")
+	for _, c := range curveNames {
+		fmt.Fprintf(&sb, "  %-20s %s\n", c.id.String(), strings.Join(c.names, ", "))
+	}
+	return sb.String()
+}
@@ -0,0 +1,110 @@
+package context
+
+import (
+	"crypto/tls"
+	"net/http"
+	"testing"
+	"time"
+
+	curlerrors "github.com/cdwiegand/go-curling/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseCipherSuites(t *testing.T) {
+	suites, err := ParseCipherSuites("ECDHE-ECDSA-AES128-GCM-SHA256:TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384, ecdhe-rsa-chacha20-poly1305", false)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384, tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256}, suites)
+
+	suites, err = ParseCipherSuites("DES-CBC3-SHA", false) // insecure, but deliberately allowed for testing servers
+	assert.Nil(t, err)
+	assert.Equal(t, []uint16{tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA}, suites)
+
+	suites, err = ParseCipherSuites("TLS_AES_256_GCM_SHA384:TLS_CHACHA20_POLY1305_SHA256", true)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint16{tls.TLS_AES_256_GCM_SHA384, tls.TLS_CHACHA20_POLY1305_SHA256}, suites)
+
+	_, err = ParseCipherSuites("HIGH:!aNULL", false)
+	assert.ErrorContains(t, err, "unknown cipher HIGH")
+	_, err = ParseCipherSuites("TLS_AES_128_GCM_SHA256", false)
+	assert.ErrorContains(t, err, "--tls13-ciphers")
+	_, err = ParseCipherSuites("AES128-SHA", true)
+	assert.ErrorContains(t, err, "--ciphers")
+	_, err = ParseCipherSuites("::", false)
+	assert.Error(t, err)
+}
+
+func Test_ParseCurves(t *testing.T) {
+	curves, err := ParseCurves("X25519MLKEM768:x25519:prime256v1,P-384 secp521r1")
+	assert.Nil(t, err)
+	assert.Equal(t, []tls.CurveID{tls.X25519MLKEM768, tls.X25519, tls.CurveP256, tls.CurveP384, tls.CurveP521}, curves)
+
+	_, err = ParseCurves("X448")
+	assert.ErrorContains(t, err, "unknown curve X448")
+}
+
+func Test_Tls13CiphersVerifier(t *testing.T) {
+	ctx := &CurlContext{Tls13Ciphers: "TLS_CHACHA20_POLY1305_SHA256"}
+	verify, cerr := ctx.ConfigureTlsAlgorithms(&tls.Config{})
+	assert.Nil(t, cerr)
+	assert.Nil(t, verify(tls.ConnectionState{Version: tls.VersionTLS13, CipherSuite: tls.TLS_CHACHA20_POLY1305_SHA256}))
+	assert.ErrorIs(t, verify(tls.ConnectionState{Version: tls.VersionTLS13, CipherSuite: tls.TLS_AES_128_GCM_SHA256}), ErrCipherNotAllowed)
+	// TLS 1.2 connections are --ciphers' business
+	assert.Nil(t, verify(tls.ConnectionState{Version: tls.VersionTLS12, CipherSuite: tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256}))
+
+	ctx = &CurlContext{TlsCurves: "P-999"}
+	_, cerr = ctx.ConfigureTlsAlgorithms(&tls.Config{})
+	if assert.NotNil(t, cerr) {
+		assert.Equal(t, curlerrors.ERROR_SSL_CIPHER, cerr.ExitCode)
+	}
+}
+
+func tlsAlgorithmsRequest(t *testing.T, ctx *CurlContext, url string) (*tls.ConnectionState, *curlerrors.CurlError) {
+	t.Helper()
+	client, cerr := ctx.BuildClient()
+	if cerr != nil {
+		return nil, cerr
+	}
+	request, cerr := ctx.BuildHttpRequest(url, 0, true, true)
+	if cerr != nil {
+		return nil, cerr
+	}
+	resp, cerr := ctx.GetCompleteResponse(0, client, request)
+	if cerr != nil {
+		return nil, cerr
+	}
+	return resp.Responses[0].HttpResponse.TLS, nil
+}
+
+func Test_CiphersAndCurves_AgainstServer(t *testing.T) {
+	ca := newTestCA(t, "cipher test CA")
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	tls12 := newTestTLSServer(t, ca.issue(t, "localhost", false, time.Hour), handler, func(c *tls.Config) {
+		c.MaxVersion = tls.VersionTLS12
+		c.CipherSuites = []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384}
+	})
+
+	state, cerr := tlsAlgorithmsRequest(t, &CurlContext{IgnoreBadCerts: true, TlsCiphers: "ECDHE-ECDSA-AES256-GCM-SHA384"}, tls12.URL)
+	if assert.Nil(t, cerr) {
+		assert.Equal(t, tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384, state.CipherSuite)
+	}
+	_, cerr = tlsAlgorithmsRequest(t, &CurlContext{IgnoreBadCerts: true, TlsCiphers: "ECDHE-ECDSA-AES128-GCM-SHA256"}, tls12.URL)
+	assert.NotNil(t, cerr)
+
+	pq := newTestTLSServer(t, ca.issue(t, "localhost", false, time.Hour), handler, func(c *tls.Config) {
+		c.CurvePreferences = []tls.CurveID{tls.X25519MLKEM768}
+	})
+	state, cerr = tlsAlgorithmsRequest(t, &CurlContext{IgnoreBadCerts: true, TlsCurves: "X25519MLKEM768"}, pq.URL)
+	if assert.Nil(t, cerr) {
+		assert.Equal(t, tls.X25519MLKEM768, state.CurveID)
+	}
+	_, cerr = tlsAlgorithmsRequest(t, &CurlContext{IgnoreBadCerts: true, TlsCurves: "P-256"}, pq.URL)
+	assert.NotNil(t, cerr)
+}
+
+func Test_DescribeTlsSupport(t *testing.T) {
+	list := DescribeTlsSupport()
+	assert.Contains(t, list, "ECDHE-ECDSA-AES128-GCM-SHA256")
+	assert.Contains(t, list, "TLS_AES_128_GCM_SHA256")
+	assert.Contains(t, list, "X25519MLKEM768")
+	assert.Contains(t, list, "(insecure)")
+}
@@ -3,7 +3,6 @@ package context
 import (
 	"bytes"
 	"fmt"
-	"io"
 	"mime"
 	"mime/multipart"
 	"net/url"
@@ -15,7 +14,7 @@ import (
 )
 
 // -T
-func (ctx *CurlContext) HandleUploadRawFile(index int) (io.Reader, *curlerrors.CurlError) {
+func (ctx *CurlContext) HandleUploadRawFile(plan *RequestPlan, index int) (*bytes.Buffer, *curlerrors.CurlError) {
 	// DOES use index - sends a file per URL
 	if len(ctx.Upload_File) > index {
 		filename := ctx.Upload_File[index]
@@ -30,11 +29,11 @@ func (ctx *CurlContext) HandleUploadRawFile(index int) (io.Reader, *curlerrors.C
 		bodyBuf := &bytes.Buffer{}
 		bodyBuf.Write(f)
 
-		ctx.SetMethodIfNotSet("PUT")
+		plan.setMethodIfNotSet("PUT")
 		if mimeType != "" {
-			ctx.SetHeaderIfNotSet("Content-Type", mimeType)
+			plan.setHeaderIfNotSet("Content-Type", mimeType)
 		}
-		return io.Reader(bodyBuf), nil
+		return bodyBuf, nil
 	}
 	return nil, nil
 }
@@ -45,7 +44,7 @@ func (ctx *CurlContext) HandleUploadRawFile(index int) (io.Reader, *curlerrors.C
 // -F name=value
 // --form-string name=anyvalue (anyvalue can start with @ or <, they are ignored)
 // Note: no -F @file support
-func (ctx *CurlContext) HandleFormMultipart() (io.Reader, *curlerrors.CurlError) {
+func (ctx *CurlContext) HandleFormMultipart(plan *RequestPlan) (*bytes.Buffer, *curlerrors.CurlError) {
 	bodyBuf := &bytes.Buffer{}
 	writer := multipart.NewWriter(bodyBuf)
 
@@ -83,8 +82,8 @@ func (ctx *CurlContext) HandleFormMultipart() (io.Reader, *curlerrors.CurlError)
 		return nil, cerr
 	}
 
-	ctx.SetMethodIfNotSet("POST")
-	ctx.SetHeaderIfNotSet("Content-Type", "multipart/form-data; boundary="+writer.Boundary())
+	plan.setMethodIfNotSet("POST")
+	plan.setHeaderIfNotSet("Content-Type", "multipart/form-data; boundary="+writer.Boundary())
 	return bodyBuf, nil
 }
 
@@ -128,16 +127,16 @@ func handleFormArg(name string, value string, writer *multipart.Writer) *curlerr
 // -d name=@file
 // -d @file (lines of name=value)
 // -d (--data), --data-raw, --data-binary, --data-urlencoded
-func (ctx *CurlContext) HandleDataArgs(returnAsGetParams bool) (*bytes.Buffer, *curlerrors.CurlError) {
+func (ctx *CurlContext) HandleDataArgs(plan *RequestPlan, returnAsGetParams bool) (*bytes.Buffer, *curlerrors.CurlError) {
 	bodyBuf := &bytes.Buffer{}
 	if len(ctx.Data_Json) > 0 {
 		err0 := handleDataArgs_Json(ctx, bodyBuf)
 		if err0 != nil {
 			return nil, err0
 		}
-		ctx.SetHeaderIfNotSet("Accept", "application/json")
-		ctx.SetHeaderIfNotSet("Content-Type", "application/json")
-		ctx.SetMethodIfNotSet("POST")
+		plan.setHeaderIfNotSet("Accept", "application/json")
+		plan.setHeaderIfNotSet("Content-Type", "application/json")
+		plan.setMethodIfNotSet("POST")
 		return bodyBuf, nil
 	}
 
@@ -162,8 +161,8 @@ func (ctx *CurlContext) HandleDataArgs(returnAsGetParams bool) (*bytes.Buffer, *
 	}
 
 	if !returnAsGetParams {
-		ctx.SetMethodIfNotSet("POST")
-		ctx.SetHeaderIfNotSet("Content-Type", "application/x-www-form-urlencoded")
+		plan.setMethodIfNotSet("POST")
+		plan.setHeaderIfNotSet("Content-Type", "application/x-www-form-urlencoded")
 	}
 
 	return bodyBuf, nil
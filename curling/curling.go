@@ -0,0 +1,181 @@
+// Package curling is go-curling as a library: build a Client from options (or from curl style command line
+// arguments), then Do requests with a context.Context and get back every response of the redirect chain.
+//
+//	client, cerr := curling.New(curling.WithFollowRedirects(10), curling.WithHeader("Accept", "application/json"))
+//	if cerr != nil {
+//		return cerr
+//	}
+//	result, cerr := client.Do(ctx, "https://example.com/")
+//	if cerr != nil {
+//		return cerr
+//	}
+//	defer result.Close()
+//	body, err := io.ReadAll(result.Final().Body)
+//
+// New parses its options with the cli package's flag definitions (so a Client has go-curling's defaults, and
+// WithArgs takes exactly what the command line does), so this package depends on cli: cli must never import it.
+package curling
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	curlcli "github.com/cdwiegand/go-curling/cli"
+	curl "github.com/cdwiegand/go-curling/context"
+	curlerrors "github.com/cdwiegand/go-curling/errors"
+)
+
+// Client runs requests configured by a CurlContext, reusing one http.Client (and so its connections).
+type Client struct {
+	curlCtx    *curl.CurlContext
+	httpClient *http.Client
+}
+
+// Result is everything one URL produced: each request sent for it, in order (a retried request appears once
+// per attempt, then each redirect followed), and the error that ended it, if any.
+type Result struct {
+	Index     int // which URL of the Client's this was for, see DoIndex
+	Hops      []*Hop
+	Err       *curlerrors.CurlError // as returned by Do
+	responses *curl.CurlResponses
+	request   *http.Request
+}
+
+// Hop is one request and its response.
+type Hop struct {
+	Request  *http.Request
+	Response *http.Response // nil if the request failed
+	Body     io.ReadCloser  // Response.Body, unread; closed by Result.Close
+	Timings  curl.Timings
+	Err      error // why the request failed, if it did
+}
+
+// New returns a Client configured as the command line would: WithArgs first (or go-curling's defaults), then
+// the other options in order.
+func New(opts ...Option) (*Client, *curlerrors.CurlError) {
+	o := new(options)
+	for _, opt := range opts {
+		opt(o)
+	}
+	curlCtx := new(curl.CurlContext)
+	nonFlagArgs, cerr := curlcli.ParseFlags(o.args, curlCtx)
+	if cerr != nil {
+		return nil, cerr
+	}
+	for _, configure := range o.configure {
+		configure(curlCtx)
+	}
+	if cerr := curlCtx.SetupContextForRun(nonFlagArgs); cerr != nil {
+		return nil, cerr
+	}
+	return NewFromCurlContext(curlCtx)
+}
+
+// NewFromCurlContext returns a Client for a CurlContext already prepared by SetupContextForRun, as the CLI does.
+func NewFromCurlContext(curlCtx *curl.CurlContext) (*Client, *curlerrors.CurlError) {
+	httpClient, cerr := curlCtx.BuildClient()
+	if cerr != nil {
+		return nil, cerr
+	}
+	return &Client{curlCtx: curlCtx, httpClient: httpClient}, nil
+}
+
+// ForCurlContext is a Client for another CurlContext, such as a later -:/--next group, that sends its requests with
+// this Client's http.Client: the same connections, TLS settings and cookie jar.
+func (c *Client) ForCurlContext(curlCtx *curl.CurlContext) *Client {
+	return &Client{curlCtx: curlCtx, httpClient: c.httpClient}
+}
+
+// CurlContext is the configuration the Client runs with.
+func (c *Client) CurlContext() *curl.CurlContext {
+	return c.curlCtx
+}
+
+// Do requests url, following redirects if enabled. Per-URL settings (such as WithUploadFile) are always those of
+// the first URL given to the Client, whatever url is: use DoIndex for another's. The Result holds whatever
+// responses were received even when an error is returned.
+func (c *Client) Do(ctx context.Context, url string) (*Result, *curlerrors.CurlError) {
+	return c.do(ctx, url, 0)
+}
+
+// DoIndex requests the index'th URL given to the Client (with WithUrl, or on the command line).
+func (c *Client) DoIndex(ctx context.Context, index int) (*Result, *curlerrors.CurlError) {
+	if index < 0 || index >= len(c.curlCtx.Urls) {
+		return nil, curlerrors.NewCurlErrorFromString(curlerrors.ERROR_INVALID_URL, "no such URL")
+	}
+	return c.do(ctx, c.curlCtx.Urls[index], index)
+}
+
+func (c *Client) do(ctx context.Context, url string, index int) (*Result, *curlerrors.CurlError) {
+	result := &Result{Index: index}
+	request, cerr := c.curlCtx.BuildHttpRequest(url, index, true, true)
+	if cerr != nil {
+		result.Err = cerr.AtUrl(index, 0)
+		return result, result.Err
+	}
+	result.request = request.WithContext(ctx)
+	result.responses, result.Err = c.curlCtx.GetCompleteResponse(index, c.httpClient, result.request)
+	if result.responses != nil {
+		for _, resp := range result.responses.Responses {
+			hop := &Hop{Request: resp.Request, Response: resp.HttpResponse, Timings: resp.Timings, Err: resp.Error}
+			if resp.HttpResponse != nil {
+				hop.Body = resp.HttpResponse.Body
+			}
+			result.Hops = append(result.Hops, hop)
+		}
+	}
+	return result, result.Err
+}
+
+// WriteOutputs writes result wherever the Client's configuration says to (-o, -D, -c and so on), as the CLI
+// does, reading (and closing) the final body. There is nothing to write for a nil Result, or one whose request
+// was never sent (its error is the Result's Err).
+func (c *Client) WriteOutputs(result *Result) curlerrors.CurlErrorCollection {
+	if result == nil || result.responses == nil {
+		return curlerrors.CurlErrorCollection{}
+	}
+	return c.curlCtx.ProcessResponseToOutputs(result.Index, result.responses, result.request)
+}
+
+// Close closes the files WriteOutputs has written.
+func (c *Client) Close() error {
+	return c.curlCtx.CloseOutputs()
+}
+
+// SaveCookies saves the cookie jar (WithCookieJar), which WriteOutputs also does.
+func (c *Client) SaveCookies() *curlerrors.CurlError {
+	if err := c.curlCtx.SaveCookieJar(); err != nil {
+		return curlerrors.NewCurlErrorFromStringAndError(curlerrors.ERROR_CANNOT_WRITE_FILE, "Failed to save cookies to jar", err)
+	}
+	return nil
+}
+
+// Final is the last hop, whose response is the one curl would output, or nil if no request was sent.
+func (r *Result) Final() *Hop {
+	if len(r.Hops) == 0 {
+		return nil
+	}
+	return r.Hops[len(r.Hops)-1]
+}
+
+// CurlResponses is the result as the context package's functions take it (nil for a nil Result).
+func (r *Result) CurlResponses() *curl.CurlResponses {
+	if r == nil {
+		return nil
+	}
+	return r.responses
+}
+
+// Close closes every hop's body.
+func (r *Result) Close() error {
+	var ret error
+	for _, hop := range r.Hops {
+		if hop.Body != nil {
+			if err := hop.Body.Close(); err != nil && ret == nil {
+				ret = err
+			}
+		}
+	}
+	return ret
+}
@@ -0,0 +1,213 @@
+package curling
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	curl "github.com/cdwiegand/go-curling/context"
+	curlerrors "github.com/cdwiegand/go-curling/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func newRedirectServer(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/start", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/end", http.StatusFound)
+	})
+	mux.HandleFunc("/end", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Seen-Header", r.Header.Get("X-Test"))
+		_, _ = w.Write([]byte("done"))
+	})
+	mux.HandleFunc("/echo", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(w, r.Body)
+	})
+	mux.HandleFunc("/hang", func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func Test_Do_FollowsRedirects(t *testing.T) {
+	server := newRedirectServer(t)
+	client, cerr := New(WithFollowRedirects(10), WithHeader("X-Test", "yes"))
+	if !assert.Nil(t, cerr) {
+		return
+	}
+
+	result, cerr := client.Do(context.Background(), server.URL+"/start")
+	if !assert.Nil(t, cerr) {
+		return
+	}
+	defer result.Close()
+
+	assert.Len(t, result.Hops, 2)
+	assert.Equal(t, http.StatusFound, result.Hops[0].Response.StatusCode)
+	assert.Equal(t, "/start", result.Hops[0].Request.URL.Path)
+	final := result.Final()
+	assert.Equal(t, "/end", final.Request.URL.Path)
+	assert.Equal(t, "yes", final.Response.Header.Get("X-Seen-Header"))
+	assert.False(t, final.Timings.Start.IsZero())
+	assert.NotZero(t, final.Timings.Headers)
+	body, err := io.ReadAll(final.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, "done", string(body))
+}
+
+func Test_New_WithArgs(t *testing.T) {
+	server := newRedirectServer(t)
+	client, cerr := New(WithArgs("-d", "a=b", server.URL+"/echo"))
+	if !assert.Nil(t, cerr) {
+		return
+	}
+	assert.Equal(t, []string{server.URL + "/echo"}, client.CurlContext().Urls)
+
+	result, cerr := client.DoIndex(context.Background(), 0)
+	if !assert.Nil(t, cerr) {
+		return
+	}
+	defer result.Close()
+	assert.Equal(t, http.MethodPost, result.Final().Request.Method)
+	body, _ := io.ReadAll(result.Final().Body)
+	assert.Equal(t, "a=b", string(body))
+}
+
+func Test_New_BadArgs(t *testing.T) {
+	_, cerr := New(WithArgs("--no-such-option"))
+	assert.NotNil(t, cerr)
+}
+
+func Test_DoIndex_OutOfRange(t *testing.T) {
+	client, cerr := New(WithUrl("http://localhost/"))
+	if !assert.Nil(t, cerr) {
+		return
+	}
+	result, cerr := client.DoIndex(context.Background(), 1)
+	assert.Nil(t, result)
+	assert.Equal(t, curlerrors.ERROR_INVALID_URL, cerr.ExitCode)
+	assert.Nil(t, result.CurlResponses())
+}
+
+func Test_Do_Cancelled(t *testing.T) {
+	server := newRedirectServer(t)
+	client, cerr := New()
+	if !assert.Nil(t, cerr) {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	result, cerr := client.Do(ctx, server.URL+"/hang")
+	if !assert.NotNil(t, cerr) {
+		return
+	}
+	assert.ErrorIs(t, cerr, context.Canceled)
+	assert.Same(t, cerr, result.Err)
+	assert.Len(t, result.Hops, 1)
+	assert.Nil(t, result.Final().Response)
+	assert.NotNil(t, result.Final().Err)
+}
+
+func Test_Do_ErrorKeepsEarlierHops(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://127.0.0.1:1/", http.StatusFound)
+	})
+	broken := httptest.NewServer(mux)
+	defer broken.Close()
+
+	client, cerr := New(WithFollowRedirects(5))
+	if !assert.Nil(t, cerr) {
+		return
+	}
+	result, cerr := client.Do(context.Background(), broken.URL+"/")
+	if !assert.NotNil(t, cerr) {
+		return
+	}
+	defer result.Close()
+	assert.Equal(t, curlerrors.ERROR_COULDNT_CONNECT, cerr.ExitCode)
+	assert.Equal(t, 1, cerr.Hop)
+	assert.Len(t, result.Hops, 2)
+	assert.Equal(t, http.StatusFound, result.Hops[0].Response.StatusCode)
+	assert.Nil(t, result.Hops[1].Response)
+}
+
+func Test_WriteOutputs(t *testing.T) {
+	server := newRedirectServer(t)
+	outFile := filepath.Join(t.TempDir(), "out")
+	client, cerr := New(WithUrl(server.URL+"/end"), Configure(func(ctx *curl.CurlContext) {
+		ctx.BodyOutput = []string{outFile}
+	}))
+	if !assert.Nil(t, cerr) {
+		return
+	}
+	result, cerr := client.DoIndex(context.Background(), 0)
+	if !assert.Nil(t, cerr) {
+		return
+	}
+	cerrs := client.WriteOutputs(result)
+	assert.False(t, cerrs.HasError())
+
+	// #nosec G304
+	got, err := os.ReadFile(outFile)
+	assert.Nil(t, err)
+	assert.Equal(t, "done", string(got))
+}
+
+func Test_WriteOutputs_NothingSent(t *testing.T) {
+	client, cerr := New(WithData("@" + filepath.Join(t.TempDir(), "missing")))
+	if !assert.Nil(t, cerr) {
+		return
+	}
+	result, cerr := client.Do(context.Background(), "http://localhost/")
+	assert.NotNil(t, cerr)
+	assert.Empty(t, result.Hops)
+	assert.Empty(t, client.WriteOutputs(result))
+	assert.Empty(t, client.WriteOutputs(nil))
+}
+
+func Test_WithOutputWriter(t *testing.T) {
+	server := newRedirectServer(t)
+	outputs := curl.NewMemoryOutputWriter()
+	client, cerr := New(WithArgs("-D", "-", server.URL+"/end"), WithOutputWriter(outputs))
+	if !assert.Nil(t, cerr) {
+		return
+	}
+	defer client.Close()
+	result, cerr := client.DoIndex(context.Background(), 0)
+	if !assert.Nil(t, cerr) {
+		return
+	}
+	cerrs := client.WriteOutputs(result)
+	assert.False(t, cerrs.HasError())
+
+	got := string(outputs.Bytes(curl.DEFAULT_OUTPUT))
+	assert.Contains(t, got, "X-Seen-Header")
+	assert.True(t, strings.HasSuffix(got, "done"))
+}
+
+func Test_WithHandler(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseMultipartForm(1 << 20)
+		_, _ = w.Write([]byte(r.Method + " " + r.FormValue("name")))
+	})
+	outputs := curl.NewMemoryOutputWriter()
+	client, cerr := New(WithHandler(handler), WithOutputWriter(outputs), WithArgs("-F", "name=value", "http://service.test/upload"))
+	if !assert.Nil(t, cerr) {
+		return
+	}
+	result, cerr := client.DoIndex(context.Background(), 0)
+	if !assert.Nil(t, cerr) {
+		return
+	}
+	cerrs := client.WriteOutputs(result)
+	assert.False(t, cerrs.HasError())
+	assert.Equal(t, "POST value", string(outputs.Bytes(curl.DEFAULT_OUTPUT)))
+}
@@ -0,0 +1,131 @@
+package curling
+
+import (
+	"fmt"
+	"net/http"
+
+	curl "github.com/cdwiegand/go-curling/context"
+)
+
+// Option configures a Client, see New.
+type Option func(*options)
+
+type options struct {
+	args      []string
+	configure []func(*curl.CurlContext)
+}
+
+func configure(f func(*curl.CurlContext)) Option {
+	return func(o *options) {
+		o.configure = append(o.configure, f)
+	}
+}
+
+// WithArgs configures the Client from curl style command line arguments, including -K config files; any
+// that aren't options are URLs. They are parsed before all other options, whatever the order given.
+func WithArgs(args ...string) Option {
+	return func(o *options) {
+		o.args = append(o.args, args...)
+	}
+}
+
+// Configure sets anything else on the CurlContext, which has a field for every command line option.
+func Configure(f func(*curl.CurlContext)) Option {
+	return configure(f)
+}
+
+// WithUrl adds a URL for DoIndex.
+func WithUrl(url string) Option {
+	return configure(func(ctx *curl.CurlContext) { ctx.Urls = append(ctx.Urls, url) })
+}
+
+// WithMethod is -X/--request.
+func WithMethod(method string) Option {
+	return configure(func(ctx *curl.CurlContext) { ctx.HttpVerb = method })
+}
+
+// WithHeader is -H/--header.
+func WithHeader(name string, value string) Option {
+	return configure(func(ctx *curl.CurlContext) { ctx.Headers = append(ctx.Headers, fmt.Sprintf("%s: %s", name, value)) })
+}
+
+// WithData is -d/--data: form data, or @file.
+func WithData(data string) Option {
+	return configure(func(ctx *curl.CurlContext) { ctx.Data_Standard = append(ctx.Data_Standard, data) })
+}
+
+// WithJson is --json: a JSON body, or @file.
+func WithJson(json string) Option {
+	return configure(func(ctx *curl.CurlContext) { ctx.Data_Json = append(ctx.Data_Json, json) })
+}
+
+// WithUploadFile is -T/--upload-file; the n'th is uploaded to the n'th URL.
+func WithUploadFile(file string) Option {
+	return configure(func(ctx *curl.CurlContext) { ctx.Upload_File = append(ctx.Upload_File, file) })
+}
+
+// WithUserAgent is -A/--user-agent.
+func WithUserAgent(userAgent string) Option {
+	return configure(func(ctx *curl.CurlContext) { ctx.UserAgent = userAgent })
+}
+
+// WithBasicAuth is -u/--user.
+func WithBasicAuth(user string, password string) Option {
+	return configure(func(ctx *curl.CurlContext) { ctx.UserAuth = user + ":" + password })
+}
+
+// WithBearerToken is --oauth2-bearer.
+func WithBearerToken(token string) Option {
+	return configure(func(ctx *curl.CurlContext) { ctx.OAuth2_BearerToken = token })
+}
+
+// WithFollowRedirects is -L/--location with --max-redirs (0 for no limit).
+func WithFollowRedirects(max int) Option {
+	return configure(func(ctx *curl.CurlContext) {
+		ctx.FollowRedirects = true
+		ctx.MaxRedirects = max
+	})
+}
+
+// WithInsecure is -k/--insecure.
+func WithInsecure() Option {
+	return configure(func(ctx *curl.CurlContext) { ctx.IgnoreBadCerts = true })
+}
+
+// WithCACert is --cacert.
+func WithCACert(file string) Option {
+	return configure(func(ctx *curl.CurlContext) { ctx.CaCertFile = append(ctx.CaCertFile, file) })
+}
+
+// WithClientCert is -E/--cert with --key (keyFile may be empty if certFile has the key).
+func WithClientCert(certFile string, keyFile string) Option {
+	return configure(func(ctx *curl.CurlContext) {
+		ctx.ClientCertFile = append(ctx.ClientCertFile, certFile)
+		ctx.ClientCertKeyFile = keyFile
+	})
+}
+
+// WithRetries is --retry with --retry-delay.
+func WithRetries(retries int, delaySeconds int) Option {
+	return configure(func(ctx *curl.CurlContext) {
+		ctx.MaxRetries = retries
+		ctx.RetryDelaySeconds = delaySeconds
+	})
+}
+
+// WithCookieJar is -c/--cookie-jar: cookies are read from file, and saved to it by Client.SaveCookies.
+func WithCookieJar(file string) Option {
+	return configure(func(ctx *curl.CurlContext) { ctx.CookieJar = file })
+}
+
+// WithHandler sends every request to handler, in-process, instead of over the network: whatever the URL's host, the
+// handler answers, and redirects, cookies, retries and output work as they would against a real server.
+func WithHandler(handler http.Handler) Option {
+	return configure(func(ctx *curl.CurlContext) { ctx.Handler = handler })
+}
+
+// WithOutputWriter sends WriteOutputs' output (and errors) to w instead of stdout, stderr and files: a
+// curl.MemoryOutputWriter captures it, a curl.TeeOutputWriter also writes it as usual.
+func WithOutputWriter(w curl.CurlOutputWriter) Option {
+	return configure(func(ctx *curl.CurlContext) { ctx.OutputWriter = w })
+}
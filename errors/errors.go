@@ -1,5 +1,7 @@
 package errors
 
+import "encoding/json"
+
 const ERROR_INTERNAL = -4
 const ERROR_SSL_SYSTEM_FAILURE = -5
 const ERROR_STATUS_CODE_FAILURE = -6
@@ -9,10 +11,137 @@ const ERROR_CANNOT_READ_FILE = -9
 const ERROR_CANNOT_WRITE_FILE = -10
 const ERROR_CANNOT_WRITE_TO_STDOUT = -11
 const ERROR_INVALID_ARGS = -12
+const ERROR_SSL_PINNED_PUBKEY_MISMATCH = -13
+const ERROR_SSL_CLIENT_CERTIFICATE = -14
+const ERROR_SSL_CIPHER = -15
+const ERROR_SSL_INVALID_CERT_STATUS = -16
+const ERROR_SSL_CERT_REVOKED = -17
+const ERROR_CERT_EXPIRING = -18
+const ERROR_SSL_ECH_REQUIRED = -19
+
+// Finer grained than ERROR_NO_RESPONSE and ERROR_CANNOT_READ_FILE, which is what they were reported as before
+// go-curling used curl's exit codes (see LegacyExitCode).
+const ERROR_UNSUPPORTED_PROTOCOL = -20
+const ERROR_COULDNT_RESOLVE_PROXY = -21
+const ERROR_COULDNT_RESOLVE_HOST = -22
+const ERROR_COULDNT_CONNECT = -23
+const ERROR_OPERATION_TIMEDOUT = -24
+const ERROR_GOT_NOTHING = -25
+const ERROR_SSL_CONNECT = -26
+const ERROR_SSL_PEER_VERIFICATION = -27
+const ERROR_SSL_CACERT_BADFILE = -28
+const ERROR_SSL_CRL_BADFILE = -29
+const ERROR_ABORTED = -30
+
+// curl's exit code for each of our errors, see https://curl.se/libcurl/c/libcurl-errors.html
+var curlExitCodes = map[int]int{
+	ERROR_INTERNAL:                   43,  // CURLE_BAD_FUNCTION_ARGUMENT, curl's "internal error"
+	ERROR_SSL_SYSTEM_FAILURE:         77,  // CURLE_SSL_CACERT_BADFILE
+	ERROR_STATUS_CODE_FAILURE:        22,  // CURLE_HTTP_RETURNED_ERROR
+	ERROR_NO_RESPONSE:                56,  // CURLE_RECV_ERROR
+	ERROR_INVALID_URL:                3,   // CURLE_URL_MALFORMAT
+	ERROR_CANNOT_READ_FILE:           26,  // CURLE_READ_ERROR
+	ERROR_CANNOT_WRITE_FILE:          23,  // CURLE_WRITE_ERROR
+	ERROR_CANNOT_WRITE_TO_STDOUT:     23,  // CURLE_WRITE_ERROR
+	ERROR_INVALID_ARGS:               2,   // curl's exit code for bad command line options
+	ERROR_SSL_PINNED_PUBKEY_MISMATCH: 90,  // CURLE_SSL_PINNEDPUBKEYNOTMATCH
+	ERROR_SSL_CLIENT_CERTIFICATE:     58,  // CURLE_SSL_CERTPROBLEM
+	ERROR_SSL_CIPHER:                 59,  // CURLE_SSL_CIPHER
+	ERROR_SSL_INVALID_CERT_STATUS:    91,  // CURLE_SSL_INVALIDCERTSTATUS
+	ERROR_SSL_CERT_REVOKED:           60,  // CURLE_PEER_FAILED_VERIFICATION
+	ERROR_CERT_EXPIRING:              120, // not a curl error (the response was still fetched), so above any curl code
+	ERROR_SSL_ECH_REQUIRED:           101, // CURLE_ECH_REQUIRED
+	ERROR_UNSUPPORTED_PROTOCOL:       1,   // CURLE_UNSUPPORTED_PROTOCOL
+	ERROR_COULDNT_RESOLVE_PROXY:      5,   // CURLE_COULDNT_RESOLVE_PROXY
+	ERROR_COULDNT_RESOLVE_HOST:       6,   // CURLE_COULDNT_RESOLVE_HOST
+	ERROR_COULDNT_CONNECT:            7,   // CURLE_COULDNT_CONNECT
+	ERROR_OPERATION_TIMEDOUT:         28,  // CURLE_OPERATION_TIMEDOUT
+	ERROR_GOT_NOTHING:                52,  // CURLE_GOT_NOTHING
+	ERROR_SSL_CONNECT:                35,  // CURLE_SSL_CONNECT_ERROR
+	ERROR_SSL_PEER_VERIFICATION:      60,  // CURLE_PEER_FAILED_VERIFICATION
+	ERROR_SSL_CACERT_BADFILE:         77,  // CURLE_SSL_CACERT_BADFILE
+	ERROR_SSL_CRL_BADFILE:            82,  // CURLE_SSL_CRL_BADFILE
+	ERROR_ABORTED:                    42,  // CURLE_ABORTED_BY_CALLBACK
+}
+
+// the code each finer grained error was reported as before, for --legacy-exit-codes
+var legacyExitCodes = map[int]int{
+	ERROR_UNSUPPORTED_PROTOCOL:  ERROR_NO_RESPONSE,
+	ERROR_COULDNT_RESOLVE_PROXY: ERROR_NO_RESPONSE,
+	ERROR_COULDNT_RESOLVE_HOST:  ERROR_NO_RESPONSE,
+	ERROR_COULDNT_CONNECT:       ERROR_NO_RESPONSE,
+	ERROR_OPERATION_TIMEDOUT:    ERROR_NO_RESPONSE,
+	ERROR_GOT_NOTHING:           ERROR_NO_RESPONSE,
+	ERROR_SSL_CONNECT:           ERROR_NO_RESPONSE,
+	ERROR_SSL_PEER_VERIFICATION: ERROR_NO_RESPONSE,
+	ERROR_SSL_CACERT_BADFILE:    ERROR_CANNOT_READ_FILE,
+	ERROR_SSL_CRL_BADFILE:       ERROR_CANNOT_READ_FILE,
+	ERROR_ABORTED:               ERROR_NO_RESPONSE,
+}
+
+// CurlExitCode is the process exit code curl uses for the error code (ExitCode of a CurlError).
+func CurlExitCode(code int) int {
+	if ret, ok := curlExitCodes[code]; ok {
+		return ret
+	}
+	return code
+}
+
+// LegacyExitCode is the (negative) process exit code go-curling used for the error code before it adopted curl's.
+func LegacyExitCode(code int) int {
+	if ret, ok := legacyExitCodes[code]; ok {
+		return ret
+	}
+	return code
+}
+
+// Categories of CurlError, coarser than the codes, for callers branching on the kind of failure.
+const CATEGORY_DNS = "dns"
+const CATEGORY_CONNECT = "connect"
+const CATEGORY_TLS = "tls"
+const CATEGORY_TIMEOUT = "timeout"
+const CATEGORY_HTTP_STATUS = "http-status"
+const CATEGORY_IO = "io"
+const CATEGORY_ARGS = "args"
+const CATEGORY_ABORTED = "aborted"
+
+var categories = map[int]string{
+	ERROR_INTERNAL:                   CATEGORY_IO,
+	ERROR_SSL_SYSTEM_FAILURE:         CATEGORY_TLS,
+	ERROR_STATUS_CODE_FAILURE:        CATEGORY_HTTP_STATUS,
+	ERROR_NO_RESPONSE:                CATEGORY_CONNECT,
+	ERROR_INVALID_URL:                CATEGORY_ARGS,
+	ERROR_CANNOT_READ_FILE:           CATEGORY_IO,
+	ERROR_CANNOT_WRITE_FILE:          CATEGORY_IO,
+	ERROR_CANNOT_WRITE_TO_STDOUT:     CATEGORY_IO,
+	ERROR_INVALID_ARGS:               CATEGORY_ARGS,
+	ERROR_SSL_PINNED_PUBKEY_MISMATCH: CATEGORY_TLS,
+	ERROR_SSL_CLIENT_CERTIFICATE:     CATEGORY_TLS,
+	ERROR_SSL_CIPHER:                 CATEGORY_TLS,
+	ERROR_SSL_INVALID_CERT_STATUS:    CATEGORY_TLS,
+	ERROR_SSL_CERT_REVOKED:           CATEGORY_TLS,
+	ERROR_CERT_EXPIRING:              CATEGORY_TLS,
+	ERROR_SSL_ECH_REQUIRED:           CATEGORY_TLS,
+	ERROR_UNSUPPORTED_PROTOCOL:       CATEGORY_ARGS,
+	ERROR_COULDNT_RESOLVE_PROXY:      CATEGORY_DNS,
+	ERROR_COULDNT_RESOLVE_HOST:       CATEGORY_DNS,
+	ERROR_COULDNT_CONNECT:            CATEGORY_CONNECT,
+	ERROR_OPERATION_TIMEDOUT:         CATEGORY_TIMEOUT,
+	ERROR_GOT_NOTHING:                CATEGORY_CONNECT,
+	ERROR_SSL_CONNECT:                CATEGORY_TLS,
+	ERROR_SSL_PEER_VERIFICATION:      CATEGORY_TLS,
+	ERROR_SSL_CACERT_BADFILE:         CATEGORY_TLS,
+	ERROR_SSL_CRL_BADFILE:            CATEGORY_TLS,
+	ERROR_ABORTED:                    CATEGORY_ABORTED,
+}
 
 type CurlError struct {
-	ExitCode    int
-	ErrorString string
+	ExitCode    int    // one of the ERROR_ codes, see CurlExitCode for the process exit code
+	ErrorString string // the full message, including the cause's
+	Err         error  // the underlying cause, if any
+	Category    string // one of the CATEGORY_ values, from ExitCode
+	UrlIndex    int    // which URL (0 based) it happened on, -1 if not tied to one
+	Hop         int    // which request for that URL: 0 for the URL itself, then 1 for its first redirect and so on, -1 if not known
 }
 
 type CurlErrorCollection struct {
@@ -23,14 +152,61 @@ func (err *CurlError) Error() string {
 	return err.ErrorString
 }
 
+// Unwrap returns the cause, so errors.Is and errors.As see through a CurlError.
+func (err *CurlError) Unwrap() error {
+	return err.Err
+}
+
+// AtUrl records the URL index and hop err happened on, and returns err (which may be nil).
+func (err *CurlError) AtUrl(index int, hop int) *CurlError {
+	if err != nil {
+		err.UrlIndex = index
+		err.Hop = hop
+	}
+	return err
+}
+
+// MarshalJSON renders err for --error-format json.
+func (err *CurlError) MarshalJSON() ([]byte, error) {
+	ret := struct {
+		Message        string `json:"message"`
+		Category       string `json:"category"`
+		Code           int    `json:"code"`
+		ExitCode       int    `json:"exit_code"`
+		LegacyExitCode int    `json:"legacy_exit_code"`
+		Cause          string `json:"cause,omitempty"`
+		UrlIndex       *int   `json:"url_index,omitempty"`
+		Hop            *int   `json:"hop,omitempty"`
+	}{
+		Message:        err.ErrorString,
+		Category:       err.Category,
+		Code:           err.ExitCode,
+		ExitCode:       CurlExitCode(err.ExitCode),
+		LegacyExitCode: LegacyExitCode(err.ExitCode),
+	}
+	if err.Err != nil {
+		ret.Cause = err.Err.Error()
+	}
+	if err.UrlIndex >= 0 {
+		ret.UrlIndex = &err.UrlIndex
+	}
+	if err.Hop >= 0 {
+		ret.Hop = &err.Hop
+	}
+	return json.Marshal(ret)
+}
+
+func newCurlError(exitCode int, errorString string, err error) *CurlError {
+	return &CurlError{ExitCode: exitCode, ErrorString: errorString, Err: err, Category: categories[exitCode], UrlIndex: -1, Hop: -1}
+}
 func NewCurlErrorFromError(exitCode int, err error) *CurlError {
-	return &CurlError{exitCode, err.Error()}
+	return newCurlError(exitCode, err.Error(), err)
 }
 func NewCurlErrorFromString(exitCode int, errorString string) *CurlError {
-	return &CurlError{exitCode, errorString}
+	return newCurlError(exitCode, errorString, nil)
 }
 func NewCurlErrorFromStringAndError(exitCode int, errorString string, err error) *CurlError {
-	return &CurlError{exitCode, errorString + ": " + err.Error()}
+	return newCurlError(exitCode, errorString+": "+err.Error(), err)
 }
 
 func (cerrs *CurlErrorCollection) AppendError(exitCode int, err error) {
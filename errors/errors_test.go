@@ -1,7 +1,9 @@
 package errors
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"testing"
 )
 
@@ -72,3 +74,90 @@ func Test_ErrorCollection(t *testing.T) {
 		t.Error("cc.Errors should be 8 long")
 	}
 }
+
+func Test_ExitCodes(t *testing.T) {
+	cases := []struct {
+		code   int
+		curl   int
+		legacy int
+	}{
+		{ERROR_COULDNT_RESOLVE_HOST, 6, ERROR_NO_RESPONSE},
+		{ERROR_COULDNT_CONNECT, 7, ERROR_NO_RESPONSE},
+		{ERROR_STATUS_CODE_FAILURE, 22, ERROR_STATUS_CODE_FAILURE},
+		{ERROR_CANNOT_WRITE_FILE, 23, ERROR_CANNOT_WRITE_FILE},
+		{ERROR_CANNOT_WRITE_TO_STDOUT, 23, ERROR_CANNOT_WRITE_TO_STDOUT},
+		{ERROR_OPERATION_TIMEDOUT, 28, ERROR_NO_RESPONSE},
+		{ERROR_SSL_CONNECT, 35, ERROR_NO_RESPONSE},
+		{ERROR_SSL_PEER_VERIFICATION, 60, ERROR_NO_RESPONSE},
+		{ERROR_SSL_PINNED_PUBKEY_MISMATCH, 90, ERROR_SSL_PINNED_PUBKEY_MISMATCH},
+		{ERROR_SSL_CACERT_BADFILE, 77, ERROR_CANNOT_READ_FILE},
+	}
+	for _, c := range cases {
+		if got := CurlExitCode(c.code); got != c.curl {
+			t.Errorf("CurlExitCode(%d) = %d, want %d", c.code, got, c.curl)
+		}
+		if got := LegacyExitCode(c.code); got != c.legacy {
+			t.Errorf("LegacyExitCode(%d) = %d, want %d", c.code, got, c.legacy)
+		}
+	}
+}
+
+type testCause struct{}
+
+func (testCause) Error() string { return "test cause" }
+
+func Test_CurlErrorWrapsCause(t *testing.T) {
+	sentinel := errors.New("sentinel")
+	cerr := NewCurlErrorFromStringAndError(ERROR_COULDNT_CONNECT, "Was unable to query URL", fmt.Errorf("dial: %w", sentinel))
+	if !errors.Is(cerr, sentinel) {
+		t.Error("errors.Is should find the cause")
+	}
+	if cerr.ErrorString != "Was unable to query URL: dial: sentinel" {
+		t.Errorf("unexpected ErrorString %q", cerr.ErrorString)
+	}
+	var cause testCause
+	if !errors.As(NewCurlErrorFromError(ERROR_CANNOT_READ_FILE, testCause{}), &cause) {
+		t.Error("errors.As should find the cause")
+	}
+	var asCurlError *CurlError
+	if !errors.As(fmt.Errorf("wrapped: %w", cerr), &asCurlError) || asCurlError.Category != CATEGORY_CONNECT {
+		t.Error("errors.As should find the CurlError and its category")
+	}
+	if NewCurlErrorFromString(ERROR_INVALID_ARGS, "bad").Unwrap() != nil {
+		t.Error("an error from a string has no cause")
+	}
+}
+
+func Test_CurlErrorCategoryAndUrl(t *testing.T) {
+	cases := map[int]string{
+		ERROR_COULDNT_RESOLVE_HOST:  CATEGORY_DNS,
+		ERROR_COULDNT_CONNECT:       CATEGORY_CONNECT,
+		ERROR_SSL_PEER_VERIFICATION: CATEGORY_TLS,
+		ERROR_OPERATION_TIMEDOUT:    CATEGORY_TIMEOUT,
+		ERROR_STATUS_CODE_FAILURE:   CATEGORY_HTTP_STATUS,
+		ERROR_CANNOT_WRITE_FILE:     CATEGORY_IO,
+		ERROR_INVALID_ARGS:          CATEGORY_ARGS,
+	}
+	for code, category := range cases {
+		if got := NewCurlErrorFromString(code, "x").Category; got != category {
+			t.Errorf("category of %d = %q, want %q", code, got, category)
+		}
+	}
+
+	cerr := NewCurlErrorFromString(ERROR_INVALID_ARGS, "bad")
+	if cerr.UrlIndex != -1 || cerr.Hop != -1 {
+		t.Error("a new error is not tied to a URL")
+	}
+	j, _ := json.Marshal(cerr)
+	if string(j) != `{"message":"bad","category":"args","code":-12,"exit_code":2,"legacy_exit_code":-12}` {
+		t.Errorf("unexpected JSON %s", j)
+	}
+	cerr.AtUrl(2, 1)
+	if cerr.UrlIndex != 2 || cerr.Hop != 1 {
+		t.Error("AtUrl should set the URL index and hop")
+	}
+	var nilErr *CurlError
+	if nilErr.AtUrl(0, 0) != nil {
+		t.Error("AtUrl on nil should return nil")
+	}
+}
@@ -0,0 +1,332 @@
+// Package httpbin is an httpbin.org-compatible server, enough of it for go-curling's own tests (and anyone else's)
+// to run without the network: its responses have the same JSON shape httpbin.org's do.
+package httpbin
+
+import (
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math/rand/v2"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const maxMemory = 32 << 20 // for multipart forms, as net/http's default
+
+// maxStreamLines caps /stream/{n}, as httpbin.org does.
+const maxStreamLines = 100
+
+// NewHandler serves these httpbin.org endpoints:
+//
+//	/get, /post, /put, /patch, /delete, /anything    echo the request (args, form, files, data, json, headers...)
+//	/headers, /ip, /user-agent                       echo part of it
+//	/status/{codes}                                  respond with the status, one picked at random if comma separated
+//	/redirect-to?url=&status_code=, /redirect/{n}    redirect
+//	/cookies, /cookies/set, /cookies/delete          show, set (also /cookies/set/{name}/{value}) and delete cookies
+//	/basic-auth/{user}/{passwd}                      require basic auth
+//	/gzip                                            a gzip encoded response
+//	/stream/{n}                                      n JSON lines, each flushed on its own
+func NewHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /get", func(w http.ResponseWriter, r *http.Request) {
+		writeJson(w, http.StatusOK, echo(r, "args", "headers", "origin", "url"))
+	})
+	for _, method := range []string{"POST", "PUT", "PATCH", "DELETE"} {
+		mux.HandleFunc(method+" /"+strings.ToLower(method), handleBody)
+	}
+	mux.HandleFunc("/anything", handleAnything)
+	mux.HandleFunc("/anything/{path...}", handleAnything)
+	mux.HandleFunc("GET /headers", func(w http.ResponseWriter, r *http.Request) {
+		writeJson(w, http.StatusOK, echo(r, "headers"))
+	})
+	mux.HandleFunc("GET /ip", func(w http.ResponseWriter, r *http.Request) {
+		writeJson(w, http.StatusOK, echo(r, "origin"))
+	})
+	mux.HandleFunc("GET /user-agent", func(w http.ResponseWriter, r *http.Request) {
+		writeJson(w, http.StatusOK, map[string]any{"user-agent": r.UserAgent()})
+	})
+	mux.HandleFunc("/status/{codes}", handleStatus)
+	mux.HandleFunc("/redirect-to", handleRedirectTo)
+	mux.HandleFunc("GET /redirect/{n}", handleRedirect)
+	mux.HandleFunc("GET /cookies", func(w http.ResponseWriter, r *http.Request) {
+		writeJson(w, http.StatusOK, map[string]any{"cookies": cookies(r)})
+	})
+	mux.HandleFunc("GET /cookies/set", handleCookiesSet)
+	mux.HandleFunc("GET /cookies/set/{name}/{value}", handleCookiesSet)
+	mux.HandleFunc("GET /cookies/delete", handleCookiesDelete)
+	mux.HandleFunc("GET /basic-auth/{user}/{passwd}", handleBasicAuth)
+	mux.HandleFunc("GET /gzip", handleGzip)
+	mux.HandleFunc("GET /stream/{n}", handleStream)
+	return mux
+}
+
+func handleBody(w http.ResponseWriter, r *http.Request) {
+	ret, err := echoBody(r, "args", "headers", "origin", "url")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJson(w, http.StatusOK, ret)
+}
+
+func handleAnything(w http.ResponseWriter, r *http.Request) {
+	ret, err := echoBody(r, "args", "headers", "origin", "url", "method")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJson(w, http.StatusOK, ret)
+}
+
+func handleStatus(w http.ResponseWriter, r *http.Request) {
+	codes := strings.Split(r.PathValue("codes"), ",")
+	picked := codes[rand.IntN(len(codes))] // #nosec G404 -- picking a test status, not a secret
+	code, err := strconv.Atoi(strings.TrimSpace(picked))
+	if err != nil || code < 100 || code > 599 {
+		http.Error(w, "Invalid status code", http.StatusBadRequest)
+		return
+	}
+	switch {
+	case code >= 300 && code < 400:
+		w.Header().Set("Location", "/redirect/1")
+	case code == http.StatusUnauthorized:
+		w.Header().Set("WWW-Authenticate", `Basic realm="Fake Realm"`)
+	}
+	w.WriteHeader(code)
+}
+
+func handleRedirectTo(w http.ResponseWriter, r *http.Request) {
+	target := r.URL.Query().Get("url")
+	if target == "" {
+		http.Error(w, "Missing url", http.StatusBadRequest)
+		return
+	}
+	code, err := strconv.Atoi(r.URL.Query().Get("status_code"))
+	if err != nil || code < 300 || code > 399 {
+		code = http.StatusFound
+	}
+	// not http.Redirect, which would clean up the target: send it exactly as given
+	w.Header().Set("Location", target)
+	w.WriteHeader(code)
+}
+
+func handleRedirect(w http.ResponseWriter, r *http.Request) {
+	n, err := strconv.Atoi(r.PathValue("n"))
+	if err != nil || n < 1 {
+		http.Error(w, "Invalid redirect count", http.StatusBadRequest)
+		return
+	}
+	location := "/get"
+	if n > 1 {
+		location = "/redirect/" + strconv.Itoa(n-1)
+	}
+	w.Header().Set("Location", location)
+	w.WriteHeader(http.StatusFound)
+}
+
+func handleCookiesSet(w http.ResponseWriter, r *http.Request) {
+	if name := r.PathValue("name"); name != "" {
+		http.SetCookie(w, &http.Cookie{Name: name, Value: r.PathValue("value"), Path: "/"})
+	}
+	for name, values := range r.URL.Query() {
+		http.SetCookie(w, &http.Cookie{Name: name, Value: values[0], Path: "/"})
+	}
+	w.Header().Set("Location", "/cookies")
+	w.WriteHeader(http.StatusFound)
+}
+
+func handleCookiesDelete(w http.ResponseWriter, r *http.Request) {
+	for name := range r.URL.Query() {
+		http.SetCookie(w, &http.Cookie{Name: name, Path: "/", MaxAge: -1})
+	}
+	w.Header().Set("Location", "/cookies")
+	w.WriteHeader(http.StatusFound)
+}
+
+func handleBasicAuth(w http.ResponseWriter, r *http.Request) {
+	user, passwd, ok := r.BasicAuth()
+	if !ok || user != r.PathValue("user") || passwd != r.PathValue("passwd") {
+		w.Header().Set("WWW-Authenticate", `Basic realm="Fake Realm"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	writeJson(w, http.StatusOK, map[string]any{"authenticated": true, "user": user})
+}
+
+func handleGzip(w http.ResponseWriter, r *http.Request) {
+	ret := echo(r, "headers", "origin", "method")
+	ret["gzipped"] = true
+	body, _ := json.MarshalIndent(ret, "", "  ")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Encoding", "gzip")
+	w.WriteHeader(http.StatusOK)
+	gz := gzip.NewWriter(w)
+	_, _ = gz.Write(append(body, '\n'))
+	_ = gz.Close()
+}
+
+func handleStream(w http.ResponseWriter, r *http.Request) {
+	n, err := strconv.Atoi(r.PathValue("n"))
+	if err != nil || n < 0 {
+		http.Error(w, "Invalid line count", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	for id := range min(n, maxStreamLines) {
+		line := echo(r, "url", "args", "headers", "origin")
+		line["id"] = id
+		body, _ := json.Marshal(line)
+		_, _ = w.Write(append(body, '\n'))
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+// echo describes the request as httpbin.org does, with just the keys asked for.
+func echo(r *http.Request, keys ...string) map[string]any {
+	ret := make(map[string]any, len(keys))
+	for _, key := range keys {
+		switch key {
+		case "args":
+			ret[key] = flatten(r.URL.Query())
+		case "headers":
+			headers := map[string]any{"Host": r.Host}
+			for name, values := range r.Header {
+				headers[name] = strings.Join(values, ",")
+			}
+			ret[key] = headers
+		case "origin":
+			ret[key] = origin(r)
+		case "url":
+			scheme := "http"
+			if r.TLS != nil {
+				scheme = "https"
+			}
+			ret[key] = scheme + "://" + r.Host + r.URL.RequestURI()
+		case "method":
+			ret[key] = r.Method
+		}
+	}
+	return ret
+}
+
+// echoBody is echo plus the body: form and files for a form, otherwise data (and json, if it parses as JSON).
+func echoBody(r *http.Request, keys ...string) (map[string]any, error) {
+	ret := echo(r, keys...)
+	ret["form"] = map[string]any{}
+	ret["files"] = map[string]any{}
+	ret["data"] = ""
+	ret["json"] = nil
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/x-www-form-urlencoded":
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil, err
+		}
+		ret["form"] = flatten(form)
+	case "multipart/form-data":
+		if err := r.ParseMultipartForm(maxMemory); err != nil {
+			return nil, err
+		}
+		ret["form"] = flatten(r.MultipartForm.Value)
+		files := make(url.Values)
+		for name, headers := range r.MultipartForm.File {
+			for _, header := range headers {
+				file, err := header.Open()
+				if err != nil {
+					return nil, err
+				}
+				content, err := io.ReadAll(file)
+				_ = file.Close()
+				if err != nil {
+					return nil, err
+				}
+				files.Add(name, asText(content, header.Header.Get("Content-Type")))
+			}
+		}
+		ret["files"] = flatten(files)
+	default:
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		ret["data"] = asText(body, r.Header.Get("Content-Type"))
+		var parsed any
+		if json.Unmarshal(body, &parsed) == nil {
+			ret["json"] = parsed
+		}
+	}
+	return ret, nil
+}
+
+// flatten is a value as a string when there's one of it, and a list when there are more, as httpbin.org does.
+func flatten(values map[string][]string) map[string]any {
+	ret := make(map[string]any, len(values))
+	for name, list := range values {
+		if len(list) == 1 {
+			ret[name] = list[0]
+		} else {
+			ret[name] = list
+		}
+	}
+	return ret
+}
+
+// asText is content as is if it's text, or else a base64 data: URL.
+func asText(content []byte, contentType string) string {
+	if utf8.Valid(content) {
+		return string(content)
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return "data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(content)
+}
+
+func cookies(r *http.Request) map[string]any {
+	ret := make(map[string]any)
+	for _, cookie := range r.Cookies() {
+		ret[cookie.Name] = cookie.Value
+	}
+	return ret
+}
+
+// origin is the client's address, or the X-Forwarded-For chain if it came through a proxy.
+func origin(r *http.Request) string {
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		return forwarded
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func writeJson(w http.ResponseWriter, status int, body any) {
+	b, err := json.MarshalIndent(body, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(b)+1))
+	w.WriteHeader(status)
+	_, _ = w.Write(append(b, '\n'))
+}
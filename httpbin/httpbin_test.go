@@ -0,0 +1,155 @@
+package httpbin
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// jsonOf reads the JSON body of a 200 response: jsonOf(t)(http.Get(...)).
+func jsonOf(t *testing.T) func(*http.Response, error) map[string]any {
+	return func(resp *http.Response, err error) map[string]any {
+		t.Helper()
+		if !assert.Nil(t, err) {
+			t.FailNow()
+		}
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		var ret map[string]any
+		assert.Nil(t, json.NewDecoder(resp.Body).Decode(&ret))
+		return ret
+	}
+}
+
+func Test_Get(t *testing.T) {
+	server := httptest.NewServer(NewHandler())
+	defer server.Close()
+
+	request, _ := http.NewRequest("GET", server.URL+"/get?one=1&two=2&two=3", nil)
+	request.Header.Set("X-Test", "yes")
+	request.Header.Set("X-Forwarded-For", "198.51.100.7")
+	ret := jsonOf(t)(http.DefaultClient.Do(request))
+	assert.Equal(t, map[string]any{"one": "1", "two": []any{"2", "3"}}, ret["args"])
+	assert.Equal(t, "yes", ret["headers"].(map[string]any)["X-Test"])
+	assert.Equal(t, strings.TrimPrefix(server.URL, "http://"), ret["headers"].(map[string]any)["Host"])
+	assert.Equal(t, "198.51.100.7", ret["origin"])
+	assert.Equal(t, server.URL+"/get?one=1&two=2&two=3", ret["url"])
+
+	resp, _ := http.Post(server.URL+"/get", "text/plain", nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+func Test_PostBodies(t *testing.T) {
+	server := httptest.NewServer(NewHandler())
+	defer server.Close()
+
+	ret := jsonOf(t)(http.Post(server.URL+"/post", "application/x-www-form-urlencoded", strings.NewReader("a=1&b=2")))
+	assert.Equal(t, map[string]any{"a": "1", "b": "2"}, ret["form"])
+	assert.Equal(t, "", ret["data"])
+	assert.Nil(t, ret["json"])
+
+	ret = jsonOf(t)(http.Post(server.URL+"/post", "application/json", strings.NewReader(`{"test":"one"}`)))
+	assert.Equal(t, `{"test":"one"}`, ret["data"])
+	assert.Equal(t, map[string]any{"test": "one"}, ret["json"])
+
+	ret = jsonOf(t)(http.Post(server.URL+"/post", "application/octet-stream", strings.NewReader("\xff\x00")))
+	assert.Equal(t, "data:application/octet-stream;base64,/wA=", ret["data"])
+
+	body := &strings.Builder{}
+	writer := multipart.NewWriter(body)
+	_ = writer.WriteField("field", "value")
+	part, _ := writer.CreateFormFile("upload", "upload.txt")
+	_, _ = part.Write([]byte("file contents"))
+	_ = writer.Close()
+	request, _ := http.NewRequest("PUT", server.URL+"/put", strings.NewReader(body.String()))
+	request.Header.Set("Content-Type", writer.FormDataContentType())
+	ret = jsonOf(t)(http.DefaultClient.Do(request))
+	assert.Equal(t, map[string]any{"field": "value"}, ret["form"])
+	assert.Equal(t, map[string]any{"upload": "file contents"}, ret["files"])
+
+	request, _ = http.NewRequest("DELETE", server.URL+"/anything/x", nil)
+	ret = jsonOf(t)(http.DefaultClient.Do(request))
+	assert.Equal(t, "DELETE", ret["method"])
+}
+
+func Test_StatusAndRedirects(t *testing.T) {
+	server := httptest.NewServer(NewHandler())
+	defer server.Close()
+	noFollow := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+	resp, err := noFollow.Get(server.URL + "/status/418")
+	assert.Nil(t, err)
+	assert.Equal(t, 418, resp.StatusCode)
+	resp, _ = noFollow.Get(server.URL + "/status/nope")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, _ = noFollow.Get(server.URL + "/redirect-to?url=https://example.invalid/get%3Fa%3Db&status_code=307")
+	assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+	assert.Equal(t, "https://example.invalid/get?a=b", resp.Header.Get("Location"))
+
+	ret := jsonOf(t)(http.Get(server.URL + "/redirect/3?x=1"))
+	assert.Equal(t, server.URL+"/get", ret["url"])
+}
+
+func Test_Cookies(t *testing.T) {
+	server := httptest.NewServer(NewHandler())
+	defer server.Close()
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+
+	ret := jsonOf(t)(client.Get(server.URL + "/cookies/set/one/1"))
+	assert.Equal(t, map[string]any{"one": "1"}, ret["cookies"])
+	ret = jsonOf(t)(client.Get(server.URL + "/cookies/set?two=2"))
+	assert.Equal(t, map[string]any{"one": "1", "two": "2"}, ret["cookies"])
+	ret = jsonOf(t)(client.Get(server.URL + "/cookies/delete?one"))
+	assert.Equal(t, map[string]any{"two": "2"}, ret["cookies"])
+}
+
+func Test_BasicAuth(t *testing.T) {
+	server := httptest.NewServer(NewHandler())
+	defer server.Close()
+
+	request, _ := http.NewRequest("GET", server.URL+"/basic-auth/alice/secret", nil)
+	resp, _ := http.DefaultClient.Do(request)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.NotEmpty(t, resp.Header.Get("WWW-Authenticate"))
+
+	request.SetBasicAuth("alice", "secret")
+	ret := jsonOf(t)(http.DefaultClient.Do(request))
+	assert.Equal(t, map[string]any{"authenticated": true, "user": "alice"}, ret)
+}
+
+func Test_GzipAndStream(t *testing.T) {
+	server := httptest.NewServer(NewHandler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/gzip")
+	assert.True(t, resp.Uncompressed, "the transport asked for, and undid, the gzip")
+	ret := jsonOf(t)(resp, err)
+	assert.Equal(t, true, ret["gzipped"])
+	assert.Equal(t, "gzip", ret["headers"].(map[string]any)["Accept-Encoding"])
+
+	resp, err = http.Get(server.URL + "/stream/3")
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	scanner := bufio.NewScanner(resp.Body)
+	var ids []float64
+	for scanner.Scan() {
+		var line map[string]any
+		assert.Nil(t, json.Unmarshal(scanner.Bytes(), &line))
+		ids = append(ids, line["id"].(float64))
+	}
+	assert.Equal(t, []float64{0, 1, 2}, ids)
+
+	resp, _ = http.Get(server.URL + "/stream/1000")
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, maxStreamLines, strings.Count(string(body), "\n"))
+}
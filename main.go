@@ -1,26 +1,38 @@
 package main
 
 import (
+	"cmp"
+	"context"
+	"encoding/json"
 	"os"
 
 	curlcli "github.com/cdwiegand/go-curling/cli"
 	curl "github.com/cdwiegand/go-curling/context"
+	"github.com/cdwiegand/go-curling/curling"
 	curlerrors "github.com/cdwiegand/go-curling/errors"
 )
 
 func main() {
-	ctx := new(curl.CurlContext)
-	var cerr *curlerrors.CurlError
+	if serveArgs, ok := serveCommand(os.Args[1:]); ok { // NOT UPSTREAM curl!
+		if cerr := serve(serveArgs); cerr != nil {
+			ctx := &curl.CurlContext{ErrorOutput: curl.DEFAULT_STDERR}
+			reportError(cerr, ctx)
+			os.Exit(ctx.GetExitCode(cerr))
+		}
+		return
+	}
 
-	nonFlagArgs, cerr := curlcli.ParseFlags(os.Args[1:], ctx)
+	ctxs, nonFlagArgs, cerr := curlcli.ParseFlagGroups(os.Args[1:])
 	if cerr != nil {
+		ctx := &curl.CurlContext{ErrorOutput: curl.DEFAULT_STDERR}
 		reportError(cerr, ctx)
-		os.Exit(cerr.ExitCode)
+		os.Exit(ctx.GetExitCode(cerr))
 		return
 	}
+	ctx := ctxs[0] // global options (such as --stderr and -s) are the same in every -:/--next group
 
 	if ctx.Version {
-		_, err := os.Stdout.WriteString("go-curling build ##DEV##")
+		err := ctx.WriteToFileBytes(curl.DEFAULT_OUTPUT, []byte("go-curling build ##DEV##"))
 		if err != nil {
 			panic("Unable to write to stdout")
 		}
@@ -28,70 +40,85 @@ func main() {
 		return
 	}
 
-	cerr = ctx.SetupContextForRun(nonFlagArgs)
-	if cerr != nil {
-		reportError(cerr, ctx)
-		os.Exit(cerr.ExitCode)
+	if ctx.ListTlsSupport {
+		err := ctx.WriteToFileBytes(curl.DEFAULT_OUTPUT, []byte(curl.DescribeTlsSupport()))
+		if err != nil {
+			panic("Unable to write to stdout")
+		}
+		os.Exit(0)
 		return
 	}
 
-	// must be after version check
-	if len(ctx.Urls) == 0 {
-		cerr = curlerrors.NewCurlErrorFromString(curlerrors.ERROR_STATUS_CODE_FAILURE, "no valid URL was not found on the command line, try 'go-curling --help' for usage")
-		reportError(cerr, ctx)
-		os.Exit(cerr.ExitCode)
-		return
+	for i, groupCtx := range ctxs {
+		if i == 0 {
+			cerr = groupCtx.SetupContextForRun(nonFlagArgs[i])
+		} else {
+			cerr = groupCtx.SetupContextForNextGroup(ctxs[i-1], nonFlagArgs[i])
+		}
+		if cerr != nil {
+			reportError(cerr, groupCtx)
+			os.Exit(groupCtx.GetExitCode(cerr))
+			return
+		}
+
+		// must be after version check
+		if len(groupCtx.Urls) == 0 {
+			cerr = curlerrors.NewCurlErrorFromString(curlerrors.ERROR_INVALID_ARGS, "no valid URL was not found on the command line, try 'go-curling --help' for usage")
+			reportError(cerr, groupCtx)
+			os.Exit(groupCtx.GetExitCode(cerr))
+			return
+		}
 	}
 
-	client, cerr := ctx.BuildClient()
+	// one client for every group, so they share connections as well as the cookie jar
+	client, cerr := curling.NewFromCurlContext(ctx)
 	if cerr != nil {
 		reportError(cerr, ctx)
-		os.Exit(cerr.ExitCode)
+		os.Exit(ctx.GetExitCode(cerr))
 		return
 	}
 
 	var lastErrorCode *curlerrors.CurlError
+	for _, groupCtx := range ctxs {
+		lastErrorCode = cmp.Or(runGroup(client.ForCurlContext(groupCtx), groupCtx), lastErrorCode)
+	}
+
+	if lastErrorCode != nil {
+		os.Exit(ctx.GetExitCode(lastErrorCode))
+	}
+}
+
+// runGroup requests each of a group's URLs, returning the last error (or exiting on the first with --fail-early).
+func runGroup(client *curling.Client, ctx *curl.CurlContext) (lastErrorCode *curlerrors.CurlError) {
 	for index := range ctx.Urls {
-		request, cerr := ctx.BuildHttpRequest(ctx.Urls[index], index, true, true)
+		result, cerr := client.DoIndex(context.Background(), index)
 		if cerr != nil {
 			lastErrorCode = cerr
+			if len(result.Hops) > 0 && ctx.FailWithBody {
+				client.WriteOutputs(result)
+			}
+			reportError(cerr, ctx)
 			if ctx.FailEarly {
-				reportError(cerr, ctx)
-				os.Exit(cerr.ExitCode)
+				os.Exit(ctx.GetExitCode(cerr))
 			}
 		} else {
-			resp, cerr := ctx.GetCompleteResponse(index, client, request)
-			if cerr != nil {
-				lastErrorCode = cerr
-				if resp != nil && len(resp.Responses) > 0 && ctx.FailWithBody {
-					ctx.ProcessResponseToOutputs(index, resp, request)
-				}
-				reportError(cerr, ctx)
-				if cerr.ExitCode != 0 && ctx.FailEarly {
-					os.Exit(cerr.ExitCode)
-				}
-			} else {
-				cerrs := ctx.ProcessResponseToOutputs(index, resp, request)
-				if cerrs.HasError() {
-					forceExitCode := 0
-					for _, h := range cerrs.Errors {
-						lastErrorCode = h
-						reportError(h, ctx)
-						if h.ExitCode != 0 {
-							forceExitCode = h.ExitCode
-						}
-					}
-					if forceExitCode != 0 && ctx.FailEarly {
-						os.Exit(forceExitCode)
+			cerrs := client.WriteOutputs(result)
+			if cerrs.HasError() {
+				var forceExit *curlerrors.CurlError
+				for _, h := range cerrs.Errors {
+					lastErrorCode = h
+					reportError(h, ctx)
+					if h.ExitCode != 0 {
+						forceExit = h
 					}
 				}
+				if forceExit != nil && ctx.FailEarly {
+					os.Exit(ctx.GetExitCode(forceExit))
+				}
 			}
 		}
 	}
-
-	if lastErrorCode != nil {
-		os.Exit(lastErrorCode.ExitCode)
-	}
+	return
 }
 
 func reportError(err *curlerrors.CurlError, ctx *curl.CurlContext) string {
@@ -99,6 +126,12 @@ func reportError(err *curlerrors.CurlError, ctx *curl.CurlContext) string {
 		return ""
 	}
 	entry := "Error: " + err.ErrorString + ".\n"
+	if ctx.ErrorFormat == curl.ERROR_FORMAT_JSON {
+		j, jerr := json.Marshal(err)
+		if jerr == nil {
+			entry = string(j) + "\n"
+		}
+	}
 
 	if err.ExitCode == curlerrors.ERROR_CANNOT_WRITE_TO_STDOUT {
 		// don't recurse (it called us to report the failure to write errors to a normal file)
@@ -106,7 +139,7 @@ func reportError(err *curlerrors.CurlError, ctx *curl.CurlContext) string {
 	}
 
 	if (!ctx.IsSilent && !ctx.SilentFail) || ctx.ShowErrorEvenIfSilent {
-		oserr := ctx.WriteToFileBytes(ctx.ErrorOutput, []byte(entry))
+		oserr := ctx.WriteToErrorOutput([]byte(entry))
 		if oserr != nil && !ctx.SilentFail {
 			panic(err)
 		}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	curl "github.com/cdwiegand/go-curling/context"
+	curlerrors "github.com/cdwiegand/go-curling/errors"
+	"github.com/cdwiegand/go-curling/httpbin"
+	flag "github.com/spf13/pflag"
+)
+
+// SERVE_FLAG, as the first argument, runs the httpbin server instead of curl. It's a flag curl doesn't have,
+// rather than a word like "serve", which curl would take as a URL (http://serve/).
+const SERVE_FLAG = "--serve-httpbin"
+
+// serveCommand returns the server's arguments if args (without the program name) ask for it.
+func serveCommand(args []string) ([]string, bool) {
+	if len(args) == 0 || args[0] != SERVE_FLAG {
+		return nil, false
+	}
+	return args[1:], true
+}
+
+type serveArgs struct {
+	Listen  string
+	TlsCert string
+	TlsKey  string
+}
+
+func parseServeArgs(args []string) (*serveArgs, *curlerrors.CurlError) {
+	ret := new(serveArgs)
+	flags := flag.NewFlagSet(os.Args[0]+" "+SERVE_FLAG, flag.ContinueOnError)
+	flags.StringVarP(&ret.Listen, "listen", "l", "localhost:8080", "Address to listen on")
+	flags.StringVar(&ret.TlsCert, "cert", "", "PEM certificate (chain) to serve https with")
+	flags.StringVar(&ret.TlsKey, "key", "", "PEM private key for --cert")
+	if err := flags.Parse(args); err != nil {
+		return nil, curlerrors.NewCurlErrorFromStringAndError(curlerrors.ERROR_INVALID_ARGS, "Invalid args/failed to parse flags", err)
+	}
+	if flags.NArg() > 0 {
+		return nil, curlerrors.NewCurlErrorFromString(curlerrors.ERROR_INVALID_ARGS, SERVE_FLAG+" takes no arguments, only --listen, --cert and --key")
+	}
+	if (ret.TlsCert == "") != (ret.TlsKey == "") {
+		return nil, curlerrors.NewCurlErrorFromString(curlerrors.ERROR_INVALID_ARGS, "--cert and --key must be given together")
+	}
+	return ret, nil
+}
+
+// serve runs `go-curling --serve-httpbin`: the built-in httpbin.org-compatible server, until killed.
+func serve(args []string) *curlerrors.CurlError {
+	opts, cerr := parseServeArgs(args)
+	if cerr != nil {
+		return cerr
+	}
+	listener, err := net.Listen("tcp", opts.Listen)
+	if err != nil {
+		return curlerrors.NewCurlErrorFromStringAndError(curlerrors.ERROR_COULDNT_CONNECT, "Unable to listen on "+opts.Listen, err)
+	}
+
+	server := &http.Server{Handler: httpbin.NewHandler(), ReadHeaderTimeout: 10 * time.Second}
+	scheme := "http"
+	if opts.TlsCert != "" {
+		scheme = "https"
+	}
+	ctx := &curl.CurlContext{ErrorOutput: curl.DEFAULT_STDERR}
+	_ = ctx.WriteToErrorOutput([]byte("Serving httpbin on " + scheme + "://" + listener.Addr().String() + "/\n"))
+
+	if opts.TlsCert != "" {
+		err = server.ServeTLS(listener, opts.TlsCert, opts.TlsKey)
+	} else {
+		err = server.Serve(listener)
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return curlerrors.NewCurlErrorFromStringAndError(curlerrors.ERROR_INTERNAL, "Unable to serve", err)
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"testing"
 
 	curl "github.com/cdwiegand/go-curling/context"
@@ -22,3 +23,45 @@ func Test_reportError(t *testing.T) {
 		t.Errorf("Wanted '%q' but got '%q'", wanted, got)
 	}
 }
+
+func Test_reportError_Json(t *testing.T) {
+	ctx := &curl.CurlContext{ErrorFormat: curl.ERROR_FORMAT_JSON}
+	testError := curlerrors.NewCurlErrorFromStringAndError(curlerrors.ERROR_COULDNT_RESOLVE_HOST, "Was unable to query URL http://nowhere.invalid", errors.New("no such host")).AtUrl(1, 0)
+	got := reportError(testError, ctx)
+	wanted := `{"message":"Was unable to query URL http://nowhere.invalid: no such host","category":"dns","code":-22,"exit_code":6,"legacy_exit_code":-7,"cause":"no such host","url_index":1,"hop":0}` + "\n"
+	if got != wanted {
+		t.Errorf("Wanted '%q' but got '%q'", wanted, got)
+	}
+}
+
+func Test_serveCommand(t *testing.T) {
+	args, ok := serveCommand([]string{"--serve-httpbin", "-l", ":9000"})
+	if !ok || len(args) != 2 || args[0] != "-l" {
+		t.Errorf("Wanted the server's arguments but got %v, %v", args, ok)
+	}
+
+	// curl takes a bare word as a host, so these are requests, not the server
+	for _, cli := range [][]string{{"serve"}, {"serve", "-l", ":9000"}, {"-v", "--serve-httpbin"}, {}} {
+		if _, ok = serveCommand(cli); ok {
+			t.Errorf("Wanted %v to be a curl command line, not the server", cli)
+		}
+	}
+}
+
+func Test_parseServeArgs(t *testing.T) {
+	opts, cerr := parseServeArgs(nil)
+	if cerr != nil || opts.Listen != "localhost:8080" || opts.TlsCert != "" {
+		t.Errorf("Wanted the defaults but got %+v, %v", opts, cerr)
+	}
+
+	opts, cerr = parseServeArgs([]string{"-l", ":9000", "--cert", "c.pem", "--key", "k.pem"})
+	if cerr != nil || opts.Listen != ":9000" || opts.TlsCert != "c.pem" || opts.TlsKey != "k.pem" {
+		t.Errorf("Wanted the given options but got %+v, %v", opts, cerr)
+	}
+
+	for _, args := range [][]string{{"--cert", "c.pem"}, {"http://localhost/"}, {"--bogus"}} {
+		if _, cerr = parseServeArgs(args); cerr == nil || cerr.ExitCode != curlerrors.ERROR_INVALID_ARGS {
+			t.Errorf("Wanted an invalid args error for %v but got %v", args, cerr)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package curltestharness
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"unicode"
+
+	curl "github.com/cdwiegand/go-curling/context"
+)
+
+// A TestRun with a Cassette replays go-curling's requests from it (see --replay), and compares against the curl
+// outputs recorded beside it (CASSETTE.curl.json) rather than running curl, so needs neither a server nor curl. A
+// missing cassette runs as if there were none (against the built-in httpbin, or the network if UseNetwork); cassettes
+// are only recorded, every one of them, when GO_CURLING_TEST_RECORD is set. Every TestRun has one by default
+// (see defaultCassette).
+//
+// The committed cassettes and .curl.json files were recorded against the built-in httpbin, not httpbin.org: the
+// cassettes' "origin" is 192.0.2.1 (what the in-process handler gives as the client's address), and the .curl.json
+// files' 127.0.0.1, curl having been pointed at a local httpbin with --connect-to.
+
+var (
+	cassettesMu      sync.Mutex
+	cassettesPerTest = make(map[string]int)
+)
+
+// defaultCassette is testdata/cassettes/<the test's name, in snake case>.json: Test_GetWithQuery_CmdLine's is
+// get_with_query_cmd_line.json. A test's second TestRun gets get_with_query_cmd_line_2.json, and so on, counting
+// afresh each time the test runs (as with -count=2).
+func defaultCassette(t *testing.T) string {
+	name := snakeCase(strings.TrimPrefix(t.Name(), "Test_"))
+	cassettesMu.Lock()
+	cassettesPerTest[t.Name()]++
+	n := cassettesPerTest[t.Name()]
+	cassettesMu.Unlock()
+	if n == 1 {
+		t.Cleanup(func() {
+			cassettesMu.Lock()
+			delete(cassettesPerTest, t.Name())
+			cassettesMu.Unlock()
+		})
+	}
+	if n > 1 {
+		name += "_" + strconv.Itoa(n)
+	}
+	return filepath.Join("testdata", "cassettes", name+".json")
+}
+
+// snakeCase is name (such as "PostWithMultipartForm4_CmdLine") lower case, with words separated by underscores.
+func snakeCase(name string) string {
+	var ret strings.Builder
+	runes := []rune(name)
+	for i, r := range runes {
+		switch {
+		case unicode.IsUpper(r):
+			if i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]) ||
+				(unicode.IsUpper(runes[i-1]) && i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+				ret.WriteRune('_')
+			}
+			ret.WriteRune(unicode.ToLower(r))
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			ret.WriteRune(r)
+		case i > 0 && !strings.HasSuffix(ret.String(), "_"):
+			ret.WriteRune('_')
+		}
+	}
+	return ret.String()
+}
+
+// recordingCassettes is whether GO_CURLING_TEST_RECORD asks for cassettes to be (re-)recorded.
+func recordingCassettes() bool {
+	return os.Getenv("GO_CURLING_TEST_RECORD") != ""
+}
+
+func (run *TestRun) replayingCassette() bool {
+	if run.Cassette == "" || recordingCassettes() {
+		return false
+	}
+	_, err := os.Stat(run.Cassette)
+	return err == nil
+}
+
+// curlCassetteFile is where the curl outputs to compare with are kept, beside the cassette.
+func curlCassetteFile(cassette string) string {
+	return strings.TrimSuffix(cassette, ".json") + ".curl.json"
+}
+
+func (run *TestRun) useCassette(ctx *curl.CurlContext) error {
+	if run.Cassette == "" {
+		return nil
+	}
+	run.replaying = run.replayingCassette() // decided up front, as recording creates the cassette
+	if run.replaying {
+		ctx.ReplayFile = run.Cassette
+		ctx.Handler = nil
+		return nil
+	}
+	if !recordingCassettes() {
+		return nil
+	}
+	ctx.RecordFile = run.Cassette
+	return os.MkdirAll(filepath.Dir(run.Cassette), 0750)
+}
+
+// runCurl is what curl writes to each output file for args, or nil (having logged why) if there's nothing to
+// compare with: curl isn't installed, or wasn't when the cassette was recorded.
+func (run *TestRun) runCurl(args []string) ([]string, error) {
+	if run.replaying {
+		data, err := os.ReadFile(curlCassetteFile(run.Cassette))
+		if errors.Is(err, os.ErrNotExist) {
+			run.Testing.Logf("Not comparing to curl, as it wasn't recorded with %s", run.Cassette)
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		var outputs []string
+		return outputs, json.Unmarshal(data, &outputs)
+	}
+
+	if _, err := exec.LookPath("curl"); err != nil {
+		run.Testing.Logf("Not comparing to curl, as it isn't installed: %v", err)
+		return nil, nil
+	}
+	args, err := run.curlArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	cmd, _, outputFiles := run.FixLinuxRunIfWindowsToWslCurlRun(args)
+	if err := cmd.Run(); err != nil {
+		return nil, errors.New("Error running @[" + cmd.Path + "] " + strings.Join(cmd.Args, " ") + ": " + err.Error())
+	}
+
+	outputs := []string{}
+	for _, file := range outputFiles {
+		data, err := os.ReadFile(file) // #nosec G304
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, string(data))
+	}
+	if run.Cassette != "" && recordingCassettes() {
+		data, err := json.MarshalIndent(outputs, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(curlCassetteFile(run.Cassette), append(data, '\n'), 0600); err != nil {
+			return nil, err
+		}
+	}
+	return outputs, nil
+}
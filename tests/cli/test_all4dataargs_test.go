@@ -14,6 +14,8 @@ import (
 
 func Test_All4DataArgs_Context(t *testing.T) {
 	testRun := curltests.BuildTestRun(t)
+	// the request holds a temp file's path, so no recording can match it
+	testRun.Cassette = ""
 	testRun.SkipCompareJsonToRealCurl = true // we will test below, json contents will differ due to file paths
 	testRun.ContextBuilder = func(testrun *curltests.TestRun) *curl.CurlContext {
 		os.WriteFile(testRun.GetNextInputFile(), []byte("testdatastandardfile=a&b1=c"), 0666)
@@ -102,7 +104,7 @@ func Test_All4DataArgs_CmdLine(t *testing.T) {
 		testRun.ErrorHandler(cerr, testRun)
 	}
 
-	bodyData, cerr := ctx.HandleDataArgs(ctx.ConvertPostFormIntoGet)
+	bodyData, cerr := ctx.HandleDataArgs(new(curl.RequestPlan), ctx.ConvertPostFormIntoGet)
 	if cerr != nil {
 		testRun.ErrorHandler(cerr, testRun)
 	}
@@ -131,6 +133,8 @@ func Test_All4DataArgs_CmdLine(t *testing.T) {
 
 func Test_All4DataArgs_CmdLine2(t *testing.T) {
 	testRun := curltests.BuildTestRun(t)
+	// the request holds a temp file's path, so no recording can match it
+	testRun.Cassette = ""
 	testRun.SkipCompareJsonToRealCurl = true // we will test below, json contents will differ due to file paths
 	testRun.CmdLineBuilder = func(testrun *curltests.TestRun) []string {
 		os.WriteFile(testRun.GetNextInputFile(), []byte("testdatastandardfile=a&b1=c"), 0666)
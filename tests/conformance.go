@@ -0,0 +1,298 @@
+package curltestharness
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	curl "github.com/cdwiegand/go-curling/context"
+	"github.com/cdwiegand/go-curling/curling"
+)
+
+// ConformanceCase is one case of the conformance corpus (tests/conformance/testdata): a command line, the responses
+// a local server gives it, and what real curl did with them: the requests it sent, byte for byte, and its output.
+// Args, Files, Responses and KnownDifference are written by hand; the rest is captured from curl by
+// CaptureFromCurl (go test ./tests/conformance -update), and KnownDiff from go-curling at the same time.
+//
+// In Args, Files and Responses, {{URL}} is the local server (http://127.0.0.1:PORT) and {{DIR}} the directory Files
+// are written to. In Requests, {{HOST}} is the local server's host:port and {{BOUNDARY}} a multipart boundary, as
+// both change from run to run.
+type ConformanceCase struct {
+	Name            string            `json:"-"` // the file name, without .json
+	Description     string            `json:"description"`
+	Args            []string          `json:"args"`
+	Files           map[string]string `json:"files,omitempty"`
+	Responses       []string          `json:"responses"`                  // raw HTTP responses, in turn; the last is repeated
+	KnownDifference string            `json:"known_difference,omitempty"` // why go-curling doesn't match curl (yet)
+	KnownDiff       string            `json:"known_diff,omitempty"`       // Diff's result when it was written
+	CurlVersion     string            `json:"curl_version"`
+	Requests        []string          `json:"requests"`
+	Output          string            `json:"output"`
+
+	file string
+}
+
+func LoadConformanceCases(dir string) ([]*ConformanceCase, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(files)
+	var cases []*ConformanceCase
+	for _, file := range files {
+		data, err := os.ReadFile(file) // #nosec G304
+		if err != nil {
+			return nil, err
+		}
+		c := &ConformanceCase{Name: strings.TrimSuffix(filepath.Base(file), ".json"), file: file}
+		if err := json.Unmarshal(data, c); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		cases = append(cases, c)
+	}
+	return cases, nil
+}
+
+func (c *ConformanceCase) Save() error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(c.file, append(data, '\n'), 0600)
+}
+
+// CaptureFromCurl runs the case with the installed curl, recording its version, requests and output.
+func (c *ConformanceCase) CaptureFromCurl(dir string) error {
+	version, err := exec.Command("curl", "--version").Output()
+	if err != nil {
+		return fmt.Errorf("unable to run curl: %w", err)
+	}
+	c.CurlVersion = strings.Join(strings.Fields(string(version))[:2], " ")
+
+	server, args, err := c.start(dir)
+	if err != nil {
+		return err
+	}
+	defer server.Close()
+
+	// -q first, so no .curlrc changes what curl sends
+	cmd := exec.Command("curl", append([]string{"-q"}, args...)...) // #nosec G204 -- the corpus's own command lines
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("curl %s: %w\n%s", strings.Join(args, " "), err, stderr.String())
+	}
+	c.Requests = server.Requests()
+	c.Output = stdout.String()
+	return nil
+}
+
+// RunGoCurling runs the case with go-curling (in-process, but over a real connection), returning the requests it
+// sent and what it wrote to stdout.
+func (c *ConformanceCase) RunGoCurling(dir string) (requests []string, output string, err error) {
+	server, args, err := c.start(dir)
+	if err != nil {
+		return nil, "", err
+	}
+	defer server.Close()
+
+	outputs := curl.NewMemoryOutputWriter()
+	client, cerr := curling.New(curling.WithArgs(args...), curling.WithOutputWriter(outputs))
+	if cerr != nil {
+		return nil, "", cerr
+	}
+	defer client.Close()
+	for index := range client.CurlContext().Urls {
+		result, cerr := client.DoIndex(context.Background(), index)
+		if cerr != nil {
+			return server.Requests(), "", cerr
+		}
+		if cerrs := client.WriteOutputs(result); cerrs.HasError() {
+			return server.Requests(), "", cerrs.Errors[0]
+		}
+	}
+	return server.Requests(), string(outputs.Bytes(curl.DEFAULT_OUTPUT)), nil
+}
+
+// Diff is how go-curling's requests and output differ from curl's, "" if they're the same, byte for byte but for
+// the order of the request headers: Go's net/http writes them (other than Host and User-Agent) sorted by name.
+func (c *ConformanceCase) Diff(requests []string, output string) string {
+	var diffs []string
+	for i := range max(len(c.Requests), len(requests)) {
+		var want, got string
+		if i < len(c.Requests) {
+			want = sortHeaderLines(c.Requests[i])
+		}
+		if i < len(requests) {
+			got = sortHeaderLines(requests[i])
+		}
+		if want != got {
+			diffs = append(diffs, fmt.Sprintf("request %d:\n%s", i, lineDiff(want, got)))
+		}
+	}
+	if output != c.Output {
+		diffs = append(diffs, "output:\n"+lineDiff(c.Output, output))
+	}
+	return strings.Join(diffs, "\n")
+}
+
+// sortHeaderLines sorts a raw request's header lines, leaving its request line and body as they are.
+func sortHeaderLines(request string) string {
+	head, body, found := strings.Cut(request, "\r\n\r\n")
+	if !found {
+		return request
+	}
+	lines := strings.Split(head, "\r\n")
+	slices.Sort(lines[1:])
+	return strings.Join(lines, "\r\n") + "\r\n\r\n" + body
+}
+
+// lineDiff lists the lines (CRLF kept, so line endings show) that differ: -curl's, +go-curling's.
+func lineDiff(want string, got string) string {
+	wantLines := strings.SplitAfter(want, "\n")
+	gotLines := strings.SplitAfter(got, "\n")
+	var ret strings.Builder
+	for i := range max(len(wantLines), len(gotLines)) {
+		var w, g string
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if w == g {
+			continue
+		}
+		if i < len(wantLines) {
+			fmt.Fprintf(&ret, "  - %q\n", w)
+		}
+		if i < len(gotLines) {
+			fmt.Fprintf(&ret, "  + %q\n", g)
+		}
+	}
+	return ret.String()
+}
+
+// start writes the case's files to dir and starts its server, returning the args to run with.
+func (c *ConformanceCase) start(dir string) (*captureServer, []string, error) {
+	for name, content := range c.Files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			return nil, nil, err
+		}
+	}
+	server, err := startCaptureServer(c.Responses)
+	if err != nil {
+		return nil, nil, err
+	}
+	replacer := strings.NewReplacer("{{URL}}", "http://"+server.host, "{{DIR}}", dir)
+	args := make([]string, len(c.Args))
+	for i, arg := range c.Args {
+		args[i] = replacer.Replace(arg)
+	}
+	return server, args, nil
+}
+
+// captureServer is an HTTP/1.1 server that keeps every request exactly as it came off the wire, and answers each
+// with the next of its canned responses.
+type captureServer struct {
+	listener  net.Listener
+	host      string
+	responses []string
+
+	mu       sync.Mutex
+	requests []string
+	conns    []net.Conn
+	wg       sync.WaitGroup
+}
+
+func startCaptureServer(responses []string) (*captureServer, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &captureServer{listener: listener, host: listener.Addr().String(), responses: responses}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns = append(s.conns, conn)
+			s.mu.Unlock()
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.serve(conn)
+			}()
+		}
+	}()
+	return s, nil
+}
+
+func (s *captureServer) serve(conn net.Conn) {
+	defer conn.Close()
+	var raw bytes.Buffer
+	reader := bufio.NewReader(io.TeeReader(conn, &raw))
+	for {
+		req, err := http.ReadRequest(reader)
+		if err != nil {
+			return
+		}
+		if _, err := io.Copy(io.Discard, req.Body); err != nil {
+			return
+		}
+		// what's been read, less anything read ahead (there's nothing: clients wait for the response)
+		request := string(raw.Next(raw.Len() - reader.Buffered()))
+
+		s.mu.Lock()
+		s.requests = append(s.requests, s.normalize(request, req.Header))
+		response := s.responses[min(len(s.requests), len(s.responses))-1]
+		s.mu.Unlock()
+
+		response = strings.ReplaceAll(response, "{{URL}}", "http://"+s.host)
+		if _, err := io.WriteString(conn, response); err != nil {
+			return
+		}
+	}
+}
+
+// normalize replaces what changes from run to run with placeholders.
+func (s *captureServer) normalize(request string, header http.Header) string {
+	request = strings.ReplaceAll(request, s.host, "{{HOST}}")
+	if _, params, err := mime.ParseMediaType(header.Get("Content-Type")); err == nil && params["boundary"] != "" {
+		request = strings.ReplaceAll(request, params["boundary"], "{{BOUNDARY}}")
+	}
+	return request
+}
+
+func (s *captureServer) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.requests)
+}
+
+// Close stops the server, closing the connections clients are keeping alive.
+func (s *captureServer) Close() {
+	_ = s.listener.Close()
+	s.mu.Lock()
+	for _, conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
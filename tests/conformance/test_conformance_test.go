@@ -0,0 +1,55 @@
+package curltestharnessconformance
+
+import (
+	"flag"
+	"testing"
+
+	curltests "github.com/cdwiegand/go-curling/tests"
+)
+
+// -update re-captures every case's requests and output from the installed curl, keeping what's written by hand.
+var update = flag.Bool("update", false, "re-capture the conformance corpus from the installed curl")
+
+func Test_Conformance(t *testing.T) {
+	cases, err := curltests.LoadConformanceCases("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	matched := 0
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			if *update {
+				if err := c.CaptureFromCurl(t.TempDir()); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			requests, output, err := c.RunGoCurling(t.TempDir())
+			if err != nil {
+				t.Fatalf("%s: %v", c.Description, err)
+			}
+			diff := c.Diff(requests, output)
+			if *update {
+				c.KnownDiff = ""
+				if c.KnownDifference != "" {
+					c.KnownDiff = diff
+				}
+				if err := c.Save(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			switch {
+			case diff == "" && c.KnownDifference == "":
+				matched++
+			case diff == "":
+				t.Errorf("%s now matches curl: remove its known_difference (%s)", c.Name, c.KnownDifference)
+			case c.KnownDifference == "":
+				t.Errorf("%s: differs from curl %s (-curl +go-curling):\n%s", c.Description, c.CurlVersion, diff)
+			case diff != c.KnownDiff:
+				t.Errorf("%s: differs from curl %s other than as known (%s), -curl +go-curling:\n%s\nrather than:\n%s",
+					c.Description, c.CurlVersion, c.KnownDifference, diff, c.KnownDiff)
+			}
+		})
+	}
+	t.Logf("go-curling matches curl byte-for-byte (bar header order) in %d of %d cases", matched, len(cases))
+}
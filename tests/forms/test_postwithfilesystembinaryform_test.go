@@ -12,6 +12,8 @@ import (
 
 func Test_PostWithFilesystemBinaryForm_CurlContext(t *testing.T) {
 	testRun := curltests.BuildTestRun(t)
+	// the request holds a temp file's path, so no recording can match it
+	testRun.Cassette = ""
 	testRun.ContextBuilder = func(testrun *curltests.TestRun) *curl.CurlContext {
 		os.WriteFile(testrun.GetNextInputFile(), []byte("a&b=c"), 0666)
 		return &curl.CurlContext{
@@ -40,6 +42,8 @@ func Test_PostWithFilesystemBinaryForm_CurlContext_directFile(t *testing.T) {
 }
 func Test_PostWithFilesystemBinaryForm_CmdLine(t *testing.T) {
 	testRun := curltests.BuildTestRun(t)
+	// the request holds a temp file's path, so no recording can match it
+	testRun.Cassette = ""
 	testRun.CmdLineBuilder = func(testrun *curltests.TestRun) []string {
 		os.WriteFile(testrun.GetNextInputFile(), []byte("a&b=c"), 0666)
 		return []string{"https://httpbin.org/post", "-X", "POST", "--data-binary", "test=@" + testrun.ListInputFiles[0], "-o", testrun.GetOneOutputFile()}
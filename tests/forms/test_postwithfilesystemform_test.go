@@ -13,6 +13,8 @@ import (
 
 func Test_PostWithFilesystemForm_CurlContext(t *testing.T) {
 	testRun := curltests.BuildTestRun(t)
+	// the request holds a temp file's path, so no recording can match it
+	testRun.Cassette = ""
 	testRun.ContextBuilder = func(testrun *curltests.TestRun) *curl.CurlContext {
 		os.WriteFile(testrun.GetNextInputFile(), []byte("one"), 0666)
 		return &curl.CurlContext{
@@ -27,6 +29,8 @@ func Test_PostWithFilesystemForm_CurlContext(t *testing.T) {
 }
 func Test_PostWithFilesystemForm_CmdLine(t *testing.T) {
 	testRun := curltests.BuildTestRun(t)
+	// the request holds a temp file's path, so no recording can match it
+	testRun.Cassette = ""
 	testRun.CmdLineBuilder = func(testrun *curltests.TestRun) []string {
 		os.WriteFile(testrun.GetNextInputFile(), []byte("one"), 0666)
 		return []string{"https://httpbin.org/post", "-X", "POST", "-d", "test=@" + testrun.ListInputFiles[0], "-o", testrun.GetOneOutputFile()}
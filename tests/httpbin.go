@@ -0,0 +1,102 @@
+package curltestharness
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cdwiegand/go-curling/httpbin"
+)
+
+// HttpbinHost is the host the tests are written against. Unless a TestRun UseNetwork (or GO_CURLING_TEST_NETWORK is
+// set), its URLs are served by the built-in httpbin instead: in-process for go-curling, and by local servers (that
+// curl is pointed at with --connect-to) for the curl comparison.
+const HttpbinHost = "httpbin.org"
+
+// useNetworkByDefault is GO_CURLING_TEST_NETWORK, to run the tests against the real httpbin.org as they once did.
+func useNetworkByDefault() bool {
+	return os.Getenv("GO_CURLING_TEST_NETWORK") != ""
+}
+
+// onlyHttpbinUrls is whether every URL is on HttpbinHost, so can be served by the built-in httpbin (a test of some
+// other host, such as one that can't resolve, must still go to the network).
+func onlyHttpbinUrls(urls []string) bool {
+	for _, u := range urls {
+		parsed, err := url.Parse(u)
+		if err != nil || parsed.Host != HttpbinHost {
+			return false
+		}
+	}
+	return len(urls) > 0
+}
+
+var localHttpbin struct {
+	once    sync.Once
+	http    *httptest.Server
+	https   *httptest.Server
+	certPem []byte
+	err     error
+}
+
+// startLocalHttpbin starts (once, for all the tests) an http and an https built-in httpbin server, the latter with
+// a self-signed certificate for HttpbinHost.
+func startLocalHttpbin() error {
+	localHttpbin.once.Do(func() {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			localHttpbin.err = err
+			return
+		}
+		template := &x509.Certificate{
+			SerialNumber:          big.NewInt(1),
+			Subject:               pkix.Name{CommonName: HttpbinHost},
+			DNSNames:              []string{HttpbinHost},
+			NotBefore:             time.Now().Add(-time.Hour),
+			NotAfter:              time.Now().Add(24 * time.Hour),
+			IsCA:                  true,
+			BasicConstraintsValid: true,
+			KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+			ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+		if err != nil {
+			localHttpbin.err = err
+			return
+		}
+		localHttpbin.certPem = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+		localHttpbin.http = httptest.NewServer(httpbin.NewHandler())
+		localHttpbin.https = httptest.NewUnstartedServer(httpbin.NewHandler())
+		localHttpbin.https.TLS = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+		localHttpbin.https.StartTLS()
+	})
+	return localHttpbin.err
+}
+
+// LocalHttpbinCurlArgs are the arguments that point curl's HttpbinHost requests at the local httpbin servers.
+func (run *TestRun) LocalHttpbinCurlArgs() ([]string, error) {
+	if err := startLocalHttpbin(); err != nil {
+		return nil, err
+	}
+	caFile := filepath.Join(run.TempDir, "httpbin-ca.pem")
+	if err := os.WriteFile(caFile, localHttpbin.certPem, 0600); err != nil {
+		return nil, err
+	}
+	return []string{
+		"--cacert", caFile,
+		"--connect-to", HttpbinHost + ":443:" + strings.TrimPrefix(localHttpbin.https.URL, "https://"),
+		"--connect-to", HttpbinHost + ":80:" + strings.TrimPrefix(localHttpbin.http.URL, "http://"),
+	}, nil
+}
@@ -3,6 +3,7 @@ package curltestharness
 import (
 	"bytes"
 	"cmp"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -17,7 +18,9 @@ import (
 
 	curlcli "github.com/cdwiegand/go-curling/cli"
 	curl "github.com/cdwiegand/go-curling/context"
+	"github.com/cdwiegand/go-curling/curling"
 	curlerrors "github.com/cdwiegand/go-curling/errors"
+	"github.com/cdwiegand/go-curling/httpbin"
 	jsonutil "github.com/cdwiegand/go-curling/jsonutil"
 )
 
@@ -35,6 +38,9 @@ type TestRun struct {
 	Testing                   *testing.T
 	DoNotTestAgainstCurl      bool
 	SkipCompareJsonToRealCurl bool
+	UseNetwork                bool   // send httpbin.org requests to the real one rather than the built-in httpbin
+	Cassette                  string // record to, or replay from, this cassette file (see useCassette); "" for neither
+	replaying                 bool
 	Responses                 *curl.CurlResponses
 }
 
@@ -42,6 +48,8 @@ func BuildTestRun(t *testing.T) *TestRun {
 	ret := new(TestRun)
 	ret.TempDir = t.TempDir()
 	ret.Testing = t
+	ret.UseNetwork = useNetworkByDefault()
+	ret.Cassette = defaultCassette(t)
 
 	// default error handler
 	ret.ErrorHandler = func(err *curlerrors.CurlError, testrun *TestRun) {
@@ -106,6 +114,14 @@ func (run *TestRun) GetTestRunReady() (ctx *curl.CurlContext, args []string, cer
 	}
 
 	cerr = ctx.SetupContextForRun(nonFlagArgs)
+	if cerr == nil && !run.UseNetwork && onlyHttpbinUrls(ctx.Urls) {
+		ctx.Handler = httpbin.NewHandler()
+	}
+	if cerr == nil {
+		if err := run.useCassette(ctx); err != nil {
+			cerr = curlerrors.NewCurlErrorFromError(curlerrors.ERROR_CANNOT_WRITE_FILE, err)
+		}
+	}
 	return
 }
 func (run *TestRun) RunTestRun() {
@@ -119,30 +135,27 @@ func (run *TestRun) RunTestRun() {
 		return
 	}
 
-	client, cerr := ctx.BuildClient()
+	outputs := curl.NewMemoryOutputWriter()
+	ctx.OutputWriter = curl.NewTeeOutputWriter(curl.NewDefaultOutputWriter(), outputs) // still write the files, for tests that check them
+	client, cerr := curling.NewFromCurlContext(ctx)
 	if cerr != nil {
 		run.ErrorHandler(cerr, run)
 		return
 	}
+	defer client.Close()
 
 	var jsonGot []map[string]interface{}
 	var rawJsonsGot []string
 
 	for index := range ctx.Urls {
-		request, cerr := ctx.BuildHttpRequest(ctx.Urls[index], index, true, true)
+		result, cerr := client.DoIndex(context.Background(), index)
+		run.Responses = result.CurlResponses()
 		if cerr != nil {
 			run.ErrorHandler(cerr, run)
 			return
 		}
 
-		resp, cerr := ctx.GetCompleteResponse(index, client, request)
-		run.Responses = resp
-		if cerr != nil {
-			run.ErrorHandler(cerr, run)
-			return
-		}
-
-		cerrs := ctx.ProcessResponseToOutputs(index, resp, request)
+		cerrs := client.WriteOutputs(result)
 		if cerrs.HasError() {
 			for _, h := range cerrs.Errors {
 				run.ErrorHandler(h, run)
@@ -150,12 +163,8 @@ func (run *TestRun) RunTestRun() {
 			return
 		}
 
-		if index >= len(run.ListOutputFiles) {
-			run.ErrorHandler(curlerrors.NewCurlErrorFromString(curlerrors.ERROR_STATUS_CODE_FAILURE, "Failed to parse JSON"), run)
-			return
-		}
-
-		jsonObj, rawJson, err := ReadJson(run.ListOutputFiles[index])
+		_, contentOutput := ctx.GetNextOutputsFromContext(index)
+		jsonObj, rawJson, err := ParseJson(outputs.Bytes(contentOutput))
 		jsonGot = append(jsonGot, jsonObj)
 		rawJsonsGot = append(rawJsonsGot, rawJson)
 
@@ -201,25 +210,25 @@ func ReadJson(file string) (res map[string]interface{}, raw string, err error) {
 	if err != nil {
 		return nil, "", err
 	}
+	return ParseJson(byteValue)
+}
 
+func ParseJson(byteValue []byte) (res map[string]interface{}, raw string, err error) {
 	raw = string(byteValue)
 	if raw != "" {
 		err = json.Unmarshal(byteValue, &res)
 	}
-
 	return res, raw, err
 }
 
 func CompareCurlCliOutput(run *TestRun, args []string, myJsonObjs []map[string]interface{}, myJsonRaws []string) error {
-	cmd, _, outputs := run.FixLinuxRunIfWindowsToWslCurlRun(args)
-
-	curlerr := cmd.Run()
-	if curlerr != nil {
-		return errors.New("Error running @[" + cmd.Path + "] " + strings.Join(cmd.Args, " ") + ": " + curlerr.Error())
+	outputs, err := run.runCurl(args)
+	if err != nil {
+		return err
 	}
 
-	for i, h := range outputs {
-		curlJsonObj, curlJsonRaw, err := ReadJson(h)
+	for i, output := range outputs {
+		curlJsonObj, curlJsonRaw, err := ParseJson([]byte(output))
 		if err != nil {
 			return err
 		}
@@ -258,7 +267,8 @@ func CompareCurlCliOutput(run *TestRun, args []string, myJsonObjs []map[string]i
 			*/
 
 			if !jsonutil.Equal(myJsonObjs[i], curlJsonObj, func(path string) bool {
-				if path == "X-Amzn-Trace-Id" || path == "User-Agent" || path == "Content-Type" || path == "Content-Length" {
+				// origin: the built-in httpbin sees go-curling (in-process) and curl come from different addresses
+				if path == "X-Amzn-Trace-Id" || path == "User-Agent" || path == "Content-Type" || path == "Content-Length" || path == "origin" {
 					return true
 				}
 				return false
@@ -270,6 +280,18 @@ func CompareCurlCliOutput(run *TestRun, args []string, myJsonObjs []map[string]i
 	return nil
 }
 
+// curlArgs are args, plus what's needed to point curl at the built-in httpbin unless UseNetwork.
+func (run *TestRun) curlArgs(args []string) ([]string, error) {
+	if run.UseNetwork {
+		return args, nil
+	}
+	localArgs, err := run.LocalHttpbinCurlArgs()
+	if err != nil {
+		return nil, err
+	}
+	return append(localArgs, args...), nil
+}
+
 func (run *TestRun) FixLinuxRunIfWindowsToWslCurlRun(args []string) (cmd *exec.Cmd, inputs []string, outputs []string) {
 	// test-only harness: args are built by the test cases (not untrusted input) and we
 	// intentionally run the real curl binary to compare its output against go-curling.
@@ -405,9 +427,13 @@ func (run *TestRun) RunTestRunAgainstCurlCli() {
 		run.Testing.Fatal("Forgot to add CmdLineBuilder to 'curl' CLI test!")
 	}
 
+	args, err := run.curlArgs(args)
+	if err != nil {
+		run.Testing.Fatal(err)
+	}
 	cmd, _, outputs := run.FixLinuxRunIfWindowsToWslCurlRun(args)
 
-	err := cmd.Run()
+	err = cmd.Run()
 
 	if err != nil {
 		run.Testing.Fatal(err)
@@ -13,3 +13,10 @@ func Test_ParseLocalCurlVersion(t *testing.T) {
 	assert.Equal(t, got.Minor, 21)
 	assert.Equal(t, got.Patch, 34)
 }
+
+func Test_SnakeCase(t *testing.T) {
+	assert.Equal(t, "get_with_query_cmd_line", snakeCase("GetWithQuery_CmdLine"))
+	assert.Equal(t, "post_with_multipart_form4_cmd_line", snakeCase("PostWithMultipartForm4_CmdLine"))
+	assert.Equal(t, "post_json_cmd_line", snakeCase("PostJSON_CmdLine"))
+	assert.Equal(t, "cookie_round_trip_sub_test", snakeCase("CookieRoundTrip/sub test"))
+}